@@ -2,19 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"ooliokartchallenge/internal/application/outbox"
 	"ooliokartchallenge/internal/application/services"
 	"ooliokartchallenge/internal/config"
+	"ooliokartchallenge/internal/domain/entities"
 	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/eventsinks"
 	httpInfra "ooliokartchallenge/internal/infrastruture/http"
 	"ooliokartchallenge/internal/infrastruture/http/handlers"
 	"ooliokartchallenge/internal/infrastruture/http/middleware"
+	"ooliokartchallenge/internal/infrastruture/idgen"
+	"ooliokartchallenge/internal/infrastruture/payments"
+	"ooliokartchallenge/internal/infrastruture/receipts"
 	"ooliokartchallenge/internal/infrastruture/repositories"
+	"ooliokartchallenge/internal/infrastruture/security"
+	"ooliokartchallenge/internal/infrastruture/webhooks"
 	"ooliokartchallenge/pkg/logger"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -25,9 +36,15 @@ type App struct {
 	server         *http.Server
 	productRepo    interfaces.ProductRepository
 	promoRepo      interfaces.PromoRepository
+	orderRepo      interfaces.OrderRepository
+	stockRepo      interfaces.StockRepository
 	productSerivce interfaces.ProductService
 	promoService   interfaces.PromoService
 	orderService   interfaces.OrderService
+	cartService    interfaces.CartService
+	webhookService interfaces.WebhookService
+	dispatcher     *outbox.Dispatcher
+	eventLog       *eventsinks.JSONLSink
 }
 
 func main() {
@@ -52,6 +69,12 @@ func initialzeApp() (*App, error) {
 	appLogger.Info("Configuration loaded successfully")
 
 	productRepo := repositories.NewProductRepository()
+	outboxRepo := repositories.NewOutboxRepository()
+	orderRepo := repositories.NewOrderRepository(outboxRepo)
+	idempotencyRepo := repositories.NewIdempotencyRepository()
+	cartRepo := repositories.NewCartRepository()
+	stockRepo := repositories.NewStockRepository(repositories.SampleStockLevels())
+	redemptionRepo := repositories.NewPromoRedemptionRepository(int(cfg.CouponMaxRedemptions))
 
 	appLogger.Info("Initializing promo repository", "files", cfg.CouponFiles)
 	promoRepo := repositories.NewPromoRepository(cfg.CouponFiles)
@@ -60,9 +83,88 @@ func initialzeApp() (*App, error) {
 
 	appLogger.Info("Initializing application services")
 
-	promoService := services.NewPromoService(promoRepo)
+	orderPolicy, err := buildOrderPolicy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order configuration: %w", err)
+	}
+
+	promoService := services.NewPromoService(promoRepo, redemptionRepo)
 	productService := services.NewProductService(productRepo)
-	orderService := services.NewOrderService(productRepo, promoService)
+	quoteSecret := []byte(cfg.QuoteSecret)
+	if len(quoteSecret) == 0 {
+		appLogger.Warn("QUOTE_SECRET not set, generating an ephemeral secret; quotes will not survive a restart")
+		quoteSecret = make([]byte, 32)
+		if _, err := rand.Read(quoteSecret); err != nil {
+			return nil, fmt.Errorf("failed to generate quote secret: %w", err)
+		}
+	}
+	quoteSigner := security.NewQuoteSigner(quoteSecret)
+
+	orderIDGenerator, err := buildOrderIDGenerator(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid order ID configuration: %w", err)
+	}
+
+	storeLocation, err := time.LoadLocation(cfg.StoreTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store timezone: %w", err)
+	}
+	orderNumberSequencer := idgen.NewDailySequencer(storeLocation)
+
+	paymentGateway, err := buildPaymentGateway(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment configuration: %w", err)
+	}
+
+	if cfg.SagaLogFile == "" {
+		appLogger.Warn("SAGA_LOG_FILE not set, order placements interrupted by a restart will not be recovered")
+	}
+	sagaRepo, err := repositories.NewSagaRepository(cfg.SagaLogFile, cfg.SagaRetention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open saga log: %w", err)
+	}
+
+	webhookService := services.NewWebhookService(
+		repositories.NewWebhookRepository(),
+		repositories.NewWebhookDeadLetterRepository(int(cfg.WebhookDeadLetters)),
+		webhooks.NewHTTPSender(cfg.WebhookTimeout),
+		entities.WebhookRetryPolicy{
+			MaxAttempts: int(cfg.WebhookMaxAttempts),
+			BaseDelay:   cfg.WebhookBaseDelay,
+			MaxDelay:    cfg.WebhookMaxDelay,
+		},
+	)
+
+	orderService := services.NewOrderService(productRepo, orderRepo, stockRepo, promoService, quoteSigner, orderIDGenerator, orderNumberSequencer, paymentGateway, sagaRepo, orderPolicy, appLogger)
+	cartService := services.NewCartService(cartRepo, productRepo, orderService, promoService, cfg.CartIdleTTL)
+
+	subscribers := eventsinks.NewSubscribers()
+	subscribers.Subscribe("", func(ctx context.Context, event entities.OrderEvent) error {
+		appLogger.Info("Order event", "event_id", event.ID, "type", event.Type, "order_id", event.OrderID)
+		return nil
+	})
+	sinks := []interfaces.EventSink{subscribers, eventsinks.NewPublisherSink("webhooks", webhookService)}
+
+	var eventLog *eventsinks.JSONLSink
+	if cfg.EventLogFile != "" {
+		if eventLog, err = eventsinks.NewJSONLSink(cfg.EventLogFile); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, eventLog)
+	}
+
+	receiptPolicy, err := buildReceiptPolicy(cfg, orderPolicy, storeLocation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid receipt configuration: %w", err)
+	}
+	receiptRenderer, err := receipts.NewTemplateRenderer(cfg.ReceiptTemplateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load receipt templates: %w", err)
+	}
+	receiptService := services.NewReceiptService(orderRepo, receiptRenderer, receiptPolicy)
+	exportService := services.NewOrderExportService(orderRepo, storeLocation)
+
+	dispatcher := outbox.NewDispatcher(outboxRepo, cfg.OutboxPollInterval, int(cfg.OutboxBatchSize), sinks...)
 
 	ctx := context.Background()
 
@@ -70,15 +172,94 @@ func initialzeApp() (*App, error) {
 		return nil, fmt.Errorf("failed to initialize product service: %w", err)
 	}
 
+	recovered, err := orderService.RecoverUnfinishedOrders(ctx)
+	if err != nil {
+		appLogger.Error("Some interrupted orders could not be recovered", "error", err)
+	}
+	if recovered > 0 {
+		appLogger.Info("Recovered interrupted orders", "count", recovered)
+	}
+
 	appLogger.Info("All services initialized successfully")
 
 	productHandler := handlers.NewProductHandler(productService, appLogger)
 	orderHandler := handlers.NewOrderHandler(orderService, appLogger)
+	cartHandler := handlers.NewCartHandler(cartService, appLogger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, appLogger)
+	receiptHandler := handlers.NewReceiptHandler(receiptService, appLogger)
+	exportHandler := handlers.NewExportHandler(exportService, appLogger)
+
+	apiKeyRepo, err := buildAPIKeyRepository(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyAuditRepo, err := repositories.NewAPIKeyAuditRepository(cfg.APIKeyAuditLog)
+	if err != nil {
+		return nil, err
+	}
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, apiKeyAuditRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, appLogger)
+
+	var tokenVerifier interfaces.TokenVerifier
+	if cfg.JWTJWKSFile != "" {
+		tokenVerifier, err = security.NewJWTVerifier(cfg.JWTJWKSFile, security.JWTOptions{
+			Issuer:    cfg.JWTIssuer,
+			Audience:  cfg.JWTAudience,
+			ClockSkew: cfg.JWTClockSkew,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT configuration: %w", err)
+		}
+	}
+
+	var signatureVerifier *middleware.SignatureVerifier
+	if cfg.SigningKeysFile != "" {
+		signingKeyRepo, err := repositories.NewSigningKeyRepository(cfg.SigningKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		signatureVerifier = middleware.NewSignatureVerifier(signingKeyRepo, repositories.NewNonceRepository(int(cfg.SignatureNonceCache)), cfg.SignatureWindow)
+	}
+
+	authSchemes, err := entities.ParseAuthSchemes(cfg.AuthSchemes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth scheme configuration: %w", err)
+	}
+
+	authMiddlerware := middleware.NewAuthMiddleware(apiKeyService, tokenVerifier, signatureVerifier, authSchemes, appLogger)
+	corsMiddleware, err := middleware.NewCORSMiddleware(middleware.CORSOptions{
+		AllowedOrigins:   splitList(cfg.CORSAllowedOrigins),
+		AllowCredentials: cfg.CORSAllowCredentials,
+		ExposedHeaders:   splitList(cfg.CORSExposedHeaders),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	correlationMiddleware := middleware.NewCorrelationMiddleware()
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(idempotencyRepo, cfg.IdempotencyTTL, appLogger)
 
-	authMiddlerware := middleware.NewAuthMiddleware(appLogger)
-	corsMiddleware := middleware.NewCORSMiddleware()
+	accessLogOptions, err := buildAccessLogOptions(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log configuration: %w", err)
+	}
+	accessLogMiddleware, err := middleware.NewAccessLogMiddleware(accessLogOptions, appLogger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log configuration: %w", err)
+	}
+
+	recoveryMiddleware, err := middleware.NewRecoveryMiddleware(cfg.CrashReportDir, appLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimitOptions, err := buildRateLimitOptions(cfg, accessLogOptions.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limit configuration: %w", err)
+	}
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(repositories.NewRateLimitRepository(int(cfg.RateLimitMaxBuckets)), rateLimitOptions, appLogger)
 
-	router := httpInfra.NewRouter(productHandler, orderHandler, authMiddlerware, corsMiddleware)
+	router := httpInfra.NewRouter(productHandler, orderHandler, cartHandler, webhookHandler, receiptHandler, exportHandler, apiKeyHandler, authMiddlerware, corsMiddleware, idempotencyMiddleware, correlationMiddleware, accessLogMiddleware, recoveryMiddleware, rateLimitMiddleware)
 
 	server := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -91,18 +272,191 @@ func initialzeApp() (*App, error) {
 		server:         server,
 		productRepo:    productRepo,
 		promoRepo:      promoRepo,
+		orderRepo:      orderRepo,
+		stockRepo:      stockRepo,
 		productSerivce: productService,
 		promoService:   promoService,
 		orderService:   orderService,
+		cartService:    cartService,
+		webhookService: webhookService,
+		dispatcher:     dispatcher,
+		eventLog:       eventLog,
 	}, nil
 
 }
 
+func buildOrderPolicy(cfg *config.Config) (entities.OrderPolicy, error) {
+	policy := entities.DefaultOrderPolicy()
+
+	currency, err := entities.ParseCurrency(cfg.Currency)
+	if err != nil {
+		return policy, err
+	}
+	policy.Currency = currency
+
+	roundingMode, err := entities.ParseRoundingMode(cfg.RoundingMode)
+	if err != nil {
+		return policy, err
+	}
+	policy.RoundingMode = roundingMode
+
+	duplicateItems, err := entities.ParseDuplicateItemPolicy(cfg.DuplicateItems)
+	if err != nil {
+		return policy, err
+	}
+	policy.DuplicateItems = duplicateItems
+
+	maxOrderValue, err := entities.ParseMoney(cfg.MaxOrderValue, policy.Currency)
+	if err != nil {
+		return policy, fmt.Errorf("invalid maximum order value: %w", err)
+	}
+	policy.Limits = entities.OrderLimits{
+		MaxQuantityPerItem: int(cfg.MaxItemQty),
+		MaxLines:           int(cfg.MaxOrderLines),
+		MaxOrderValue:      maxOrderValue,
+	}
+	policy.QuoteTTL = cfg.QuoteTTL
+	policy.PaymentTimeout = cfg.PaymentTimeout
+
+	return policy, nil
+}
+
+func buildReceiptPolicy(cfg *config.Config, orderPolicy entities.OrderPolicy, location *time.Location) (entities.ReceiptPolicy, error) {
+	taxes, err := entities.ParseTaxRates(cfg.TaxRates)
+	if err != nil {
+		return entities.ReceiptPolicy{}, err
+	}
+
+	paperWidth := int(cfg.ReceiptPaperWidth)
+	if paperWidth != entities.PaperWidth58mm && paperWidth != entities.PaperWidth80mm {
+		return entities.ReceiptPolicy{}, fmt.Errorf("paper width must be %d or %d mm, got %d", entities.PaperWidth58mm, entities.PaperWidth80mm, paperWidth)
+	}
+
+	return entities.ReceiptPolicy{
+		Store: entities.StoreDetails{
+			Name:    cfg.StoreName,
+			Address: cfg.StoreAddress,
+			Phone:   cfg.StorePhone,
+			TaxID:   cfg.StoreTaxID,
+			Footer:  cfg.ReceiptFooter,
+		},
+		Taxes:        taxes,
+		RoundingMode: orderPolicy.RoundingMode,
+		Location:     location,
+		PaperWidth:   paperWidth,
+	}, nil
+}
+
+// buildAPIKeyRepository loads the key file. While there are no keys, which
+// is always the case without a file, API_KEY is registered with orders:write
+// only, so a shared default key cannot administer the server.
+func buildAPIKeyRepository(ctx context.Context, cfg *config.Config) (interfaces.APIKeyRepository, error) {
+	repo, err := repositories.NewAPIKeyRepository(cfg.APIKeysFile)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return repo, nil
+	}
+
+	err = repo.Save(ctx, &entities.APIKey{
+		ID:        middleware.APIKeyID(cfg.APIKey),
+		Name:      "default",
+		Hash:      entities.HashAPIKey(cfg.APIKey),
+		Scopes:    []string{entities.ScopeOrdersWrite},
+		Enabled:   true,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register API key: %w", err)
+	}
+	return repo, nil
+}
+
+func buildAccessLogOptions(cfg *config.Config) (middleware.AccessLogOptions, error) {
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return middleware.AccessLogOptions{}, err
+	}
+
+	return middleware.AccessLogOptions{
+		TrustedProxies:    trustedProxies,
+		Headers:           splitList(cfg.AccessLogHeaders),
+		RedactHeaders:     splitList(cfg.AccessLogRedact),
+		LogBody:           cfg.AccessLogBody,
+		RedactFields:      splitList(cfg.AccessLogRedactBody),
+		SuccessSampleRate: cfg.AccessLogSampleRate,
+	}, nil
+}
+
+func buildRateLimitOptions(cfg *config.Config, trustedProxies []netip.Prefix) (middleware.RateLimitOptions, error) {
+	rules, err := entities.ParseRateLimitRules(cfg.RateLimits)
+	if err != nil {
+		return middleware.RateLimitOptions{}, err
+	}
+	if cfg.RateLimitMaxBuckets <= 0 {
+		return middleware.RateLimitOptions{}, fmt.Errorf("RATE_LIMIT_MAX_BUCKETS must be positive, got %d", cfg.RateLimitMaxBuckets)
+	}
+
+	keyTiers := make(map[string]string)
+	for _, pair := range splitList(cfg.RateLimitKeyTiers) {
+		keyID, tier, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(keyID) == "" || strings.TrimSpace(tier) == "" {
+			return middleware.RateLimitOptions{}, fmt.Errorf("key tier '%s' must look like keyID=tier", pair)
+		}
+		keyTiers[strings.TrimSpace(keyID)] = strings.TrimSpace(tier)
+	}
+
+	return middleware.RateLimitOptions{
+		Policy:         entities.RateLimitPolicy{Rules: rules},
+		KeyTiers:       keyTiers,
+		TrustedProxies: trustedProxies,
+	}, nil
+}
+
+// splitList splits a comma separated setting, dropping blank entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func buildOrderIDGenerator(cfg *config.Config) (interfaces.OrderIDGenerator, error) {
+	switch cfg.OrderIDScheme {
+	case "ulid":
+		return idgen.NewULIDGenerator(), nil
+	case "snowflake":
+		return idgen.NewSnowflakeGenerator(cfg.NodeID)
+	default:
+		return nil, fmt.Errorf("unknown order ID scheme '%s'", cfg.OrderIDScheme)
+	}
+}
+
+func buildPaymentGateway(cfg *config.Config) (interfaces.PaymentGateway, error) {
+	switch cfg.PaymentProvider {
+	case "fake":
+		return payments.NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider '%s'", cfg.PaymentProvider)
+	}
+}
+
 func (a *App) start() error {
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	a.dispatcher.Start()
+
 	go func() {
 		a.logger.Info("Starting HTTP server", "address", a.server.Addr)
 
@@ -115,7 +469,10 @@ func (a *App) start() error {
 
 	a.logger.Info("Server is running successfully",
 		"port", a.config.Port,
-		"api_key_configured", a.config.APIKey != "",
+		"api_keys_file", a.config.APIKeysFile,
+		"api_key_audit_log", a.config.APIKeyAuditLog,
+		"jwt_jwks_file", a.config.JWTJWKSFile,
+		"signing_keys_file", a.config.SigningKeysFile,
 		"promo_file_loaded", len(a.config.CouponFiles))
 
 	<-quit
@@ -129,6 +486,20 @@ func (a *App) start() error {
 		a.logger.Error("Server forced to shutdown", "error", err)
 	}
 
+	if err := a.dispatcher.Drain(ctx); err != nil {
+		a.logger.Error("Order events left in the outbox", "error", err)
+	}
+
+	if err := a.webhookService.Close(ctx); err != nil {
+		a.logger.Error("Webhook deliveries abandoned", "error", err)
+	}
+
+	if a.eventLog != nil {
+		if err := a.eventLog.Close(); err != nil {
+			a.logger.Error("Failed to close event log", "error", err)
+		}
+	}
+
 	a.logger.Info("Server shutdown complete")
 
 	return nil
@@ -0,0 +1,139 @@
+// Package outbox publishes the events stored in the transactional outbox to
+// a set of sinks. An event only leaves the outbox once every sink has
+// accepted it, so each sink sees every event at least once.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+// Dispatcher polls the outbox in the background and publishes what it
+// finds, oldest first. A sink failure stops the pass so events are never
+// published out of order; the event is offered again on the next poll.
+type Dispatcher struct {
+	outbox    interfaces.OutboxRepository
+	sinks     []interfaces.EventSink
+	interval  time.Duration
+	batchSize int
+
+	// pass serialises dispatch passes between the poller and Drain.
+	pass     sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	started  bool
+	stopped  bool
+	lifetime sync.Mutex
+}
+
+func NewDispatcher(outbox interfaces.OutboxRepository, interval time.Duration, batchSize int, sinks ...interfaces.EventSink) *Dispatcher {
+	return &Dispatcher{
+		outbox:    outbox,
+		sinks:     sinks,
+		interval:  interval,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start polls the outbox every interval until Drain is called.
+func (d *Dispatcher) Start() {
+	d.lifetime.Lock()
+	defer d.lifetime.Unlock()
+
+	if d.started || d.stopped {
+		return
+	}
+	d.started = true
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				_, _ = d.DispatchPending(context.Background())
+			}
+		}
+	}()
+}
+
+// DispatchPending publishes pending events until the outbox is empty or a
+// sink fails. It returns how many events were dispatched.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	d.pass.Lock()
+	defer d.pass.Unlock()
+
+	dispatched := 0
+
+	for {
+		entries, err := d.outbox.Pending(ctx, d.batchSize)
+		if err != nil {
+			return dispatched, fmt.Errorf("failed to read outbox: %w", err)
+		}
+		if len(entries) == 0 {
+			return dispatched, nil
+		}
+
+		for _, entry := range entries {
+			if err := d.publish(ctx, entry.Event); err != nil {
+				_ = d.outbox.MarkFailed(ctx, entry.Event.ID, err)
+				return dispatched, err
+			}
+
+			if err := d.outbox.MarkDispatched(ctx, entry.Event.ID); err != nil {
+				return dispatched, fmt.Errorf("failed to mark event %s dispatched: %w", entry.Event.ID, err)
+			}
+			dispatched++
+		}
+	}
+}
+
+func (d *Dispatcher) publish(ctx context.Context, event entities.OrderEvent) error {
+	for _, sink := range d.sinks {
+		if err := sink.Deliver(ctx, event); err != nil {
+			return fmt.Errorf("sink %s rejected event %s: %w", sink.Name(), event.ID, err)
+		}
+	}
+	return nil
+}
+
+// Drain stops polling and publishes whatever is left in the outbox,
+// retrying failed sinks every interval until the outbox is empty or ctx
+// ends.
+func (d *Dispatcher) Drain(ctx context.Context) error {
+	d.lifetime.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.stop)
+	}
+	started := d.started
+	d.lifetime.Unlock()
+
+	if started {
+		<-d.done
+	}
+
+	for {
+		_, err := d.DispatchPending(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("outbox not drained: %w", err)
+		case <-time.After(d.interval):
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package saga runs multi-step operations whose steps each declare how to
+// undo themselves. When a step fails, the steps that already completed are
+// compensated in reverse order. Every run is logged step by step to a
+// SagaRepository so a run interrupted by a crash can be resumed or
+// compensated on the next start.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"time"
+)
+
+// cleanupTimeout bounds compensation and recovery. Both run detached from
+// the caller's context, so a request that timed out or was abandoned still
+// has its completed steps undone.
+const cleanupTimeout = 30 * time.Second
+
+// Step is one unit of work of a saga. Action may change the shared state,
+// which is logged after the step completes.
+type Step[S any] struct {
+	Name   string
+	Action func(ctx context.Context, state *S) error
+	// Compensate undoes Action. It may also be called for a step that was
+	// interrupted half way, so it must cope with there being nothing to undo.
+	// Steps without a compensation have nothing to undo.
+	Compensate func(ctx context.Context, state *S) error
+	// Retryable steps are safe to run again. A saga interrupted before or
+	// during retryable steps only is resumed on recovery rather than
+	// compensated.
+	Retryable bool
+}
+
+// Saga is a named sequence of steps sharing a state of type S, which must
+// survive a JSON round trip.
+type Saga[S any] struct {
+	name  string
+	steps []Step[S]
+	repo  interfaces.SagaRepository
+	now   func() time.Time
+}
+
+func New[S any](name string, repo interfaces.SagaRepository, steps ...Step[S]) *Saga[S] {
+	return &Saga[S]{
+		name:  name,
+		steps: steps,
+		repo:  repo,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+func (s *Saga[S]) Name() string {
+	return s.name
+}
+
+// Run executes every step in order under the given saga ID. If a step fails
+// the completed steps are compensated and the step's error is returned.
+func (s *Saga[S]) Run(ctx context.Context, id string, state *S) error {
+	now := s.now()
+
+	record := &entities.SagaRecord{
+		ID:        id,
+		Name:      s.name,
+		Status:    entities.SagaStatusRunning,
+		Steps:     make([]entities.SagaStepLog, len(s.steps)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for i, step := range s.steps {
+		record.Steps[i] = entities.SagaStepLog{Name: step.Name, Status: entities.SagaStepPending}
+	}
+
+	if err := s.save(ctx, record, state); err != nil {
+		return err
+	}
+
+	return s.runFrom(ctx, record, state, 0)
+}
+
+// Recover picks up a saga left unfinished by a previous process. It resumes
+// the saga when everything left to do is retryable and compensates it
+// otherwise. It only fails when the saga cannot be brought to rest.
+func (s *Saga[S]) Recover(ctx context.Context, record *entities.SagaRecord) error {
+	if record.Name != s.name {
+		return fmt.Errorf("saga %s is a '%s' saga, not '%s'", record.ID, record.Name, s.name)
+	}
+	if len(record.Steps) != len(s.steps) {
+		return fmt.Errorf("saga %s has %d steps logged but '%s' has %d", record.ID, len(record.Steps), s.name, len(s.steps))
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	state := new(S)
+	if len(record.State) > 0 {
+		if err := json.Unmarshal(record.State, state); err != nil {
+			return fmt.Errorf("failed to decode state of saga %s: %w", record.ID, err)
+		}
+	}
+
+	next := 0
+	for next < len(record.Steps) && record.Steps[next].Status == entities.SagaStepCompleted {
+		next++
+	}
+
+	if record.Status == entities.SagaStatusRunning && s.retryableFrom(next) {
+		_ = s.runFrom(ctx, record, state, next)
+	} else {
+		s.compensate(ctx, record, state, fmt.Errorf("saga %s was interrupted", record.ID))
+	}
+
+	if record.Status == entities.SagaStatusFailed {
+		return fmt.Errorf("saga %s could not be fully compensated", record.ID)
+	}
+
+	return nil
+}
+
+func (s *Saga[S]) retryableFrom(index int) bool {
+	for _, step := range s.steps[index:] {
+		if !step.Retryable {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Saga[S]) runFrom(ctx context.Context, record *entities.SagaRecord, state *S, index int) error {
+	for i := index; i < len(s.steps); i++ {
+		step := s.steps[i]
+		log := &record.Steps[i]
+
+		startedAt := s.now()
+		log.Status = entities.SagaStepRunning
+		log.Attempts++
+		log.StartedAt = &startedAt
+		log.Error = ""
+
+		if err := s.save(ctx, record, nil); err != nil {
+			log.Status = entities.SagaStepPending
+			s.compensate(ctx, record, state, err)
+			return err
+		}
+
+		err := step.Action(ctx, state)
+
+		finishedAt := s.now()
+		log.FinishedAt = &finishedAt
+
+		if err != nil {
+			log.Status = entities.SagaStepFailed
+			log.Error = err.Error()
+			s.compensate(ctx, record, state, err)
+			return err
+		}
+
+		log.Status = entities.SagaStepCompleted
+		if err := s.save(ctx, record, state); err != nil {
+			s.compensate(ctx, record, state, err)
+			return err
+		}
+	}
+
+	record.Status = entities.SagaStatusCompleted
+	_ = s.save(ctx, record, state)
+
+	return nil
+}
+
+// compensate undoes, in reverse order, every step that completed or was
+// interrupted while running. A failed compensation does not stop the others;
+// it leaves the saga failed for someone to look at. cause is logged as the
+// reason the saga was rolled back.
+func (s *Saga[S]) compensate(ctx context.Context, record *entities.SagaRecord, state *S, cause error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	record.Status = entities.SagaStatusCompensating
+	record.Error = cause.Error()
+	_ = s.save(ctx, record, nil)
+
+	failed := false
+
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		log := &record.Steps[i]
+
+		switch log.Status {
+		case entities.SagaStepCompleted, entities.SagaStepRunning, entities.SagaStepCompensationFailed:
+		default:
+			continue
+		}
+
+		if step.Compensate != nil {
+			if err := step.Compensate(ctx, state); err != nil {
+				log.Status = entities.SagaStepCompensationFailed
+				log.Error = err.Error()
+				failed = true
+				_ = s.save(ctx, record, nil)
+				continue
+			}
+		}
+
+		log.Status = entities.SagaStepCompensated
+		_ = s.save(ctx, record, nil)
+	}
+
+	record.Status = entities.SagaStatusCompensated
+	if failed {
+		record.Status = entities.SagaStatusFailed
+	}
+	_ = s.save(ctx, record, nil)
+}
+
+// save writes the record, refreshing the logged state when one is given.
+func (s *Saga[S]) save(ctx context.Context, record *entities.SagaRecord, state *S) error {
+	if state != nil {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("failed to encode state of saga %s: %w", record.ID, err)
+		}
+		record.State = data
+	}
+
+	record.UpdatedAt = s.now()
+
+	if err := s.repo.Save(ctx, record); err != nil {
+		return fmt.Errorf("failed to log saga %s: %w", record.ID, err)
+	}
+
+	return nil
+}
+
+// Recoverable is a saga that can pick up its own unfinished runs.
+type Recoverable interface {
+	Name() string
+	Recover(ctx context.Context, record *entities.SagaRecord) error
+}
+
+// RecoverAll hands every unfinished saga in repo to the saga that logged
+// it. It returns how many were recovered and the first error met, after
+// trying all of them.
+func RecoverAll(ctx context.Context, repo interfaces.SagaRepository, sagas ...Recoverable) (int, error) {
+	records, err := repo.ListUnfinished(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list unfinished sagas: %w", err)
+	}
+
+	byName := make(map[string]Recoverable, len(sagas))
+	for _, saga := range sagas {
+		byName[saga.Name()] = saga
+	}
+
+	var firstErr error
+	recovered := 0
+
+	for _, record := range records {
+		saga, known := byName[record.Name]
+		if !known {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("no saga registered for '%s' to recover %s", record.Name, record.ID)
+			}
+			continue
+		}
+
+		if err := saga.Recover(ctx, record); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		recovered++
+	}
+
+	return recovered, firstErr
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"slices"
+	"strings"
+	"time"
+)
+
+type APIKeyService struct {
+	repo  interfaces.APIKeyRepository
+	audit interfaces.APIKeyAuditRepository
+}
+
+func NewAPIKeyService(repo interfaces.APIKeyRepository, audit interfaces.APIKeyAuditRepository) interfaces.APIKeyService {
+	return &APIKeyService{
+		repo:  repo,
+		audit: audit,
+	}
+}
+
+// Authenticate compares the hash of secret with every stored hash in
+// constant time, without stopping at a match, so response times do not
+// reveal how much of a hash was guessed or where the key is stored.
+func (s *APIKeyService) Authenticate(ctx context.Context, secret string) (*entities.Principal, error) {
+	keys, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	presented, _ := hex.DecodeString(entities.HashAPIKey(secret))
+
+	var match *entities.APIKey
+	for _, key := range keys {
+		stored, err := hex.DecodeString(key.Hash)
+		if err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare(presented, stored) == 1 {
+			match = key
+		}
+	}
+
+	now := time.Now()
+	if match == nil {
+		return nil, errors.ErrInvalidAPIKey
+	}
+	if match.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: key has been revoked", errors.ErrInvalidAPIKey)
+	}
+	if !match.Enabled {
+		return nil, fmt.Errorf("%w: key is disabled", errors.ErrInvalidAPIKey)
+	}
+	if match.IsExpired(now) {
+		return nil, fmt.Errorf("%w: key has expired", errors.ErrInvalidAPIKey)
+	}
+
+	// Last use is informational, so failing to record it must not lock
+	// the caller out.
+	_ = s.repo.Touch(ctx, match.ID, now)
+
+	return &entities.Principal{
+		KeyID:  match.ID,
+		Name:   match.Name,
+		Scopes: match.Scopes,
+		Tier:   match.Tier,
+	}, nil
+}
+
+func (s *APIKeyService) CreateKey(ctx context.Context, req entities.APIKeyRequest) (*entities.APIKey, error) {
+	now := time.Now().UTC()
+	if err := req.Validate(now); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidAPIKeyRequest, err)
+	}
+
+	key, err := s.issue(ctx, strings.TrimSpace(req.Name), dedupe(req.Scopes), req.Tier, req.ExpiresAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.record(ctx, entities.APIKeyActionCreated, key, "scopes: "+strings.Join(key.Scopes, ",")); err != nil {
+		// The secret is not returned, so an unaudited key would be an
+		// enabled key nobody holds.
+		s.switchOff(ctx, key.ID, now)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (s *APIKeyService) ListKeys(ctx context.Context) ([]entities.APIKey, error) {
+	keys, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	redacted := make([]entities.APIKey, 0, len(keys))
+	for _, key := range keys {
+		redacted = append(redacted, key.Redacted())
+	}
+
+	return redacted, nil
+}
+
+// RotateKey issues a replacement with the same name, scopes and tier. The
+// old key keeps working until the grace period ends, or its own expiry if
+// that is sooner, so callers can switch over without downtime.
+func (s *APIKeyService) RotateKey(ctx context.Context, id string, req entities.RotateAPIKeyRequest) (*entities.APIKey, error) {
+	grace, err := req.Grace()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidAPIKeyRequest, err)
+	}
+
+	old, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if !old.IsActive(now) || old.RotatedTo != "" {
+		return nil, fmt.Errorf("%w: %s", errors.ErrAPIKeyInactive, id)
+	}
+
+	replacement, err := s.issue(ctx, old.Name, old.Scopes, old.Tier, nil, now)
+	if err != nil {
+		return nil, err
+	}
+
+	graceEnds := now.Add(grace)
+	_, err = s.repo.Update(ctx, id, func(key *entities.APIKey) error {
+		if !key.IsActive(now) || key.RotatedTo != "" {
+			return fmt.Errorf("%w: %s", errors.ErrAPIKeyInactive, id)
+		}
+		if key.ExpiresAt == nil || graceEnds.Before(*key.ExpiresAt) {
+			key.ExpiresAt = &graceEnds
+		}
+		key.RotatedTo = replacement.ID
+		return nil
+	})
+	if err != nil {
+		// Without the link to the old key the replacement would be an
+		// untracked extra key, so it is switched off again.
+		s.switchOff(ctx, replacement.ID, now)
+		return nil, fmt.Errorf("failed to rotate API key: %w", err)
+	}
+
+	detail := fmt.Sprintf("replaced by %s, old key valid until %s", replacement.ID, graceEnds.Format(time.RFC3339))
+	if err := s.record(ctx, entities.APIKeyActionRotated, old, detail); err != nil {
+		// An unaudited rotation is undone: the old key gets its expiry back
+		// and the replacement is switched off.
+		_, _ = s.repo.Update(ctx, id, func(key *entities.APIKey) error {
+			key.ExpiresAt = old.ExpiresAt
+			key.RotatedTo = ""
+			return nil
+		})
+		s.switchOff(ctx, replacement.ID, now)
+		return nil, err
+	}
+
+	return replacement, nil
+}
+
+// RevokeKey stops the key from working at once. A revocation is never
+// undone for want of an audit entry; instead revoking a revoked key records
+// the entry if an earlier attempt failed to, and does nothing otherwise.
+func (s *APIKeyService) RevokeKey(ctx context.Context, id string) error {
+	key, err := s.repo.Update(ctx, id, func(key *entities.APIKey) error {
+		if key.RevokedAt != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		key.Enabled = false
+		key.RevokedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	audited, err := s.audited(ctx, entities.APIKeyActionRevoked, key.ID)
+	if err != nil || audited {
+		return err
+	}
+	return s.record(ctx, entities.APIKeyActionRevoked, key, "")
+}
+
+func (s *APIKeyService) ListAuditLog(ctx context.Context) ([]entities.APIKeyAuditEntry, error) {
+	entries, err := s.audit.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API key audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+// issue saves a new enabled key with a random secret. The secret is only
+// returned here, in place of the hash.
+func (s *APIKeyService) issue(ctx context.Context, name string, scopes []string, tier string, expiresAt *time.Time, now time.Time) (*entities.APIKey, error) {
+	id, err := newRandomID("key_", 8)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newRandomID("ok_", 32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &entities.APIKey{
+		ID:        id,
+		Name:      name,
+		Hash:      entities.HashAPIKey(secret),
+		Scopes:    slices.Clone(scopes),
+		Tier:      tier,
+		Enabled:   true,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if key.Scopes == nil {
+		key.Scopes = []string{}
+	}
+
+	if err := s.repo.Save(ctx, key); err != nil {
+		return nil, fmt.Errorf("failed to save API key: %w", err)
+	}
+
+	issued := key.Redacted()
+	issued.Secret = secret
+	return &issued, nil
+}
+
+// switchOff revokes a key whose creation could not be completed. It is
+// best effort, as the caller is already failing.
+func (s *APIKeyService) switchOff(ctx context.Context, id string, now time.Time) {
+	_, _ = s.repo.Update(ctx, id, func(key *entities.APIKey) error {
+		key.Enabled = false
+		key.RevokedAt = &now
+		return nil
+	})
+}
+
+// audited reports whether the audit log has an entry for action on the key.
+func (s *APIKeyService) audited(ctx context.Context, action, keyID string) (bool, error) {
+	entries, err := s.audit.List(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to read API key audit log: %w", err)
+	}
+
+	return slices.ContainsFunc(entries, func(entry entities.APIKeyAuditEntry) bool {
+		return entry.Action == action && entry.KeyID == keyID
+	}), nil
+}
+
+func (s *APIKeyService) record(ctx context.Context, action string, key *entities.APIKey, detail string) error {
+	actor := entities.APIKeyIDFromContext(ctx)
+	if actor == "" {
+		actor = entities.SystemActor
+	}
+
+	entry := entities.APIKeyAuditEntry{
+		At:      time.Now().UTC(),
+		Action:  action,
+		KeyID:   key.ID,
+		KeyName: key.Name,
+		Actor:   actor,
+		Detail:  detail,
+	}
+
+	if err := s.audit.Append(ctx, entry); err != nil {
+		return fmt.Errorf("failed to audit API key change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"strings"
+	"time"
+)
+
+// maxCartUpdateAttempts bounds how often an update is prepared again after
+// a concurrent change to the same cart overtook it.
+const maxCartUpdateAttempts = 3
+
+type CartService struct {
+	cartRepo     interfaces.CartRepository
+	productRepo  interfaces.ProductRepository
+	orderService interfaces.OrderService
+	promoService interfaces.PromoService
+	idleTTL      time.Duration
+}
+
+func NewCartService(cartRepo interfaces.CartRepository, productRepo interfaces.ProductRepository, orderService interfaces.OrderService, promoService interfaces.PromoService, idleTTL time.Duration) interfaces.CartService {
+	return &CartService{
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		orderService: orderService,
+		promoService: promoService,
+		idleTTL:      idleTTL,
+	}
+}
+
+func (s *CartService) CreateCart(ctx context.Context) (*entities.PricedCart, error) {
+	cartID, err := newCartID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	cart := &entities.Cart{
+		ID:        cartID,
+		Items:     []entities.OrderItem{},
+		CreatedAt: now,
+	}
+	cart.Touch(now, s.idleTTL)
+
+	if err := s.cartRepo.Save(ctx, cart); err != nil {
+		return nil, fmt.Errorf("failed to save cart: %w", err)
+	}
+
+	return &entities.PricedCart{Cart: cart}, nil
+}
+
+func (s *CartService) GetCart(ctx context.Context, id string) (*entities.PricedCart, error) {
+	cart, err := s.cartRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cart: %w", err)
+	}
+
+	return s.price(ctx, cart)
+}
+
+func (s *CartService) AddItem(ctx context.Context, id string, req entities.CartItemRequest) (*entities.PricedCart, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.productRepo.GetByID(ctx, req.ProductID); err != nil {
+		return nil, fmt.Errorf("%w: product '%s' not exits", errors.ErrInvalidProductID, req.ProductID)
+	}
+
+	return s.update(ctx, id, func(cart *entities.Cart) error {
+		cart.AddItem(entities.OrderItem{ProductID: req.ProductID, Quantity: req.Quantity})
+		return s.checkOrderable(ctx, cart)
+	})
+}
+
+func (s *CartService) UpdateItem(ctx context.Context, id string, req entities.CartItemRequest) (*entities.PricedCart, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.update(ctx, id, func(cart *entities.Cart) error {
+		if err := cart.SetItemQuantity(req.ProductID, req.Quantity); err != nil {
+			return err
+		}
+		return s.checkOrderable(ctx, cart)
+	})
+}
+
+func (s *CartService) RemoveItem(ctx context.Context, id, productID string) (*entities.PricedCart, error) {
+	return s.update(ctx, id, func(cart *entities.Cart) error {
+		return cart.RemoveItem(productID)
+	})
+}
+
+// ApplyCoupon sets the cart's coupon. An unusable code is rejected
+// immediately rather than at checkout.
+func (s *CartService) ApplyCoupon(ctx context.Context, id string, req entities.CartCouponRequest) (*entities.PricedCart, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidPromoCode, err)
+	}
+
+	return s.update(ctx, id, func(cart *entities.Cart) error {
+		cart.CouponCode = strings.TrimSpace(req.CouponCode)
+		return s.checkOrderable(ctx, cart)
+	})
+}
+
+func (s *CartService) RemoveCoupon(ctx context.Context, id string) (*entities.PricedCart, error) {
+	return s.update(ctx, id, func(cart *entities.Cart) error {
+		cart.CouponCode = ""
+		return nil
+	})
+}
+
+// Checkout turns the cart into an order. The cart is claimed by deleting it
+// first so concurrent checkouts cannot place it twice, and restored if the
+// order cannot be placed.
+func (s *CartService) Checkout(ctx context.Context, id string, req entities.CheckoutRequest) (*entities.Order, error) {
+	cart, err := s.cartRepo.Delete(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cart: %w", err)
+	}
+
+	if len(cart.Items) == 0 {
+		s.restore(ctx, cart)
+		return nil, errors.ErrCartEmpty
+	}
+
+	orderRequest := cart.OrderRequest()
+	orderRequest.PaymentToken = req.PaymentToken
+
+	order, err := s.orderService.PlaceOrder(ctx, orderRequest)
+	if err != nil {
+		s.restore(ctx, cart)
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// checkOrderable rejects a cart change that could not be placed as an order,
+// such as a quantity over the limit or an invalid coupon. An empty cart
+// cannot be quoted, so only its coupon is checked.
+func (s *CartService) checkOrderable(ctx context.Context, cart *entities.Cart) error {
+	if len(cart.Items) > 0 {
+		_, err := s.orderService.QuoteOrder(ctx, cart.OrderRequest())
+		return err
+	}
+
+	if cart.CouponCode == "" {
+		return nil
+	}
+
+	isValid, err := s.promoService.ValidatePromoCode(ctx, cart.CouponCode)
+	if err != nil {
+		return fmt.Errorf("failed to validate promo code: %w", err)
+	}
+	if !isValid {
+		return fmt.Errorf("%w: code '%s' is not valid", errors.ErrInvalidPromoCode, cart.CouponCode)
+	}
+
+	return nil
+}
+
+func (s *CartService) restore(ctx context.Context, cart *entities.Cart) {
+	cart.Touch(time.Now().UTC(), s.idleTTL)
+	_ = s.cartRepo.Save(ctx, cart)
+}
+
+// update applies fn to a copy of the cart outside the repository lock, so
+// that quoting the change does not hold up every other cart, and stores the
+// copy only if the cart has not changed since it was read.
+func (s *CartService) update(ctx context.Context, id string, fn func(cart *entities.Cart) error) (*entities.PricedCart, error) {
+	for attempt := 1; ; attempt++ {
+		working, err := s.cartRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update cart: %w", err)
+		}
+
+		if err := fn(working); err != nil {
+			return nil, fmt.Errorf("failed to update cart: %w", err)
+		}
+		working.Touch(time.Now().UTC(), s.idleTTL)
+
+		cart, err := s.cartRepo.Update(ctx, id, func(cart *entities.Cart) error {
+			if cart.Version != working.Version {
+				return errors.ErrCartConflict
+			}
+			*cart = *working
+			return nil
+		})
+		if stderrors.Is(err, errors.ErrCartConflict) && attempt < maxCartUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update cart: %w", err)
+		}
+
+		return s.price(ctx, cart)
+	}
+}
+
+// price attaches live pricing computed the same way as an order quote.
+func (s *CartService) price(ctx context.Context, cart *entities.Cart) (*entities.PricedCart, error) {
+	pricedCart := &entities.PricedCart{Cart: cart}
+
+	if len(cart.Items) == 0 {
+		return pricedCart, nil
+	}
+
+	quote, err := s.orderService.QuoteOrder(ctx, cart.OrderRequest())
+	if err != nil {
+		return nil, fmt.Errorf("failed to price cart: %w", err)
+	}
+
+	pricedCart.Pricing = quote
+	return pricedCart, nil
+}
+
+func newCartID() (string, error) {
+	randomBytes := make([]byte, 12)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate cart ID: %w", err)
+	}
+	return "cart_" + hex.EncodeToString(randomBytes), nil
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"time"
+)
+
+type OrderExportService struct {
+	orderRepo interfaces.OrderRepository
+	location  *time.Location
+}
+
+// NewOrderExportService reads dates in export requests in the store
+// timezone given by location.
+func NewOrderExportService(orderRepo interfaces.OrderRepository, location *time.Location) interfaces.OrderExportService {
+	return &OrderExportService{
+		orderRepo: orderRepo,
+		location:  location,
+	}
+}
+
+func (s *OrderExportService) ExportOrders(ctx context.Context, req entities.OrderExportRequest, emit func(row entities.OrderExportRow) error) error {
+	from, to, err := req.Range(s.location, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInvalidExportRequest, err)
+	}
+
+	return s.orderRepo.ForEachCreatedBetween(ctx, from, to, func(order *entities.Order) error {
+		for _, row := range order.ExportRows() {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
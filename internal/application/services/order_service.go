@@ -2,55 +2,716 @@ package services
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"ooliokartchallenge/internal/application/saga"
 	"ooliokartchallenge/internal/domain/entities"
 	"ooliokartchallenge/internal/domain/errors"
 	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
 	"strings"
+	"sync"
 	"time"
 )
 
+// promoDiscountPercent is the discount granted by any valid promo code.
+const promoDiscountPercent = 10
+
+const placeOrderSagaName = "place_order"
+
 type OrderService struct {
-	productRepo  interfaces.ProductRepository
-	promoService interfaces.PromoService
+	productRepo    interfaces.ProductRepository
+	orderRepo      interfaces.OrderRepository
+	stockRepo      interfaces.StockRepository
+	promoService   interfaces.PromoService
+	quoteSigner    interfaces.QuoteSigner
+	idGenerator    interfaces.OrderIDGenerator
+	sequencer      interfaces.OrderNumberSequencer
+	payments       interfaces.PaymentGateway
+	sagaRepo       interfaces.SagaRepository
+	placeOrderSaga *saga.Saga[placeOrderState]
+	policy         entities.OrderPolicy
+	paymentLocks   orderLocks
+	logger         *logger.Logger
 }
 
-func NewOrderService(productRepo interfaces.ProductRepository, promoService interfaces.PromoService) interfaces.OrderService {
-	return &OrderService{
+func NewOrderService(
+	productRepo interfaces.ProductRepository,
+	orderRepo interfaces.OrderRepository,
+	stockRepo interfaces.StockRepository,
+	promoService interfaces.PromoService,
+	quoteSigner interfaces.QuoteSigner,
+	idGenerator interfaces.OrderIDGenerator,
+	sequencer interfaces.OrderNumberSequencer,
+	payments interfaces.PaymentGateway,
+	sagaRepo interfaces.SagaRepository,
+	policy entities.OrderPolicy,
+	logger *logger.Logger,
+) interfaces.OrderService {
+	service := &OrderService{
 		productRepo:  productRepo,
+		orderRepo:    orderRepo,
+		stockRepo:    stockRepo,
 		promoService: promoService,
+		quoteSigner:  quoteSigner,
+		idGenerator:  idGenerator,
+		sequencer:    sequencer,
+		payments:     payments,
+		sagaRepo:     sagaRepo,
+		policy:       policy,
+		logger:       logger,
 	}
+	service.placeOrderSaga = service.newPlaceOrderSaga()
+
+	return service
+}
+
+// orderPricing is the outcome of validating and pricing an order request,
+// shared by PlaceOrder and QuoteOrder.
+type orderPricing struct {
+	items    []entities.OrderItem
+	products []entities.Product
+	lines    []entities.OrderLine
+	subtotal entities.Money
+	discount entities.Money
+	total    entities.Money
 }
 
 func (s *OrderService) PlaceOrder(ctx context.Context, req entities.OrderRequest) (*entities.Order, error) {
 
+	pricing, err := s.priceOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	orderID, err := s.idGenerator.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate order ID: %w", err)
+	}
+
+	placedAt := time.Now().UTC()
+
+	orderNumber, err := s.sequencer.Next(ctx, placedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign order number: %w", err)
+	}
+
+	order := &entities.Order{
+		ID:        orderID,
+		Number:    orderNumber,
+		Currency:  s.policy.Currency,
+		Subtotal:  pricing.subtotal,
+		Total:     pricing.total,
+		Discounts: pricing.discount,
+		Items:     pricing.items,
+		Products:  pricing.products,
+		Lines:     pricing.lines,
+	}
+	if strings.TrimSpace(req.CouponCode) != "" {
+		order.CouponCode = req.CouponCode
+	}
+
+	if err := order.Reconcile(); err != nil {
+		return nil, err
+	}
+
+	order.Open(entities.ActorFromContext(ctx), placedAt)
+
+	state := &placeOrderState{
+		OrderID:      order.ID,
+		CouponCode:   order.CouponCode,
+		order:        order,
+		paymentToken: req.PaymentToken,
+		placedAt:     placedAt,
+	}
+
+	if err := s.placeOrderSaga.Run(ctx, order.ID, state); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// recordEvents raises events of the given types on the order. They reach
+// the outbox together with the order when it is stored.
+func (s *OrderService) recordEvents(order *entities.Order, at time.Time, eventTypes ...string) error {
+	for _, eventType := range eventTypes {
+		eventID, err := s.idGenerator.NewID()
+		if err != nil {
+			return fmt.Errorf("failed to generate event ID: %w", err)
+		}
+		order.RecordEvent("evt_"+eventID, eventType, at)
+	}
+
+	return nil
+}
+
+// placeOrderState is what the place order saga logs between steps. The
+// order itself is not logged, so a placement interrupted by a restart is
+// always compensated rather than resumed.
+type placeOrderState struct {
+	OrderID         string `json:"orderId"`
+	CouponCode      string `json:"couponCode,omitempty"`
+	AuthorizationID string `json:"authorizationId,omitempty"`
+
+	order        *entities.Order
+	paymentToken string
+	placedAt     time.Time
+}
+
+func (s *OrderService) newPlaceOrderSaga() *saga.Saga[placeOrderState] {
+	return saga.New(placeOrderSagaName, s.sagaRepo,
+		saga.Step[placeOrderState]{
+			Name: "reserve_stock",
+			Action: func(ctx context.Context, state *placeOrderState) error {
+				if err := s.stockRepo.Reserve(ctx, state.OrderID, state.order.Items); err != nil {
+					return fmt.Errorf("failed to reserve stock: %w", err)
+				}
+				return nil
+			},
+			Compensate: func(ctx context.Context, state *placeOrderState) error {
+				return s.stockRepo.Release(ctx, state.OrderID)
+			},
+		},
+		saga.Step[placeOrderState]{
+			Name: "redeem_promo",
+			Action: func(ctx context.Context, state *placeOrderState) error {
+				if state.CouponCode == "" {
+					return nil
+				}
+				return s.promoService.RedeemPromoCode(ctx, state.CouponCode, state.OrderID)
+			},
+			Compensate: func(ctx context.Context, state *placeOrderState) error {
+				if state.CouponCode == "" {
+					return nil
+				}
+				return s.promoService.ReleasePromoCode(ctx, state.CouponCode, state.OrderID)
+			},
+		},
+		saga.Step[placeOrderState]{
+			Name: "authorize_payment",
+			Action: func(ctx context.Context, state *placeOrderState) error {
+				if err := s.authorizePayment(ctx, state.order, state.paymentToken, state.placedAt); err != nil {
+					return err
+				}
+				if state.order.Payment != nil {
+					state.AuthorizationID = state.order.Payment.AuthorizationID
+				}
+				return nil
+			},
+			Compensate: func(ctx context.Context, state *placeOrderState) error {
+				if state.AuthorizationID == "" {
+					return nil
+				}
+
+				paymentCtx, cancel := s.paymentContext(ctx)
+				defer cancel()
+
+				return s.payments.Void(paymentCtx, state.AuthorizationID)
+			},
+		},
+		saga.Step[placeOrderState]{
+			Name: "save_order",
+			Action: func(ctx context.Context, state *placeOrderState) error {
+				eventTypes := []string{entities.OrderEventPlaced}
+				if state.CouponCode != "" {
+					eventTypes = append(eventTypes, entities.OrderEventPromoRedeemed)
+				}
+				if err := s.recordEvents(state.order, state.placedAt, eventTypes...); err != nil {
+					return err
+				}
+
+				if err := s.orderRepo.Save(ctx, state.order); err != nil {
+					return fmt.Errorf("failed to save order: %w", err)
+				}
+				return nil
+			},
+		},
+	)
+}
+
+// RecoverUnfinishedOrders compensates order placements that were cut short
+// by a restart. It returns how many were recovered.
+func (s *OrderService) RecoverUnfinishedOrders(ctx context.Context) (int, error) {
+	return saga.RecoverAll(ctx, s.sagaRepo, s.placeOrderSaga)
+}
+
+// authorizePayment holds the order total on the customer's card and confirms
+// the order once the hold is in place. A payment still waiting on customer
+// authentication leaves the order pending. Orders without a payment token
+// are paid at the counter and stay pending too.
+func (s *OrderService) authorizePayment(ctx context.Context, order *entities.Order, token string, at time.Time) error {
+	if strings.TrimSpace(token) == "" {
+		return nil
+	}
+
+	auth, err := s.authorize(ctx, order, token)
+	if err != nil {
+		return err
+	}
+
+	order.AttachPayment(auth, token)
+	if auth.Status != entities.PaymentStatusAuthorized {
+		return nil
+	}
+
+	if err := order.Transition(entities.OrderStatusConfirmed, entities.ActorFromContext(ctx), "payment authorized", at); err != nil {
+		s.voidPayment(ctx, order)
+		return err
+	}
+
+	return nil
+}
+
+func (s *OrderService) authorize(ctx context.Context, order *entities.Order, token string) (*entities.PaymentAuthorization, error) {
+	paymentCtx, cancel := s.paymentContext(ctx)
+	defer cancel()
+
+	auth, err := s.payments.Authorize(paymentCtx, entities.PaymentRequest{
+		Reference: order.ID,
+		Token:     token,
+		Amount:    order.Total,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize payment: %w", err)
+	}
+
+	return auth, nil
+}
+
+// voidPayment releases the order's authorization after a later step failed.
+// It is best effort: an authorization that is not voided expires at the
+// provider.
+func (s *OrderService) voidPayment(ctx context.Context, order *entities.Order) {
+	if order.Payment == nil {
+		return
+	}
+
+	paymentCtx, cancel := s.paymentContext(ctx)
+	defer cancel()
+
+	_ = s.payments.Void(paymentCtx, order.Payment.AuthorizationID)
+}
+
+// recordDeclinedPayment marks a pending payment as declined so the order
+// shows why it cannot be confirmed and is not voided when cancelled.
+func (s *OrderService) recordDeclinedPayment(ctx context.Context, order *entities.Order) {
+	declined := &entities.PaymentAuthorization{
+		ID:     order.Payment.AuthorizationID,
+		Status: entities.PaymentStatusDeclined,
+	}
+
+	_, _ = s.orderRepo.Update(ctx, order.ID, func(order *entities.Order) error {
+		order.UpdateAuthorization(declined)
+		return nil
+	})
+}
+
+func (s *OrderService) paymentContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.policy.PaymentTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.policy.PaymentTimeout)
+}
+
+// updateWithPayment applies change to a stored order and makes the matching
+// gateway call. The change is tried on a copy first so the gateway is only
+// called for changes the order accepts, and it is only stored once the
+// gateway has agreed. Payment changes to the same order run one at a time,
+// so two refunds cannot both be checked against the same amount paid.
+func (s *OrderService) updateWithPayment(ctx context.Context, id string, change func(order *entities.Order) error, settle func(ctx context.Context, payment *entities.Payment, order *entities.Order) error) (*entities.Order, error) {
+	unlock := s.paymentLocks.lock(id)
+	defer unlock()
+
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := change(order); err != nil {
+		return nil, err
+	}
+
+	if order.Payment != nil {
+		paymentCtx, cancel := s.paymentContext(ctx)
+		defer cancel()
+
+		if err := settle(paymentCtx, order.Payment, order); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.orderRepo.Update(ctx, id, change)
+}
+
+// orderLocks hands out a mutex per order ID, kept only while it is held or
+// waited for.
+type orderLocks struct {
+	mutex sync.Mutex
+	locks map[string]*orderLock
+}
+
+type orderLock struct {
+	sync.Mutex
+	holders int
+}
+
+func (l *orderLocks) lock(id string) (unlock func()) {
+	l.mutex.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*orderLock)
+	}
+	lock, exists := l.locks[id]
+	if !exists {
+		lock = &orderLock{}
+		l.locks[id] = lock
+	}
+	lock.holders++
+	l.mutex.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		l.mutex.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(l.locks, id)
+		}
+		l.mutex.Unlock()
+	}
+}
+
+// QuoteOrder prices a request exactly like PlaceOrder but persists nothing.
+// The returned token lets PlaceOrder honour these prices until it expires.
+func (s *OrderService) QuoteOrder(ctx context.Context, req entities.OrderRequest) (*entities.Quote, error) {
+
+	req.QuoteToken = ""
+
+	pricing, err := s.priceOrder(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	req.Items = pricing.items
+
+	expiresAt := time.Now().UTC().Add(s.policy.QuoteTTL).Truncate(time.Second)
+
+	claims := entities.QuoteClaims{
+		Currency:   s.policy.Currency,
+		CouponCode: req.CouponCode,
+		Discount:   pricing.discount.Amount(),
+		ExpiresAt:  expiresAt.Unix(),
+	}
+	for _, line := range pricing.lines {
+		claims.Lines = append(claims.Lines, entities.QuotedPrice{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice.Amount(),
+		})
+	}
+
+	token, err := s.quoteSigner.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign quote: %w", err)
+	}
+
+	quote := &entities.Quote{
+		Currency:   s.policy.Currency,
+		CouponCode: req.CouponCode,
+		Lines:      pricing.lines,
+		Subtotal:   pricing.subtotal,
+		Discounts:  pricing.discount,
+		Total:      pricing.total,
+		Token:      token,
+		ExpiresAt:  expiresAt,
+	}
+
+	if err := quote.Reconcile(); err != nil {
+		return nil, err
+	}
+
+	return quote, nil
+}
+
+// CancelOrder cancels an unpaid order and gives back its reserved stock and
+// coupon redemption.
+func (s *OrderService) CancelOrder(ctx context.Context, id string, req entities.CancelRequest) (*entities.Order, error) {
+	actor := entities.ActorFromContext(ctx)
+	now := time.Now().UTC()
+
+	cancel := func(order *entities.Order) error {
+		if err := order.Cancel(actor, req.Reason, now); err != nil {
+			return err
+		}
+		return s.recordEvents(order, now, entities.OrderEventStatusChanged, entities.OrderEventCancelled)
+	}
+	void := func(ctx context.Context, payment *entities.Payment, order *entities.Order) error {
+		if payment.Status != entities.PaymentStatusVoided {
+			return nil
+		}
+		return s.payments.Void(ctx, payment.AuthorizationID)
+	}
+
+	order, err := s.updateWithPayment(ctx, id, cancel, void)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
+	}
+
+	// The cancellation is stored and the payment voided by now, so failing
+	// to hand back stock or the promo code must not report it as failed.
+	if err := s.releaseReservations(ctx, order); err != nil {
+		s.logger.WithContext(ctx).Error("Failed to release reservations of cancelled order", "order_id", order.ID, "error", err.Error())
+	}
+
+	return order, nil
+}
+
+// RefundOrder refunds some or all lines of a paid order.
+func (s *OrderService) RefundOrder(ctx context.Context, id string, req entities.RefundRequest) (*entities.Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	actor := entities.ActorFromContext(ctx)
+	now := time.Now().UTC()
+
+	refund := func(order *entities.Order) error {
+		if _, err := order.Refund(req, actor, now); err != nil {
+			return err
+		}
+		return s.recordEvents(order, now, entities.OrderEventStatusChanged)
+	}
+	returnFunds := func(ctx context.Context, payment *entities.Payment, order *entities.Order) error {
+		if payment.Status != entities.PaymentStatusCaptured {
+			return nil
+		}
+		return s.payments.Refund(ctx, payment.AuthorizationID, order.Refunds[len(order.Refunds)-1].Amount)
+	}
+
+	order, err := s.updateWithPayment(ctx, id, refund, returnFunds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund order: %w", err)
+	}
+
+	return order, nil
+}
+
+func (s *OrderService) releaseReservations(ctx context.Context, order *entities.Order) error {
+	if err := s.stockRepo.Release(ctx, order.ID); err != nil {
+		return fmt.Errorf("failed to release stock: %w", err)
+	}
+
+	if order.CouponCode != "" {
+		if err := s.promoService.ReleasePromoCode(ctx, order.CouponCode, order.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *OrderService) priceOrder(ctx context.Context, req entities.OrderRequest) (*orderPricing, error) {
 
 	if err := s.validateOrderRequest(req); err != nil {
 		return nil, err
 	}
 
-	orderProducts, totalAmount, err := s.validateAndCalculateItems(ctx, req.Items)
+	sourceIndexes, err := req.NormalizeItems(s.policy.DuplicateItems)
+	if err != nil {
+		return nil, err
+	}
 
+	var pricing *orderPricing
+	if req.QuoteToken != "" {
+		pricing, err = s.priceFromQuote(ctx, req, sourceIndexes)
+	} else {
+		pricing, err = s.priceFromCatalog(ctx, req, sourceIndexes)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	discountAmount, err := s.applyPromoCodeDiscount(ctx, req.CouponCode, totalAmount)
+	if err := s.checkOrderValue(pricing.total); err != nil {
+		return nil, err
+	}
+
+	return pricing, nil
+}
 
+func (s *OrderService) priceFromCatalog(ctx context.Context, req entities.OrderRequest, sourceIndexes []int) (*orderPricing, error) {
+
+	pricing, err := s.validateAndCalculateItems(ctx, req.Items, sourceIndexes, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	finalTotal := totalAmount - discountAmount
+	discount, err := s.applyPromoCodeDiscount(ctx, req.CouponCode, pricing.subtotal)
+	if err != nil {
+		return nil, err
+	}
 
-	orderID := fmt.Sprintf("order_%d", time.Now().UnixNano())
+	if err := pricing.applyDiscount(discount); err != nil {
+		return nil, err
+	}
 
-	order := &entities.Order{
-		ID:       orderID,
-		Total:    finalTotal,
-		Discounts: discountAmount,
-		Items:    req.Items,
-		Products: orderProducts,
+	return pricing, nil
+}
+
+func (s *OrderService) checkOrderValue(total entities.Money) error {
+	maxValue := s.policy.Limits.MaxOrderValue
+	if !maxValue.IsPositive() {
+		return nil
+	}
+
+	comparison, err := total.Compare(maxValue)
+	if err != nil {
+		return err
+	}
+
+	if comparison > 0 {
+		limitErr := errors.NewValidationError(errors.ErrExceedsLimit)
+		limitErr.Add("total", errors.ViolationExceedsLimit, fmt.Sprintf("order total %s exceeds the maximum order value of %s", total, maxValue))
+		return limitErr
+	}
+
+	return nil
+}
+
+// applyDiscount records the order discount, spreads it over the lines and
+// derives the order total.
+func (p *orderPricing) applyDiscount(discount entities.Money) error {
+	var err error
+
+	p.discount = discount
+	p.total, err = p.subtotal.Sub(discount)
+	if err != nil {
+		return fmt.Errorf("failed to calculate order total: %w", err)
+	}
+
+	if err := entities.AllocateDiscount(p.lines, discount); err != nil {
+		return fmt.Errorf("failed to allocate discount: %w", err)
+	}
+
+	return nil
+}
+
+// priceFromQuote honours the unit prices and discount of a previously issued
+// quote, provided it is authentic, unexpired and for the same request.
+func (s *OrderService) priceFromQuote(ctx context.Context, req entities.OrderRequest, sourceIndexes []int) (*orderPricing, error) {
+
+	claims, err := s.quoteSigner.Verify(req.QuoteToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsExpired(time.Now()) {
+		return nil, errors.ErrQuoteExpired
+	}
+
+	if !claims.Matches(req) || claims.Currency != s.policy.Currency {
+		return nil, errors.ErrQuoteMismatch
+	}
+
+	quotedPrices := make([]entities.Money, len(claims.Lines))
+	for i, line := range claims.Lines {
+		quotedPrices[i] = entities.NewMoney(line.UnitPrice, claims.Currency)
+	}
+
+	pricing, err := s.validateAndCalculateItems(ctx, req.Items, sourceIndexes, quotedPrices)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pricing.applyDiscount(entities.NewMoney(claims.Discount, claims.Currency)); err != nil {
+		return nil, err
+	}
+
+	return pricing, nil
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, id string) (*entities.Order, error) {
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve order: %w", err)
+	}
+
+	return order, nil
+}
+
+func (s *OrderService) TransitionOrder(ctx context.Context, id string, req entities.TransitionRequest) (*entities.Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidOrderStatus, err)
+	}
+
+	// Cancelling and refunding have side effects, so route them through
+	// their dedicated flows.
+	switch req.Status {
+	case entities.OrderStatusCancelled:
+		return s.CancelOrder(ctx, id, entities.CancelRequest{Reason: req.Reason})
+	case entities.OrderStatusRefunded:
+		return s.RefundOrder(ctx, id, entities.RefundRequest{Reason: req.Reason})
+	case entities.OrderStatusConfirmed:
+		return s.confirmOrder(ctx, id, req)
+	}
+
+	actor := entities.ActorFromContext(ctx)
+	now := time.Now().UTC()
+
+	transition := func(order *entities.Order) error {
+		if err := order.Transition(req.Status, actor, req.Reason, now); err != nil {
+			return err
+		}
+		return s.recordEvents(order, now, entities.OrderEventStatusChanged)
+	}
+	capture := func(ctx context.Context, payment *entities.Payment, order *entities.Order) error {
+		if req.Status != entities.OrderStatusPaid {
+			return nil
+		}
+		return s.payments.Capture(ctx, payment.AuthorizationID, payment.Captured)
+	}
+
+	order, err := s.updateWithPayment(ctx, id, transition, capture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transition order: %w", err)
+	}
+
+	return order, nil
+}
+
+// confirmOrder retries a payment that was waiting on customer
+// authentication before confirming the order.
+func (s *OrderService) confirmOrder(ctx context.Context, id string, req entities.TransitionRequest) (*entities.Order, error) {
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm order: %w", err)
+	}
+
+	var auth *entities.PaymentAuthorization
+	if order.Payment != nil && order.Payment.Status == entities.PaymentStatusPending && order.Status.CanTransitionTo(entities.OrderStatusConfirmed) {
+		auth, err = s.authorize(ctx, order, order.Payment.Token)
+		if stderrors.Is(err, errors.ErrPaymentDeclined) {
+			s.recordDeclinedPayment(ctx, order)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	actor := entities.ActorFromContext(ctx)
+	now := time.Now().UTC()
+
+	order, err = s.orderRepo.Update(ctx, id, func(order *entities.Order) error {
+		if auth != nil {
+			order.UpdateAuthorization(auth)
+		}
+		if err := order.Transition(entities.OrderStatusConfirmed, actor, req.Reason, now); err != nil {
+			return err
+		}
+		return s.recordEvents(order, now, entities.OrderEventStatusChanged)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm order: %w", err)
 	}
 
 	return order, nil
@@ -59,7 +720,7 @@ func (s *OrderService) PlaceOrder(ctx context.Context, req entities.OrderRequest
 func (s *OrderService) validateOrderRequest(req entities.OrderRequest) error {
 
 	if err := req.Validate(); err != nil {
-		return fmt.Errorf("%w: %v", errors.ErrInvalidOrderRequest, err)
+		return err
 	}
 
 	if req.CouponCode != "" {
@@ -94,45 +755,90 @@ func (s *OrderService) validateCouponCodeFormat(couponCode string) error {
 	return nil
 }
 
-func (s *OrderService) validateAndCalculateItems(ctx context.Context, items []entities.OrderItem) ([]entities.Product, float64, error) {
+// validateAndCalculateItems looks up every item, enforces the quantity
+// limits and prices it. When unitPrices is given it overrides the catalog
+// price index by index. sourceIndexes maps items back to the request for
+// error reporting.
+func (s *OrderService) validateAndCalculateItems(ctx context.Context, items []entities.OrderItem, sourceIndexes []int, unitPrices []entities.Money) (*orderPricing, error) {
 
-	var orderProducts []entities.Product
+	pricing := &orderPricing{
+		items:    items,
+		subtotal: entities.Zero(s.policy.Currency),
+	}
 
-	var totalAmount float64
+	limits := s.policy.Limits
+	limitErr := errors.NewValidationError(errors.ErrExceedsLimit)
+
+	if limits.MaxLines > 0 && len(items) > limits.MaxLines {
+		limitErr.Add("items", errors.ViolationExceedsLimit, fmt.Sprintf("order may contain at most %d distinct products, got %d", limits.MaxLines, len(items)))
+	}
 
 	for idx, item := range items {
 		product, err := s.productRepo.GetByID(ctx, item.ProductID)
 
 		if err != nil {
-			return nil, 0, fmt.Errorf("%w: item %d not exits", errors.ErrInvalidProductID, idx)
+			return nil, fmt.Errorf("%w: item %d not exits", errors.ErrInvalidProductID, sourceIndexes[idx])
+		}
+
+		if maxQuantity := limits.MaxQuantityFor(*product); maxQuantity > 0 && item.Quantity > maxQuantity {
+			limitErr.AddItem("items", sourceIndexes[idx], "quantity", errors.ViolationExceedsLimit, fmt.Sprintf("quantity %d exceeds the maximum of %d for product '%s'", item.Quantity, maxQuantity, product.ID))
+			continue
+		}
+
+		pricing.products = append(pricing.products, *product)
+
+		unitPrice := product.Price
+		if unitPrices != nil {
+			unitPrice = unitPrices[idx]
+		}
+
+		itemAmount, err := unitPrice.Multiply(int64(item.Quantity))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", sourceIndexes[idx], err)
 		}
 
-		orderProducts = append(orderProducts, *product)
+		pricing.lines = append(pricing.lines, entities.OrderLine{
+			ProductID: product.ID,
+			Product:   *product,
+			Quantity:  item.Quantity,
+			UnitPrice: unitPrice,
+			Subtotal:  itemAmount,
+		})
 
-		itemAmount := product.Price * float64(item.Quantity)
-		totalAmount += itemAmount
+		pricing.subtotal, err = pricing.subtotal.Add(itemAmount)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", sourceIndexes[idx], err)
+		}
+	}
 
+	if limitErr.HasErrors() {
+		return nil, limitErr
 	}
 
-	return orderProducts, totalAmount, nil
+	return pricing, nil
 }
 
-func (s *OrderService) applyPromoCodeDiscount(ctx context.Context, couponCode string, totalAmount float64) (float64, error) {
+func (s *OrderService) applyPromoCodeDiscount(ctx context.Context, couponCode string, totalAmount entities.Money) (entities.Money, error) {
+
+	noDiscount := entities.Zero(totalAmount.Currency())
 
 	if strings.TrimSpace(couponCode) == "" {
-		return 0, nil
+		return noDiscount, nil
 	}
 
 	isValid, err := s.promoService.ValidatePromoCode(ctx, couponCode)
 	if err != nil {
-		return 0, fmt.Errorf("failed to validate promo code: %w", err)
+		return noDiscount, fmt.Errorf("failed to validate promo code: %w", err)
 	}
 
 	if !isValid {
-		return 0, fmt.Errorf("%w: code '%s' is not valid", errors.ErrInvalidPromoCode, couponCode)
+		return noDiscount, fmt.Errorf("%w: code '%s' is not valid", errors.ErrInvalidPromoCode, couponCode)
 	}
 
-	discountAmount := totalAmount * 0.10
+	discountAmount, err := totalAmount.Percent(promoDiscountPercent, s.policy.RoundingMode)
+	if err != nil {
+		return noDiscount, fmt.Errorf("failed to calculate discount: %w", err)
+	}
 
 	return discountAmount, nil
 }
@@ -7,12 +7,14 @@ import (
 )
 
 type PromoService struct {
-	promoRepo interfaces.PromoRepository
+	promoRepo      interfaces.PromoRepository
+	redemptionRepo interfaces.PromoRedemptionRepository
 }
 
-func NewPromoService(promoRepo interfaces.PromoRepository) interfaces.PromoService {
+func NewPromoService(promoRepo interfaces.PromoRepository, redemptionRepo interfaces.PromoRedemptionRepository) interfaces.PromoService {
 	return &PromoService{
-		promoRepo: promoRepo,
+		promoRepo:      promoRepo,
+		redemptionRepo: redemptionRepo,
 	}
 }
 
@@ -32,3 +34,17 @@ func (s *PromoService) ValidatePromoCode(ctx context.Context, code string) (bool
 
 	return exists, nil
 }
+
+func (s *PromoService) RedeemPromoCode(ctx context.Context, code, orderID string) error {
+	if err := s.redemptionRepo.Redeem(ctx, code, orderID); err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	return nil
+}
+
+func (s *PromoService) ReleasePromoCode(ctx context.Context, code, orderID string) error {
+	if err := s.redemptionRepo.Release(ctx, code, orderID); err != nil {
+		return fmt.Errorf("failed to release promo code: %w", err)
+	}
+	return nil
+}
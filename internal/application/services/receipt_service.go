@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+)
+
+type ReceiptService struct {
+	orderRepo interfaces.OrderRepository
+	renderer  interfaces.ReceiptRenderer
+	policy    entities.ReceiptPolicy
+}
+
+func NewReceiptService(orderRepo interfaces.OrderRepository, renderer interfaces.ReceiptRenderer, policy entities.ReceiptPolicy) interfaces.ReceiptService {
+	return &ReceiptService{
+		orderRepo: orderRepo,
+		renderer:  renderer,
+		policy:    policy,
+	}
+}
+
+func (s *ReceiptService) RenderReceipt(ctx context.Context, orderID string, req entities.ReceiptRequest) (*entities.RenderedReceipt, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidReceiptRequest, err)
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve order: %w", err)
+	}
+
+	receipt, err := entities.NewReceipt(order, s.policy.Store, s.policy.Taxes, s.policy.RoundingMode, s.policy.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build receipt: %w", err)
+	}
+
+	paperWidth := req.PaperWidth
+	if paperWidth == 0 {
+		paperWidth = s.policy.PaperWidth
+	}
+
+	rendered, err := s.renderer.Render(receipt, req.Format, paperWidth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render receipt: %w", err)
+	}
+
+	return rendered, nil
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand/v2"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+// WebhookService manages webhook subscriptions and delivers order events to
+// them in the background. Failed deliveries are retried with exponential
+// backoff and jitter, then dead-lettered.
+type WebhookService struct {
+	repo        interfaces.WebhookRepository
+	deadLetters interfaces.WebhookDeadLetterRepository
+	sender      interfaces.WebhookSender
+	policy      entities.WebhookRetryPolicy
+
+	inFlight sync.WaitGroup
+	closing  chan struct{}
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func NewWebhookService(
+	repo interfaces.WebhookRepository,
+	deadLetters interfaces.WebhookDeadLetterRepository,
+	sender interfaces.WebhookSender,
+	policy entities.WebhookRetryPolicy,
+) interfaces.WebhookService {
+	return &WebhookService{
+		repo:        repo,
+		deadLetters: deadLetters,
+		sender:      sender,
+		policy:      policy,
+		closing:     make(chan struct{}),
+	}
+}
+
+func (s *WebhookService) CreateSubscription(ctx context.Context, req entities.WebhookSubscriptionRequest) (*entities.WebhookSubscription, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidWebhook, err)
+	}
+
+	id, err := newRandomID("wh_", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = newRandomID("whsec_", 32); err != nil {
+			return nil, err
+		}
+	}
+
+	subscription := &entities.WebhookSubscription{
+		ID:         id,
+		Owner:      entities.APIKeyIDFromContext(ctx),
+		URL:        req.URL,
+		EventTypes: dedupe(req.EventTypes),
+		Secret:     secret,
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	if err := s.repo.Save(ctx, subscription); err != nil {
+		return nil, fmt.Errorf("failed to save webhook subscription: %w", err)
+	}
+
+	return subscription, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]entities.WebhookSubscription, error) {
+	subscriptions, err := s.repo.List(ctx, entities.APIKeyIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	for i := range subscriptions {
+		subscriptions[i] = subscriptions[i].Redacted()
+	}
+
+	return subscriptions, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, entities.APIKeyIDFromContext(ctx), id)
+}
+
+func (s *WebhookService) ListDeadLetters(ctx context.Context) ([]entities.WebhookDelivery, error) {
+	deliveries, err := s.deadLetters.List(ctx, entities.APIKeyIDFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-lettered deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ReplayDeadLetter takes a delivery off the dead-letter list and starts
+// delivering it again with a fresh set of retries.
+func (s *WebhookService) ReplayDeadLetter(ctx context.Context, id string) (*entities.WebhookDelivery, error) {
+	owner := entities.APIKeyIDFromContext(ctx)
+
+	delivery, err := s.deadLetters.Take(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, err := s.repo.GetByID(ctx, owner, delivery.SubscriptionID)
+	if err != nil {
+		_ = s.deadLetters.Add(ctx, delivery)
+		return nil, err
+	}
+
+	delivery.Attempts = 0
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+	delivery.FailedAt = nil
+
+	replayed := *delivery
+	s.dispatch(subscription, delivery)
+
+	return &replayed, nil
+}
+
+// Publish queues the event for every subscription that wants it. It never
+// blocks on delivery.
+func (s *WebhookService) Publish(ctx context.Context, event entities.OrderEvent) {
+	subscriptions, err := s.repo.ListForEvent(ctx, event.Type)
+	if err != nil {
+		return
+	}
+
+	for i := range subscriptions {
+		id, err := newRandomID("dlv_", 12)
+		if err != nil {
+			continue
+		}
+
+		s.dispatch(&subscriptions[i], &entities.WebhookDelivery{
+			ID:             id,
+			SubscriptionID: subscriptions[i].ID,
+			Owner:          subscriptions[i].Owner,
+			Event:          event,
+			CreatedAt:      time.Now().UTC(),
+		})
+	}
+}
+
+// Close stops waiting between retries, dead-letters whatever has not been
+// delivered by then and waits for deliveries in flight until ctx ends.
+func (s *WebhookService) Close(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries still in flight: %w", ctx.Err())
+	}
+}
+
+func (s *WebhookService) dispatch(subscription *entities.WebhookSubscription, delivery *entities.WebhookDelivery) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		delivery.LastError = "service shut down before delivery"
+		s.deadLetter(delivery)
+		return
+	}
+
+	s.inFlight.Add(1)
+	go func() {
+		defer s.inFlight.Done()
+		s.deliver(subscription, delivery)
+	}()
+}
+
+func (s *WebhookService) deliver(subscription *entities.WebhookSubscription, delivery *entities.WebhookDelivery) {
+	for {
+		delivery.Attempts++
+
+		statusCode, err := s.sender.Send(context.Background(), subscription, delivery)
+		if err == nil {
+			return
+		}
+
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = err.Error()
+
+		if delivery.Attempts >= s.policy.MaxAttempts || !s.wait(s.retryDelay(delivery.Attempts)) {
+			s.deadLetter(delivery)
+			return
+		}
+	}
+}
+
+// retryDelay spreads retries between half and all of the backoff so that
+// receivers coming back up are not hit by every sender at once.
+func (s *WebhookService) retryDelay(attempt int) time.Duration {
+	backoff := s.policy.Backoff(attempt)
+	if backoff <= 1 {
+		return backoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(mathrand.Int64N(int64(backoff-half)))
+}
+
+// wait sleeps for delay and reports false if the service started closing.
+func (s *WebhookService) wait(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.closing:
+		return false
+	}
+}
+
+func (s *WebhookService) deadLetter(delivery *entities.WebhookDelivery) {
+	failedAt := time.Now().UTC()
+	delivery.FailedAt = &failedAt
+	_ = s.deadLetters.Add(context.Background(), delivery)
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func newRandomID(prefix string, size int) (string, error) {
+	randomBytes := make([]byte, size)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	}
+	return prefix + hex.EncodeToString(randomBytes), nil
+}
@@ -1,24 +1,142 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 // Config holds simple configuration for the application
 type Config struct {
-	Port        string
-	APIKey      string
-	CouponFiles []string
+	Port                 string
+	APIKey               string
+	APIKeysFile          string
+	CouponFiles          []string
+	CouponMaxRedemptions int64
+	IdempotencyTTL       time.Duration
+	Currency             string
+	RoundingMode         string
+	DuplicateItems       string
+	MaxItemQty           int64
+	MaxOrderLines        int64
+	MaxOrderValue        string
+	QuoteSecret          string
+	QuoteTTL             time.Duration
+	CartIdleTTL          time.Duration
+	OrderIDScheme        string
+	NodeID               int64
+	StoreTimezone        string
+	PaymentProvider      string
+	PaymentTimeout       time.Duration
+	SagaLogFile          string
+	SagaRetention        time.Duration
+	WebhookTimeout       time.Duration
+	WebhookMaxAttempts   int64
+	WebhookBaseDelay     time.Duration
+	WebhookMaxDelay      time.Duration
+	WebhookDeadLetters   int64
+	OutboxPollInterval   time.Duration
+	OutboxBatchSize      int64
+	EventLogFile         string
+	StoreName            string
+	StoreAddress         string
+	StorePhone           string
+	StoreTaxID           string
+	ReceiptFooter        string
+	TaxRates             string
+	ReceiptPaperWidth    int64
+	ReceiptTemplateDir   string
+	TrustedProxies       string
+	AccessLogHeaders     string
+	AccessLogRedact      string
+	AccessLogBody        bool
+	AccessLogRedactBody  string
+	AccessLogSampleRate  float64
+	CrashReportDir       string
+	RateLimits           string
+	RateLimitKeyTiers    string
+	RateLimitMaxBuckets  int64
+	APIKeyAuditLog       string
+	JWTJWKSFile          string
+	JWTIssuer            string
+	JWTAudience          string
+	JWTClockSkew         time.Duration
+	SigningKeysFile      string
+	SignatureWindow      time.Duration
+	SignatureNonceCache  int64
+	AuthSchemes          string
+	CORSAllowedOrigins   string
+	CORSAllowCredentials bool
+	CORSExposedHeaders   string
 }
 
 // Load creates a new Config with environment variables or defaults
 func Load() *Config {
 	return &Config{
-		Port:   getEnv("PORT", "8080"),
-		APIKey: getEnv("API_KEY", "apitest"),
+		Port:        getEnv("PORT", "8080"),
+		APIKey:      getEnv("API_KEY", "apitest"),
+		APIKeysFile: getEnv("API_KEYS_FILE", ""),
 		CouponFiles: []string{
 			getEnv("COUPON_FILE1", "couponbase1.txt"),
 			getEnv("COUPON_FILE2", "couponbase2.txt"),
 			getEnv("COUPON_FILE3", "couponbase3.txt"),
 		},
+		CouponMaxRedemptions: getInt64Env("COUPON_MAX_REDEMPTIONS", 0),
+		IdempotencyTTL:       getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+		Currency:             getEnv("CURRENCY", "USD"),
+		RoundingMode:         getEnv("ROUNDING_MODE", "half_even"),
+		DuplicateItems:       getEnv("DUPLICATE_ITEM_POLICY", "merge"),
+		MaxItemQty:           getInt64Env("ORDER_MAX_QUANTITY_PER_ITEM", 100),
+		MaxOrderLines:        getInt64Env("ORDER_MAX_LINES", 50),
+		MaxOrderValue:        getEnv("ORDER_MAX_VALUE", "0"),
+		QuoteSecret:          getEnv("QUOTE_SECRET", ""),
+		QuoteTTL:             getDurationEnv("QUOTE_TTL", 15*time.Minute),
+		CartIdleTTL:          getDurationEnv("CART_IDLE_TTL", 30*time.Minute),
+		OrderIDScheme:        getEnv("ORDER_ID_SCHEME", "ulid"),
+		NodeID:               getInt64Env("NODE_ID", 0),
+		StoreTimezone:        getEnv("STORE_TIMEZONE", "UTC"),
+		PaymentProvider:      getEnv("PAYMENT_PROVIDER", "fake"),
+		PaymentTimeout:       getDurationEnv("PAYMENT_TIMEOUT", 10*time.Second),
+		SagaLogFile:          getEnv("SAGA_LOG_FILE", ""),
+		SagaRetention:        getDurationEnv("SAGA_RETENTION", 24*time.Hour),
+		WebhookTimeout:       getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:   getInt64Env("WEBHOOK_MAX_ATTEMPTS", 6),
+		WebhookBaseDelay:     getDurationEnv("WEBHOOK_BASE_DELAY", time.Second),
+		WebhookMaxDelay:      getDurationEnv("WEBHOOK_MAX_DELAY", 5*time.Minute),
+		WebhookDeadLetters:   getInt64Env("WEBHOOK_DEAD_LETTER_LIMIT", 1000),
+		OutboxPollInterval:   getDurationEnv("OUTBOX_POLL_INTERVAL", 200*time.Millisecond),
+		OutboxBatchSize:      getInt64Env("OUTBOX_BATCH_SIZE", 100),
+		EventLogFile:         getEnv("EVENT_LOG_FILE", ""),
+		StoreName:            getEnv("STORE_NAME", "Oolio Kart"),
+		StoreAddress:         getEnv("STORE_ADDRESS", ""),
+		StorePhone:           getEnv("STORE_PHONE", ""),
+		StoreTaxID:           getEnv("STORE_TAX_ID", ""),
+		ReceiptFooter:        getEnv("RECEIPT_FOOTER", "Thank you!"),
+		TaxRates:             getEnv("TAX_RATES", ""),
+		ReceiptPaperWidth:    getInt64Env("RECEIPT_PAPER_WIDTH", 80),
+		ReceiptTemplateDir:   getEnv("RECEIPT_TEMPLATE_DIR", ""),
+		TrustedProxies:       getEnv("TRUSTED_PROXIES", ""),
+		AccessLogHeaders:     getEnv("ACCESS_LOG_HEADERS", "User-Agent,Idempotency-Key"),
+		AccessLogRedact:      getEnv("ACCESS_LOG_REDACT_HEADERS", "api_key,Authorization,Cookie"),
+		AccessLogBody:        getBoolEnv("ACCESS_LOG_BODY", false),
+		AccessLogRedactBody:  getEnv("ACCESS_LOG_REDACT_FIELDS", "couponCode,paymentToken,quoteToken,token,secret"),
+		AccessLogSampleRate:  getFloat64Env("ACCESS_LOG_SAMPLE_RATE", 1),
+		CrashReportDir:       getEnv("CRASH_REPORT_DIR", ""),
+		RateLimits:           getEnv("RATE_LIMITS", ""),
+		RateLimitKeyTiers:    getEnv("RATE_LIMIT_KEY_TIERS", ""),
+		RateLimitMaxBuckets:  getInt64Env("RATE_LIMIT_MAX_BUCKETS", 100000),
+		APIKeyAuditLog:       getEnv("API_KEY_AUDIT_LOG", ""),
+		JWTJWKSFile:          getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:            getEnv("JWT_ISSUER", ""),
+		JWTAudience:          getEnv("JWT_AUDIENCE", ""),
+		JWTClockSkew:         getDurationEnv("JWT_CLOCK_SKEW", time.Minute),
+		SigningKeysFile:      getEnv("SIGNING_KEYS_FILE", ""),
+		SignatureWindow:      getDurationEnv("SIGNATURE_WINDOW", 5*time.Minute),
+		SignatureNonceCache:  getInt64Env("SIGNATURE_NONCE_CACHE", 100000),
+		AuthSchemes:          getEnv("AUTH_SCHEMES", ""),
+		CORSAllowedOrigins:   getEnv("CORS_ALLOWED_ORIGINS", "*"),
+		CORSAllowCredentials: getBoolEnv("CORS_ALLOW_CREDENTIALS", false),
+		CORSExposedHeaders:   getEnv("CORS_EXPOSED_HEADERS", "X-Request-ID,Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy"),
 	}
 }
 
@@ -28,3 +146,39 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+func getInt64Env(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return number
+		}
+	}
+	return defaultValue
+}
+
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if flag, err := strconv.ParseBool(value); err == nil {
+			return flag
+		}
+	}
+	return defaultValue
+}
+
+func getFloat64Env(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	}
+	return defaultValue
+}
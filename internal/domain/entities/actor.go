@@ -0,0 +1,49 @@
+package entities
+
+import "context"
+
+type contextKey string
+
+const (
+	ActorKey     contextKey = "actor"
+	APIKeyIDKey  contextKey = "api_key_id"
+	PrincipalKey contextKey = "principal"
+)
+
+// SystemActor is recorded when a change is not attributable to a caller.
+const SystemActor = "system"
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ActorKey, actor)
+}
+
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(ActorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// WithAPIKeyID records which API key authenticated the request. The ID is
+// derived from the key and safe to store and log.
+func WithAPIKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, APIKeyIDKey, keyID)
+}
+
+func APIKeyIDFromContext(ctx context.Context) string {
+	keyID, _ := ctx.Value(APIKeyIDKey).(string)
+	return keyID
+}
+
+// WithPrincipal records the authenticated caller, along with its key ID.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	ctx = WithAPIKeyID(ctx, principal.KeyID)
+	return context.WithValue(ctx, PrincipalKey, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller, or nil for
+// requests that were not authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(PrincipalKey).(*Principal)
+	return principal
+}
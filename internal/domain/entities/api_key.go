@@ -0,0 +1,188 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeOrdersWrite   = "orders:write"
+	ScopeOrdersAdmin   = "orders:admin"
+	ScopeProductsAdmin = "products:admin"
+	ScopePromosAdmin   = "promos:admin"
+	ScopeWebhooksAdmin = "webhooks:admin"
+	ScopeKeysAdmin     = "keys:admin"
+)
+
+var apiKeyScopes = []string{ScopeOrdersWrite, ScopeOrdersAdmin, ScopeProductsAdmin, ScopePromosAdmin, ScopeWebhooksAdmin, ScopeKeysAdmin}
+
+// AllAPIKeyScopes returns every scope, for keys that may do anything.
+func AllAPIKeyScopes() []string {
+	return slices.Clone(apiKeyScopes)
+}
+
+func IsAPIKeyScope(scope string) bool {
+	return slices.Contains(apiKeyScopes, scope)
+}
+
+// APIKey is a stored API key. Only the SHA-256 hash of the secret is kept,
+// which is enough for high entropy keys that are never chosen by people.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash,omitempty"`
+	Scopes []string `json:"scopes"`
+	// Tier selects the rate limits of the key; empty means standard.
+	Tier      string     `json:"tier,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// LastUsedAt is kept to the minute.
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	// RotatedTo is the key that replaced this one.
+	RotatedTo string `json:"rotatedTo,omitempty"`
+	// Secret is only returned when the key is created or rotated.
+	Secret string `json:"secret,omitempty"`
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash stored for a secret.
+func HashAPIKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func (k *APIKey) Validate() error {
+	if k.ID == "" || k.Name == "" {
+		return fmt.Errorf("API key needs an id and a name")
+	}
+
+	if hash, err := hex.DecodeString(k.Hash); err != nil || len(hash) != sha256.Size {
+		return fmt.Errorf("API key %s needs a hex encoded SHA-256 hash", k.ID)
+	}
+
+	for _, scope := range k.Scopes {
+		if !IsAPIKeyScope(scope) {
+			return fmt.Errorf("API key %s has unknown scope '%s'", k.ID, scope)
+		}
+	}
+
+	return nil
+}
+
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// IsActive reports whether the key is accepted at now.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.Enabled && k.RevokedAt == nil && !k.IsExpired(now)
+}
+
+func (k *APIKey) Clone() *APIKey {
+	clone := *k
+	clone.Scopes = slices.Clone(k.Scopes)
+	clone.ExpiresAt = cloneTime(k.ExpiresAt)
+	clone.LastUsedAt = cloneTime(k.LastUsedAt)
+	clone.RevokedAt = cloneTime(k.RevokedAt)
+	return &clone
+}
+
+// Redacted returns a copy without the hash or secret, for listing.
+func (k *APIKey) Redacted() APIKey {
+	redacted := *k.Clone()
+	redacted.Hash = ""
+	redacted.Secret = ""
+	return redacted
+}
+
+func cloneTime(at *time.Time) *time.Time {
+	if at == nil {
+		return nil
+	}
+	clone := *at
+	return &clone
+}
+
+// Longest overlap allowed when rotating a key.
+const MaxAPIKeyGracePeriod = 30 * 24 * time.Hour
+
+// APIKeyRequest creates a key.
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Tier      string     `json:"tier,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (r *APIKeyRequest) Validate(now time.Time) error {
+	if name := strings.TrimSpace(r.Name); name == "" || len(name) > 100 {
+		return fmt.Errorf("name is required and must be at most 100 characters")
+	}
+
+	for i, scope := range r.Scopes {
+		if !IsAPIKeyScope(scope) {
+			return fmt.Errorf("scopes at index %d: unknown scope '%s'", i, scope)
+		}
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(now) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+
+	return nil
+}
+
+// RotateAPIKeyRequest replaces a key. The old key keeps working for
+// GracePeriod, a Go duration such as "24h"; empty means 24 hours and "0s"
+// stops it at once.
+type RotateAPIKeyRequest struct {
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+func (r *RotateAPIKeyRequest) Grace() (time.Duration, error) {
+	if r.GracePeriod == "" {
+		return 24 * time.Hour, nil
+	}
+
+	grace, err := time.ParseDuration(r.GracePeriod)
+	if err != nil || grace < 0 || grace > MaxAPIKeyGracePeriod {
+		return 0, fmt.Errorf("gracePeriod must be a duration between 0s and %s, got '%s'", MaxAPIKeyGracePeriod, r.GracePeriod)
+	}
+	return grace, nil
+}
+
+// API key audit actions.
+const (
+	APIKeyActionCreated = "created"
+	APIKeyActionRotated = "rotated"
+	APIKeyActionRevoked = "revoked"
+)
+
+// APIKeyAuditEntry records a change to a key and the key that made it.
+type APIKeyAuditEntry struct {
+	At      time.Time `json:"at"`
+	Action  string    `json:"action"`
+	KeyID   string    `json:"keyId"`
+	KeyName string    `json:"keyName"`
+	Actor   string    `json:"actor"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Principal is the authenticated caller of a request. KeyID names the API
+// key, or the subject of a bearer token.
+type Principal struct {
+	KeyID  string
+	Name   string
+	Scopes []string
+	Tier   string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
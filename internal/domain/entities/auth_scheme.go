@@ -0,0 +1,107 @@
+package entities
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Ways a request can authenticate.
+const (
+	// AuthSchemeAPIKey is the api_key header.
+	AuthSchemeAPIKey = "api_key"
+	// AuthSchemeBearer is an Authorization: Bearer JWT.
+	AuthSchemeBearer = "bearer"
+	// AuthSchemeSignature is an HMAC signature made with a shared signing key.
+	AuthSchemeSignature = "signature"
+)
+
+var authSchemes = []string{AuthSchemeAPIKey, AuthSchemeBearer, AuthSchemeSignature}
+
+// DefaultAuthSchemes are accepted on routes the policy does not name.
+var DefaultAuthSchemes = []string{AuthSchemeAPIKey, AuthSchemeBearer}
+
+// AuthSchemePolicy maps a ServeMux pattern such as "POST /order" to the
+// schemes accepted on it. The empty route applies to every other route.
+type AuthSchemePolicy map[string][]string
+
+func (p AuthSchemePolicy) Schemes(route string) []string {
+	if schemes, exists := p[route]; exists {
+		return schemes
+	}
+	if schemes, exists := p[""]; exists {
+		return schemes
+	}
+	return DefaultAuthSchemes
+}
+
+func (p AuthSchemePolicy) Allows(route, scheme string) bool {
+	return slices.Contains(p.Schemes(route), scheme)
+}
+
+// ParseAuthSchemes reads semicolon separated route=scheme,scheme entries
+// such as "*=api_key,bearer; POST /order=signature,api_key". A route of *
+// matches every route not named. An empty value accepts api_key and bearer
+// everywhere.
+func ParseAuthSchemes(value string) (AuthSchemePolicy, error) {
+	policy := AuthSchemePolicy{}
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, list, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("auth schemes '%s' must look like route=scheme,scheme", entry)
+		}
+		route = strings.TrimSpace(route)
+		if route == "*" {
+			route = ""
+		}
+
+		var schemes []string
+		for _, scheme := range strings.Split(list, ",") {
+			scheme = strings.TrimSpace(scheme)
+			if !slices.Contains(authSchemes, scheme) {
+				return nil, fmt.Errorf("auth schemes '%s' has unknown scheme '%s'", entry, scheme)
+			}
+			schemes = append(schemes, scheme)
+		}
+		policy[route] = schemes
+	}
+
+	return policy, nil
+}
+
+// SigningKey is a secret shared with a server-to-server client, which signs
+// its requests with it instead of sending it. Unlike API keys the secret
+// itself has to be stored to check signatures.
+type SigningKey struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Secret string   `json:"secret"`
+	Scopes []string `json:"scopes"`
+	// Tier selects the rate limits of the key; empty means standard.
+	Tier    string `json:"tier,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (k *SigningKey) Validate() error {
+	if k.ID == "" || k.Name == "" {
+		return fmt.Errorf("signing key needs an id and a name")
+	}
+
+	if len(k.Secret) < 32 {
+		return fmt.Errorf("signing key %s needs a secret of at least 32 characters", k.ID)
+	}
+
+	for _, scope := range k.Scopes {
+		if !IsAPIKeyScope(scope) {
+			return fmt.Errorf("signing key %s has unknown scope '%s'", k.ID, scope)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package entities
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
+)
+
+type Cart struct {
+	ID         string      `json:"id"`
+	Items      []OrderItem `json:"items"`
+	CouponCode string      `json:"couponCode,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+	ExpiresAt  time.Time   `json:"expiresAt"`
+	// Version is bumped by every stored change, so an update prepared from
+	// an earlier read can tell it has been overtaken.
+	Version int64 `json:"version"`
+}
+
+// PricedCart is a cart together with its current pricing. Pricing is absent
+// while the cart is empty.
+type PricedCart struct {
+	*Cart
+	Pricing *Quote `json:"pricing,omitempty"`
+}
+
+// Touch records activity on the cart and pushes its idle expiry forward.
+func (c *Cart) Touch(now time.Time, idleTTL time.Duration) {
+	c.UpdatedAt = now
+	c.ExpiresAt = now.Add(idleTTL)
+}
+
+func (c *Cart) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// AddItem adds quantity of a product, merging with an existing line.
+func (c *Cart) AddItem(item OrderItem) {
+	for i := range c.Items {
+		if c.Items[i].ProductID == item.ProductID {
+			c.Items[i].Quantity += item.Quantity
+			return
+		}
+	}
+	c.Items = append(c.Items, item)
+}
+
+// SetItemQuantity replaces the quantity of a product already in the cart.
+func (c *Cart) SetItemQuantity(productID string, quantity int) error {
+	for i := range c.Items {
+		if c.Items[i].ProductID == productID {
+			c.Items[i].Quantity = quantity
+			return nil
+		}
+	}
+	return domainerrors.ErrCartItemNotFound
+}
+
+func (c *Cart) RemoveItem(productID string) error {
+	for i := range c.Items {
+		if c.Items[i].ProductID == productID {
+			c.Items = append(c.Items[:i], c.Items[i+1:]...)
+			return nil
+		}
+	}
+	return domainerrors.ErrCartItemNotFound
+}
+
+// CheckoutRequest carries what placing the cart needs beyond its items.
+type CheckoutRequest struct {
+	// PaymentToken is the card token to authorize. Without it the order is
+	// paid at the counter.
+	PaymentToken string `json:"paymentToken,omitempty"`
+}
+
+func (c *Cart) OrderRequest() OrderRequest {
+	return OrderRequest{
+		CouponCode: c.CouponCode,
+		Items:      append([]OrderItem(nil), c.Items...),
+	}
+}
+
+func (c *Cart) Clone() *Cart {
+	clone := *c
+	clone.Items = append([]OrderItem(nil), c.Items...)
+	return &clone
+}
+
+type CartItemRequest struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+func (cr *CartItemRequest) Validate() error {
+	violations := domainerrors.NewValidationError(domainerrors.ErrInvalidOrderRequest)
+
+	item := OrderItem{ProductID: cr.ProductID, Quantity: cr.Quantity}
+	item.addViolations(violations.Add)
+
+	return violations.OrNil()
+}
+
+type CartCouponRequest struct {
+	CouponCode string `json:"couponCode"`
+}
+
+func (cr *CartCouponRequest) Validate() error {
+	if strings.TrimSpace(cr.CouponCode) == "" {
+		return errors.New("couponCode is required")
+	}
+	return nil
+}
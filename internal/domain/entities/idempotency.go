@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+// IdempotencyRecord remembers the outcome of a request sent with an
+// Idempotency-Key so that retries can be answered with the same response.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+func (r *IdempotencyRecord) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
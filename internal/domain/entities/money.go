@@ -0,0 +1,370 @@
+package entities
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
+)
+
+// DefaultCurrency is used for catalog prices and for amounts decoded from
+// JSON, which carries plain numbers for backwards compatibility.
+const DefaultCurrency = "USD"
+
+// currencyExponents holds the number of minor unit digits per ISO 4217 code.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"CAD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"NZD": 2,
+	"SGD": 2,
+	"USD": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+func CurrencyExponent(currency string) (int, bool) {
+	exponent, ok := currencyExponents[currency]
+	return exponent, ok
+}
+
+// ParseCurrency checks the currency orders are priced in. Catalog prices
+// and amounts decoded from JSON carry no currency of their own and are
+// always DefaultCurrency, so no other currency is accepted yet.
+func ParseCurrency(value string) (string, error) {
+	currency := strings.ToUpper(strings.TrimSpace(value))
+	if _, ok := CurrencyExponent(currency); !ok {
+		return "", fmt.Errorf("unknown currency '%s'", value)
+	}
+	if currency != DefaultCurrency {
+		return "", fmt.Errorf("currency '%s' is not supported, catalog prices are in %s", value, DefaultCurrency)
+	}
+	return currency, nil
+}
+
+type RoundingMode string
+
+const (
+	RoundHalfEven RoundingMode = "half_even"
+	RoundHalfUp   RoundingMode = "half_up"
+	RoundHalfDown RoundingMode = "half_down"
+	RoundUp       RoundingMode = "up"
+	RoundDown     RoundingMode = "down"
+	RoundCeiling  RoundingMode = "ceiling"
+	RoundFloor    RoundingMode = "floor"
+)
+
+func ParseRoundingMode(value string) (RoundingMode, error) {
+	mode := RoundingMode(strings.ToLower(strings.TrimSpace(value)))
+	switch mode {
+	case RoundHalfEven, RoundHalfUp, RoundHalfDown, RoundUp, RoundDown, RoundCeiling, RoundFloor:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode '%s'", value)
+}
+
+// Money is an exact amount held in integer minor units of a currency.
+type Money struct {
+	amount   int64
+	currency string
+}
+
+func NewMoney(minorUnits int64, currency string) Money {
+	return Money{amount: minorUnits, currency: currency}
+}
+
+func Zero(currency string) Money {
+	return Money{currency: currency}
+}
+
+// ParseMoney reads a decimal string such as "999.99" without going through
+// floating point. More fractional digits than the currency allows is an error.
+func ParseMoney(value, currency string) (Money, error) {
+	exponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: unknown currency '%s'", domainerrors.ErrInvalidAmount, currency)
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	fraction = strings.TrimRight(fraction, "0")
+	if whole == "" || len(fraction) > exponent || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: '%s' is not a valid %s amount", domainerrors.ErrInvalidAmount, value, currency)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", exponent-len(fraction))
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: '%s' is out of range", domainerrors.ErrInvalidAmount, value)
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{amount: amount, currency: currency}, nil
+}
+
+// MustParseMoney is ParseMoney for constant amounts known to be valid.
+func MustParseMoney(value, currency string) Money {
+	money, err := ParseMoney(value, currency)
+	if err != nil {
+		panic(err)
+	}
+	return money
+}
+
+func isDigits(value string) bool {
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Amount returns the value in minor units, e.g. cents.
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+func (m Money) Currency() string {
+	return m.currency
+}
+
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.currency != other.currency {
+		return fmt.Errorf("%w: %s and %s", domainerrors.ErrCurrencyMismatch, m.currency, other.currency)
+	}
+	return nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+
+	sum := m.amount + other.amount
+	if (other.amount > 0 && sum < m.amount) || (other.amount < 0 && sum > m.amount) {
+		return Money{}, domainerrors.ErrAmountOverflow
+	}
+
+	return Money{amount: sum, currency: m.currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if other.amount == math.MinInt64 {
+		return Money{}, domainerrors.ErrAmountOverflow
+	}
+	return m.Add(Money{amount: -other.amount, currency: other.currency})
+}
+
+// Compare returns -1, 0 or 1 depending on whether m is less than, equal to or
+// greater than other.
+func (m Money) Compare(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.amount < other.amount:
+		return -1, nil
+	case m.amount > other.amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Multiply scales the amount by a whole quantity.
+func (m Money) Multiply(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, domainerrors.ErrAmountOverflow
+	}
+	return Money{amount: product.Int64(), currency: m.currency}, nil
+}
+
+// MulRatio returns m * numerator / denominator rounded to a whole minor unit.
+func (m Money) MulRatio(numerator, denominator int64, mode RoundingMode) (Money, error) {
+	if denominator == 0 {
+		return Money{}, fmt.Errorf("%w: division by zero", domainerrors.ErrInvalidAmount)
+	}
+
+	scaled := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(numerator))
+	result, err := divideRounded(scaled, big.NewInt(denominator), mode)
+	if err != nil {
+		return Money{}, err
+	}
+
+	if !result.IsInt64() {
+		return Money{}, domainerrors.ErrAmountOverflow
+	}
+	return Money{amount: result.Int64(), currency: m.currency}, nil
+}
+
+// Percent returns the given whole percentage of m.
+func (m Money) Percent(percent int64, mode RoundingMode) (Money, error) {
+	return m.MulRatio(percent, 100, mode)
+}
+
+// Allocate splits m into parts proportional to weights without losing a
+// minor unit: each part is rounded down and the leftover units go to the
+// parts with the largest remainders, earliest first on ties.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	parts := make([]Money, len(weights))
+	for i := range parts {
+		parts[i] = Zero(m.currency)
+	}
+
+	totalWeight := new(big.Int)
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("%w: negative allocation weight", domainerrors.ErrInvalidAmount)
+		}
+		totalWeight.Add(totalWeight, big.NewInt(weight))
+	}
+
+	if totalWeight.Sign() == 0 {
+		if m.amount != 0 {
+			return nil, fmt.Errorf("%w: cannot allocate over zero weights", domainerrors.ErrInvalidAmount)
+		}
+		return parts, nil
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	allocated := int64(0)
+	for i, weight := range weights {
+		share := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(weight))
+		quotient, remainder := new(big.Int).QuoRem(share, totalWeight, new(big.Int))
+		parts[i].amount = quotient.Int64()
+		remainders[i] = remainder.Abs(remainder)
+		allocated += parts[i].amount
+	}
+
+	step := int64(1)
+	if m.amount < 0 {
+		step = -1
+	}
+
+	for leftover := m.amount - allocated; leftover != 0; leftover -= step {
+		largest := -1
+		for i, remainder := range remainders {
+			if largest == -1 || remainder.Cmp(remainders[largest]) > 0 {
+				largest = i
+			}
+		}
+		parts[largest].amount += step
+		remainders[largest] = new(big.Int)
+	}
+
+	return parts, nil
+}
+
+func divideRounded(numerator, denominator *big.Int, mode RoundingMode) (*big.Int, error) {
+	if denominator.Sign() < 0 {
+		numerator = new(big.Int).Neg(numerator)
+		denominator = new(big.Int).Neg(denominator)
+	}
+
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient, nil
+	}
+
+	// quotient is truncated toward zero; decide whether to step away from it.
+	sign := int64(numerator.Sign())
+	twiceRemainder := new(big.Int).Abs(remainder)
+	twiceRemainder.Lsh(twiceRemainder, 1)
+	half := twiceRemainder.Cmp(denominator)
+
+	awayFromZero := false
+	switch mode {
+	case RoundDown:
+	case RoundUp:
+		awayFromZero = true
+	case RoundCeiling:
+		awayFromZero = sign > 0
+	case RoundFloor:
+		awayFromZero = sign < 0
+	case RoundHalfUp:
+		awayFromZero = half >= 0
+	case RoundHalfDown:
+		awayFromZero = half > 0
+	case RoundHalfEven:
+		awayFromZero = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+	default:
+		return nil, fmt.Errorf("unknown rounding mode '%s'", mode)
+	}
+
+	if awayFromZero {
+		quotient.Add(quotient, big.NewInt(sign))
+	}
+	return quotient, nil
+}
+
+// String formats the amount as a plain decimal, e.g. "899.99".
+func (m Money) String() string {
+	exponent, ok := CurrencyExponent(m.currency)
+	if !ok {
+		exponent = 2
+	}
+
+	sign := ""
+	magnitude := new(big.Int).Abs(big.NewInt(m.amount)).String()
+	if m.amount < 0 {
+		sign = "-"
+	}
+
+	if exponent == 0 {
+		return sign + magnitude
+	}
+
+	if len(magnitude) <= exponent {
+		magnitude = strings.Repeat("0", exponent-len(magnitude)+1) + magnitude
+	}
+
+	split := len(magnitude) - exponent
+	return sign + magnitude[:split] + "." + magnitude[split:]
+}
+
+// MarshalJSON writes the amount as a bare JSON number so existing clients
+// keep receiving the same shape they got from float64 fields.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string in DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(bytes.Trim(bytes.TrimSpace(data), `"`))
+
+	parsed, err := ParseMoney(value, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
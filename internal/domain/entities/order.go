@@ -1,17 +1,106 @@
 package entities
 
 import (
-	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
 )
 
 type Order struct {
-	ID       string      `json:"id"`
-	Total    float64     `json:"total"`
-	Discounts float64     `json:"discounts"`
-	Items    []OrderItem `json:"items"`
-	Products []Product   `json:"products"`
+	ID        string      `json:"id"`
+	Number    string      `json:"number"`
+	Status    OrderStatus `json:"status"`
+	Currency  string      `json:"currency"`
+	Subtotal  Money       `json:"subtotal"`
+	Total     Money       `json:"total"`
+	Discounts Money       `json:"discounts"`
+	Items     []OrderItem `json:"items"`
+	Products  []Product   `json:"products"`
+	Lines     []OrderLine `json:"lines"`
+	// CouponCode is the promo code redeemed by this order, if any.
+	CouponCode     string         `json:"couponCode,omitempty"`
+	AmountPaid     Money          `json:"amountPaid"`
+	AmountRefunded Money          `json:"amountRefunded"`
+	Refunds        []Refund       `json:"refunds"`
+	Payment        *Payment       `json:"payment,omitempty"`
+	History        []StatusChange `json:"history"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+
+	// events raised by changes not yet stored, see RecordEvent.
+	events []OrderEvent
+}
+
+// Open puts a freshly built order into the pending status and records the
+// first entry of its timeline.
+func (o *Order) Open(actor string, at time.Time) {
+	o.Status = OrderStatusPending
+	o.AmountPaid = Zero(o.Currency)
+	o.AmountRefunded = Zero(o.Currency)
+	o.Refunds = []Refund{}
+	o.CreatedAt = at
+	o.UpdatedAt = at
+	o.History = append(o.History, StatusChange{
+		To:    OrderStatusPending,
+		Actor: actor,
+		At:    at,
+	})
+}
+
+// Transition moves the order to the given status if the state machine allows
+// it and appends the change to the order history.
+func (o *Order) Transition(to OrderStatus, actor, reason string, at time.Time) error {
+	if !o.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: cannot move order from '%s' to '%s'", domainerrors.ErrInvalidStatusTransition, o.Status, to)
+	}
+
+	if err := o.checkPayment(to); err != nil {
+		return err
+	}
+
+	o.History = append(o.History, StatusChange{
+		From:   o.Status,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		At:     at,
+	})
+	o.Status = to
+	o.UpdatedAt = at
+
+	if to == OrderStatusPaid {
+		o.AmountPaid = o.Total
+	}
+	o.settlePayment(to)
+
+	return nil
+}
+
+// Reconcile guarantees the order totals are exactly the sum of its lines.
+func (o *Order) Reconcile() error {
+	return reconcileLines(o.Lines, o.Subtotal, o.Discounts, o.Total)
+}
+
+// Clone returns a deep copy so callers can't mutate stored orders.
+func (o *Order) Clone() *Order {
+	clone := *o
+	clone.Items = append([]OrderItem(nil), o.Items...)
+	clone.Products = append([]Product(nil), o.Products...)
+	clone.Lines = append([]OrderLine(nil), o.Lines...)
+	clone.History = append([]StatusChange(nil), o.History...)
+	clone.Refunds = make([]Refund, len(o.Refunds))
+	for i, refund := range o.Refunds {
+		clone.Refunds[i] = refund
+		clone.Refunds[i].Lines = append([]RefundLine(nil), refund.Lines...)
+	}
+	if o.Payment != nil {
+		payment := *o.Payment
+		clone.Payment = &payment
+	}
+	clone.events = append([]OrderEvent(nil), o.events...)
+	return &clone
 }
 
 type OrderItem struct {
@@ -19,32 +108,75 @@ type OrderItem struct {
 	Quantity  int    `json:"quantity"`
 }
 
-func (o *OrderItem) Validate() error {
+// addViolations passes each invalid field of the item to add.
+func (o *OrderItem) addViolations(add func(field, code, message string)) {
 	if strings.TrimSpace(o.ProductID) == "" {
-		return errors.New("productId is required")
+		add("productId", domainerrors.ViolationRequired, "productId is required")
 	}
 
 	if o.Quantity <= 0 {
-		return errors.New("quantity must be greater than 0")
+		add("quantity", domainerrors.ViolationNotPositive, "quantity must be greater than 0")
 	}
-	return nil
 }
 
 type OrderRequest struct {
 	CouponCode string      `json:"couponCode,omitempty"`
 	Items      []OrderItem `json:"items"`
+	QuoteToken string      `json:"quoteToken,omitempty"`
+	// PaymentToken is the card token to authorize. Without it the order is
+	// paid at the counter.
+	PaymentToken string `json:"paymentToken,omitempty"`
 }
 
+// NormalizeItems applies the duplicate item policy. Merging keeps the first
+// position of each product and sums its quantities. It returns, for each
+// remaining item, the index it had in the original request. Rejecting
+// reports every repeated item.
+func (or *OrderRequest) NormalizeItems(policy DuplicateItemPolicy) ([]int, error) {
+	firstIndex := make(map[string]int, len(or.Items))
+	normalized := make([]OrderItem, 0, len(or.Items))
+	sourceIndexes := make([]int, 0, len(or.Items))
+	duplicates := domainerrors.NewValidationError(domainerrors.ErrDuplicateItem)
+
+	for i, item := range or.Items {
+		position, seen := firstIndex[item.ProductID]
+		if !seen {
+			firstIndex[item.ProductID] = len(normalized)
+			normalized = append(normalized, item)
+			sourceIndexes = append(sourceIndexes, i)
+			continue
+		}
+
+		if policy != DuplicateItemsMerge {
+			duplicates.AddItem("items", i, "productId", domainerrors.ViolationDuplicate,
+				fmt.Sprintf("productId '%s' is already listed at index %d", item.ProductID, sourceIndexes[position]))
+			continue
+		}
+		normalized[position].Quantity += item.Quantity
+	}
+
+	if err := duplicates.OrNil(); err != nil {
+		return nil, err
+	}
+
+	or.Items = normalized
+	return sourceIndexes, nil
+}
+
+// Validate reports every invalid field of the request, not just the first,
+// as a validation error wrapping ErrInvalidOrderRequest.
 func (or *OrderRequest) Validate() error {
+	violations := domainerrors.NewValidationError(domainerrors.ErrInvalidOrderRequest)
+
 	if len(or.Items) == 0 {
-		return errors.New("items are required")
+		violations.Add("items", domainerrors.ViolationRequired, "items are required")
 	}
 
 	for i, item := range or.Items {
-		if err := item.Validate(); err != nil {
-			return fmt.Errorf("item at index %d: %w", i, err)
-		}
+		item.addViolations(func(field, code, message string) {
+			violations.AddItem("items", i, field, code, message)
+		})
 	}
 
-	return nil
+	return violations.OrNil()
 }
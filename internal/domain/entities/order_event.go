@@ -0,0 +1,72 @@
+package entities
+
+import "time"
+
+// Order event types. Webhook subscriptions and in-process subscribers pick
+// the ones they want.
+const (
+	OrderEventPlaced        = "order.placed"
+	OrderEventStatusChanged = "order.status_changed"
+	OrderEventCancelled     = "order.cancelled"
+	OrderEventPromoRedeemed = "promo.redeemed"
+)
+
+var orderEventTypes = map[string]bool{
+	OrderEventPlaced:        true,
+	OrderEventStatusChanged: true,
+	OrderEventCancelled:     true,
+	OrderEventPromoRedeemed: true,
+}
+
+func IsOrderEventType(eventType string) bool {
+	return orderEventTypes[eventType]
+}
+
+// OrderEvent tells the outside world something happened to an order. Order
+// is a snapshot taken when the event was stored. Events may be delivered
+// more than once, so consumers should dedupe them by ID.
+type OrderEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OrderID    string    `json:"orderId"`
+	Order      *Order    `json:"order"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// RecordEvent queues an event raised by a change to the order. The order
+// repository moves queued events to the outbox in the same write that
+// stores the order, so an event exists if and only if its change does.
+func (o *Order) RecordEvent(id, eventType string, at time.Time) {
+	o.events = append(o.events, OrderEvent{
+		ID:         id,
+		Type:       eventType,
+		OrderID:    o.ID,
+		OccurredAt: at,
+	})
+}
+
+// TakeEvents returns the queued events, each carrying a snapshot of the
+// order as it is now, and empties the queue.
+func (o *Order) TakeEvents() []OrderEvent {
+	if len(o.events) == 0 {
+		return nil
+	}
+
+	events := o.events
+	o.events = nil
+
+	for i := range events {
+		events[i].Order = o.Clone()
+	}
+
+	return events
+}
+
+// OutboxEntry is an event waiting in the outbox until every sink has
+// accepted it.
+type OutboxEntry struct {
+	Event     OrderEvent `json:"event"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"lastError,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const exportDateLayout = "2006-01-02"
+
+// OrderExportRequest selects the orders created between From and To. Each
+// bound is either an RFC 3339 timestamp or a YYYY-MM-DD date in the store
+// timezone; a date as To includes that whole day. To defaults to now.
+type OrderExportRequest struct {
+	From string
+	To   string
+}
+
+// Range resolves the request to a half-open interval [from, to).
+func (r *OrderExportRequest) Range(location *time.Location, now time.Time) (time.Time, time.Time, error) {
+	if r.From == "" {
+		return time.Time{}, time.Time{}, errors.New("from is required")
+	}
+
+	from, err := parseExportBound(r.From, location, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("from: %w", err)
+	}
+
+	to := now
+	if r.To != "" {
+		if to, err = parseExportBound(r.To, location, true); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to: %w", err)
+		}
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+
+	return from, to, nil
+}
+
+func parseExportBound(value string, location *time.Location, endOfDay bool) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+
+	day, err := time.ParseInLocation(exportDateLayout, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is neither a YYYY-MM-DD date nor an RFC 3339 timestamp", value)
+	}
+
+	if endOfDay {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return day, nil
+}
+
+// OrderExportRow is one line of one order, flattened for spreadsheets.
+type OrderExportRow struct {
+	OrderID     string      `json:"orderId"`
+	OrderNumber string      `json:"orderNumber"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	Status      OrderStatus `json:"status"`
+	Currency    string      `json:"currency"`
+	ProductID   string      `json:"productId"`
+	ProductName string      `json:"productName"`
+	Quantity    int         `json:"quantity"`
+	UnitPrice   Money       `json:"unitPrice"`
+	Discount    Money       `json:"discount"`
+	Total       Money       `json:"total"`
+}
+
+// ExportRows flattens an order into one row per line.
+func (o *Order) ExportRows() []OrderExportRow {
+	rows := make([]OrderExportRow, len(o.Lines))
+	for i, line := range o.Lines {
+		rows[i] = OrderExportRow{
+			OrderID:     o.ID,
+			OrderNumber: o.Number,
+			CreatedAt:   o.CreatedAt,
+			Status:      o.Status,
+			Currency:    o.Currency,
+			ProductID:   line.ProductID,
+			ProductName: line.Product.Name,
+			Quantity:    line.Quantity,
+			UnitPrice:   line.UnitPrice,
+			Discount:    line.Discount,
+			Total:       line.Total,
+		}
+	}
+	return rows
+}
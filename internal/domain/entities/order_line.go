@@ -0,0 +1,92 @@
+package entities
+
+import (
+	"fmt"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
+)
+
+// OrderLine is the priced view of a single product in an order, carrying a
+// snapshot of the product as it was when the order was priced.
+type OrderLine struct {
+	ProductID string  `json:"productId"`
+	Product   Product `json:"product"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice Money   `json:"unitPrice"`
+	Subtotal  Money   `json:"subtotal"`
+	Discount  Money   `json:"discount"`
+	Total     Money   `json:"total"`
+
+	RefundedQuantity int   `json:"refundedQuantity"`
+	RefundedAmount   Money `json:"refundedAmount"`
+}
+
+// AllocateDiscount spreads an order level discount over the lines in
+// proportion to their subtotals and fills in each line total.
+func AllocateDiscount(lines []OrderLine, discount Money) error {
+	weights := make([]int64, len(lines))
+	for i, line := range lines {
+		weights[i] = line.Subtotal.Amount()
+	}
+
+	shares, err := discount.Allocate(weights)
+	if err != nil {
+		return err
+	}
+
+	for i := range lines {
+		lines[i].RefundedAmount = Zero(discount.Currency())
+		lines[i].Discount = shares[i]
+		lines[i].Total, err = lines[i].Subtotal.Sub(shares[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reconcileLines checks that every line adds up and that the lines add up to
+// the given totals.
+func reconcileLines(lines []OrderLine, subtotal, discount, total Money) error {
+	lineSubtotals := Zero(subtotal.Currency())
+	lineDiscounts := Zero(subtotal.Currency())
+	lineTotals := Zero(subtotal.Currency())
+
+	for i, line := range lines {
+		expectedSubtotal, err := line.UnitPrice.Multiply(int64(line.Quantity))
+		if err != nil {
+			return err
+		}
+
+		expectedTotal, err := line.Subtotal.Sub(line.Discount)
+		if err != nil {
+			return err
+		}
+
+		if line.Subtotal != expectedSubtotal || line.Total != expectedTotal {
+			return fmt.Errorf("%w: line %d does not add up", domainerrors.ErrOrderReconciliation, i)
+		}
+
+		if lineSubtotals, err = lineSubtotals.Add(line.Subtotal); err != nil {
+			return err
+		}
+		if lineDiscounts, err = lineDiscounts.Add(line.Discount); err != nil {
+			return err
+		}
+		if lineTotals, err = lineTotals.Add(line.Total); err != nil {
+			return err
+		}
+	}
+
+	expectedTotal, err := subtotal.Sub(discount)
+	if err != nil {
+		return err
+	}
+
+	if lineSubtotals != subtotal || lineDiscounts != discount || lineTotals != total || expectedTotal != total {
+		return fmt.Errorf("%w: lines do not add up to order totals", domainerrors.ErrOrderReconciliation)
+	}
+
+	return nil
+}
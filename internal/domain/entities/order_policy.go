@@ -0,0 +1,70 @@
+package entities
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DuplicateItemPolicy decides what happens when a request lists the same
+// product more than once.
+type DuplicateItemPolicy string
+
+const (
+	DuplicateItemsMerge  DuplicateItemPolicy = "merge"
+	DuplicateItemsReject DuplicateItemPolicy = "reject"
+)
+
+func ParseDuplicateItemPolicy(value string) (DuplicateItemPolicy, error) {
+	policy := DuplicateItemPolicy(strings.ToLower(strings.TrimSpace(value)))
+	switch policy {
+	case DuplicateItemsMerge, DuplicateItemsReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown duplicate item policy '%s'", value)
+}
+
+// OrderLimits caps the size of a single order. Zero values disable a limit.
+// A product's own MaxQuantity takes precedence over MaxQuantityPerItem.
+type OrderLimits struct {
+	MaxQuantityPerItem int
+	MaxLines           int
+	MaxOrderValue      Money
+}
+
+// MaxQuantityFor returns the quantity limit that applies to product, or 0
+// when it is unlimited.
+func (l OrderLimits) MaxQuantityFor(product Product) int {
+	if product.MaxQuantity > 0 {
+		return product.MaxQuantity
+	}
+	return l.MaxQuantityPerItem
+}
+
+// OrderPolicy carries the business rules OrderService applies when pricing
+// an order.
+type OrderPolicy struct {
+	Currency     string
+	RoundingMode RoundingMode
+	// DuplicateItems decides whether repeated products are merged or rejected.
+	DuplicateItems DuplicateItemPolicy
+	Limits         OrderLimits
+	// QuoteTTL is how long a quoted price is honoured by PlaceOrder.
+	QuoteTTL time.Duration
+	// PaymentTimeout bounds every call to the payment gateway.
+	PaymentTimeout time.Duration
+}
+
+func DefaultOrderPolicy() OrderPolicy {
+	return OrderPolicy{
+		Currency:       DefaultCurrency,
+		RoundingMode:   RoundHalfEven,
+		DuplicateItems: DuplicateItemsMerge,
+		Limits: OrderLimits{
+			MaxQuantityPerItem: 100,
+			MaxLines:           50,
+		},
+		QuoteTTL:       15 * time.Minute,
+		PaymentTimeout: 10 * time.Second,
+	}
+}
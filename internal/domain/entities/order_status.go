@@ -0,0 +1,78 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusConfirmed OrderStatus = "confirmed"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusPreparing OrderStatus = "preparing"
+	OrderStatusReady     OrderStatus = "ready"
+	OrderStatusCompleted OrderStatus = "completed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
+// orderTransitions lists the statuses each status may legally move to.
+// Statuses without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusPreparing, OrderStatusRefunded},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusRefunded},
+	OrderStatusReady:     {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusCompleted: {OrderStatusRefunded},
+}
+
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusConfirmed, OrderStatusPaid, OrderStatusPreparing,
+		OrderStatusReady, OrderStatusCompleted, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) IsTerminal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChange is a single entry in an order's timeline.
+type StatusChange struct {
+	From   OrderStatus `json:"from,omitempty"`
+	To     OrderStatus `json:"to"`
+	Actor  string      `json:"actor"`
+	Reason string      `json:"reason,omitempty"`
+	At     time.Time   `json:"at"`
+}
+
+type TransitionRequest struct {
+	Status OrderStatus `json:"status"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+func (tr *TransitionRequest) Validate() error {
+	if tr.Status == "" {
+		return fmt.Errorf("status is required")
+	}
+
+	if !tr.Status.IsValid() {
+		return fmt.Errorf("unknown status '%s'", tr.Status)
+	}
+
+	return nil
+}
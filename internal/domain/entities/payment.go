@@ -0,0 +1,108 @@
+package entities
+
+import (
+	"fmt"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
+)
+
+type PaymentStatus string
+
+const (
+	// PaymentStatusPending means the provider is waiting for the customer to
+	// complete an extra authentication step, such as 3DS.
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusDeclined   PaymentStatus = "declined"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusVoided     PaymentStatus = "voided"
+)
+
+// Payment is the order's view of its authorization at the payment provider.
+type Payment struct {
+	AuthorizationID string        `json:"authorizationId"`
+	Status          PaymentStatus `json:"status"`
+	Amount          Money         `json:"amount"`
+	Captured        Money         `json:"captured"`
+	Refunded        Money         `json:"refunded"`
+	// NextAction is where the customer completes a pending authentication.
+	NextAction string `json:"nextAction,omitempty"`
+	// Token is kept so a pending authorization can be retried, but it is
+	// never echoed back to clients.
+	Token string `json:"-"`
+}
+
+// PaymentRequest asks the gateway to hold Amount on the card behind Token.
+// Reference identifies the order, so repeating a request for the same
+// reference returns the existing authorization instead of a new one.
+type PaymentRequest struct {
+	Reference string
+	Token     string
+	Amount    Money
+}
+
+type PaymentAuthorization struct {
+	ID         string
+	Status     PaymentStatus
+	NextAction string
+}
+
+// AttachPayment records the outcome of authorizing the order total.
+func (o *Order) AttachPayment(auth *PaymentAuthorization, token string) {
+	o.Payment = &Payment{
+		AuthorizationID: auth.ID,
+		Status:          auth.Status,
+		Amount:          o.Total,
+		Captured:        Zero(o.Currency),
+		Refunded:        Zero(o.Currency),
+		NextAction:      auth.NextAction,
+		Token:           token,
+	}
+}
+
+// UpdateAuthorization records a retried authorization of a pending payment.
+func (o *Order) UpdateAuthorization(auth *PaymentAuthorization) {
+	if o.Payment == nil {
+		return
+	}
+
+	o.Payment.Status = auth.Status
+	o.Payment.NextAction = auth.NextAction
+}
+
+// checkPayment stops the order from being confirmed or paid while its
+// payment has not been authorized. Orders without a payment are settled
+// outside the gateway, at the counter.
+func (o *Order) checkPayment(to OrderStatus) error {
+	if o.Payment == nil {
+		return nil
+	}
+
+	switch to {
+	case OrderStatusConfirmed, OrderStatusPaid:
+		if o.Payment.Status != PaymentStatusAuthorized {
+			return fmt.Errorf("%w: payment is %s", domainerrors.ErrPaymentNotAuthorized, o.Payment.Status)
+		}
+	}
+
+	return nil
+}
+
+// settlePayment keeps the payment in step with a status change that has
+// just been applied.
+func (o *Order) settlePayment(to OrderStatus) {
+	if o.Payment == nil {
+		return
+	}
+
+	switch to {
+	case OrderStatusPaid:
+		o.Payment.Status = PaymentStatusCaptured
+		o.Payment.Captured = o.Total
+	case OrderStatusCancelled:
+		if o.Payment.Status == PaymentStatusAuthorized || o.Payment.Status == PaymentStatusPending {
+			o.Payment.Status = PaymentStatusVoided
+			o.Payment.NextAction = ""
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package entities
 
 type Product struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	Category string  `json:"category"`
-	Image    Image   `json:"image"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"`
+	Category string `json:"category"`
+	Image    Image  `json:"image"`
+	// MaxQuantity overrides the per-order quantity limit for this product.
+	MaxQuantity int `json:"maxQuantity,omitempty"`
 }
 
 type Image struct {
@@ -0,0 +1,54 @@
+package entities
+
+import "time"
+
+// Quote is the pricing an order would get right now, without placing it.
+type Quote struct {
+	Currency   string      `json:"currency"`
+	CouponCode string      `json:"couponCode,omitempty"`
+	Lines      []OrderLine `json:"lines"`
+	Subtotal   Money       `json:"subtotal"`
+	Discounts  Money       `json:"discounts"`
+	Total      Money       `json:"total"`
+	Token      string      `json:"token"`
+	ExpiresAt  time.Time   `json:"expiresAt"`
+}
+
+// QuoteClaims is the tamper-proof content of a quote token. Amounts are kept
+// in minor units so they survive the round trip exactly.
+type QuoteClaims struct {
+	Currency   string        `json:"cur"`
+	CouponCode string        `json:"cpn,omitempty"`
+	Lines      []QuotedPrice `json:"lines"`
+	Discount   int64         `json:"disc"`
+	ExpiresAt  int64         `json:"exp"`
+}
+
+type QuotedPrice struct {
+	ProductID string `json:"pid"`
+	Quantity  int    `json:"qty"`
+	UnitPrice int64  `json:"unit"`
+}
+
+func (c *QuoteClaims) IsExpired(now time.Time) bool {
+	return now.Unix() >= c.ExpiresAt
+}
+
+func (q *Quote) Reconcile() error {
+	return reconcileLines(q.Lines, q.Subtotal, q.Discounts, q.Total)
+}
+
+// Matches reports whether the claims were issued for exactly this request.
+func (c *QuoteClaims) Matches(req OrderRequest) bool {
+	if c.CouponCode != req.CouponCode || len(c.Lines) != len(req.Items) {
+		return false
+	}
+
+	for i, item := range req.Items {
+		if c.Lines[i].ProductID != item.ProductID || c.Lines[i].Quantity != item.Quantity {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,133 @@
+package entities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit tiers of callers without a tier of their own.
+const (
+	RateLimitTierAnonymous = "anonymous"
+	RateLimitTierStandard  = "standard"
+	// RateLimitTierClientIP limits every request to a protected route by
+	// client IP before it is authenticated.
+	RateLimitTierClientIP = "ip"
+)
+
+// RateLimit is a token bucket holding up to Requests tokens and refilled
+// at Requests per Period, so it allows bursts of Requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Policy formats the limit for the RateLimit-Policy header, e.g. "10;w=60".
+func (l RateLimit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Requests, int64(l.Period.Seconds()))
+}
+
+// RateLimitRule applies Limit to requests of Tier for Route, the ServeMux
+// pattern such as "POST /order". An empty Tier or Route matches any.
+type RateLimitRule struct {
+	Tier  string
+	Route string
+	Limit RateLimit
+}
+
+// RateLimitPolicy picks the rule for a request, preferring one naming both
+// the tier and the route, then the route, then the tier, then neither.
+type RateLimitPolicy struct {
+	Rules []RateLimitRule
+}
+
+func (p RateLimitPolicy) Limit(tier, route string) (RateLimit, bool) {
+	best, bestScore := RateLimit{}, -1
+
+	for _, rule := range p.Rules {
+		if (rule.Tier != "" && rule.Tier != tier) || (rule.Route != "" && rule.Route != route) {
+			continue
+		}
+
+		score := 0
+		if rule.Route != "" {
+			score += 2
+		}
+		if rule.Tier != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rule.Limit, score
+		}
+	}
+
+	return best, bestScore >= 0
+}
+
+// ExactTierLimit is Limit without the rules for every tier, for tiers such
+// as RateLimitTierClientIP that only rules naming them should limit.
+func (p RateLimitPolicy) ExactTierLimit(tier, route string) (RateLimit, bool) {
+	var rules []RateLimitRule
+	for _, rule := range p.Rules {
+		if rule.Tier == tier {
+			rules = append(rules, rule)
+		}
+	}
+	return RateLimitPolicy{Rules: rules}.Limit(tier, route)
+}
+
+// RateLimitDecision is the outcome of taking a token for a request.
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     RateLimit
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, zero when allowed.
+	RetryAfter time.Duration
+}
+
+// ParseRateLimitRules reads semicolon separated [tier:]route=requests/period
+// rules such as "*=600/1m; POST /order=10/1m; premium:POST /order=60/1m".
+// A route of * matches every route. An empty value means no limits.
+func ParseRateLimitRules(value string) ([]RateLimitRule, error) {
+	var rules []RateLimitRule
+
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		target, limit, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("rate limit '%s' must look like [tier:]route=requests/period", entry)
+		}
+
+		var rule RateLimitRule
+		if tier, route, hasTier := strings.Cut(target, ":"); hasTier {
+			rule.Tier, rule.Route = strings.TrimSpace(tier), strings.TrimSpace(route)
+		} else {
+			rule.Route = strings.TrimSpace(target)
+		}
+		if rule.Route == "*" {
+			rule.Route = ""
+		}
+
+		requests, period, found := strings.Cut(strings.TrimSpace(limit), "/")
+		count, err := strconv.Atoi(requests)
+		if !found || err != nil || count <= 0 {
+			return nil, fmt.Errorf("rate limit '%s' needs a positive number of requests", entry)
+		}
+		duration, err := time.ParseDuration(period)
+		if err != nil || duration < time.Second {
+			return nil, fmt.Errorf("rate limit '%s' needs a period of at least 1s", entry)
+		}
+
+		rule.Limit = RateLimit{Requests: count, Period: duration}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
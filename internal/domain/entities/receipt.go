@@ -0,0 +1,210 @@
+package entities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReceiptFormat string
+
+const (
+	ReceiptFormatHTML   ReceiptFormat = "html"
+	ReceiptFormatText   ReceiptFormat = "text"
+	ReceiptFormatESCPOS ReceiptFormat = "escpos"
+)
+
+// Thermal paper widths in millimetres supported by the ESC/POS format.
+const (
+	PaperWidth58mm = 58
+	PaperWidth80mm = 80
+)
+
+// ReceiptRequest picks how a receipt is rendered. PaperWidth only matters
+// for the text and ESC/POS formats; zero means the configured default.
+type ReceiptRequest struct {
+	Format     ReceiptFormat
+	PaperWidth int
+}
+
+func (r *ReceiptRequest) Validate() error {
+	switch r.Format {
+	case ReceiptFormatHTML, ReceiptFormatText, ReceiptFormatESCPOS:
+	default:
+		return fmt.Errorf("format must be one of html, text or escpos, got '%s'", r.Format)
+	}
+
+	switch r.PaperWidth {
+	case 0, PaperWidth58mm, PaperWidth80mm:
+	default:
+		return fmt.Errorf("paper width must be %d or %d mm, got %d", PaperWidth58mm, PaperWidth80mm, r.PaperWidth)
+	}
+
+	return nil
+}
+
+// StoreDetails is printed at the top and bottom of every receipt.
+type StoreDetails struct {
+	Name    string
+	Address string
+	Phone   string
+	TaxID   string
+	Footer  string
+}
+
+// TaxRate is a tax already included in catalog prices, such as GST or VAT.
+// BasisPoints is the rate in hundredths of a percent.
+type TaxRate struct {
+	Name        string
+	BasisPoints int64
+}
+
+// Percent formats the rate for display, e.g. "10%" or "8.25%".
+func (t TaxRate) Percent() string {
+	percent := fmt.Sprintf("%d.%02d", t.BasisPoints/100, t.BasisPoints%100)
+	return strings.TrimSuffix(strings.TrimRight(percent, "0"), ".") + "%"
+}
+
+// ParseTaxRates reads a comma separated list of name:percent pairs such as
+// "GST:10" or "State:6.25,City:2". An empty value means no taxes.
+func ParseTaxRates(value string) ([]TaxRate, error) {
+	var rates []TaxRate
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, percent, found := strings.Cut(pair, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("tax rate '%s' must look like name:percent", pair)
+		}
+
+		basisPoints, err := parseBasisPoints(strings.TrimSpace(percent))
+		if err != nil {
+			return nil, fmt.Errorf("tax rate '%s': %w", pair, err)
+		}
+
+		rates = append(rates, TaxRate{Name: name, BasisPoints: basisPoints})
+	}
+
+	return rates, nil
+}
+
+// parseBasisPoints turns a percentage with at most two decimals into
+// hundredths of a percent without going through floating point.
+func parseBasisPoints(percent string) (int64, error) {
+	whole, fraction, _ := strings.Cut(percent, ".")
+	if whole == "" || len(fraction) > 2 || !isDigits(whole) || (fraction != "" && !isDigits(fraction)) {
+		return 0, fmt.Errorf("invalid percentage '%s'", percent)
+	}
+
+	fraction += strings.Repeat("0", 2-len(fraction))
+	basisPoints, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil || basisPoints > 10000 {
+		return 0, fmt.Errorf("invalid percentage '%s'", percent)
+	}
+
+	return basisPoints, nil
+}
+
+// ReceiptPolicy carries what ReceiptService needs besides the order.
+type ReceiptPolicy struct {
+	Store        StoreDetails
+	Taxes        []TaxRate
+	RoundingMode RoundingMode
+	// Location is the store timezone receipts are dated in.
+	Location *time.Location
+	// PaperWidth is used when a request does not ask for one.
+	PaperWidth int
+}
+
+// Receipt is the printable view of an order.
+type Receipt struct {
+	Store          StoreDetails
+	OrderID        string
+	Number         string
+	Status         OrderStatus
+	PlacedAt       time.Time
+	Lines          []ReceiptLine
+	Subtotal       Money
+	CouponCode     string
+	Discounts      Money
+	Taxes          []ReceiptTax
+	Total          Money
+	AmountPaid     Money
+	AmountRefunded Money
+}
+
+type ReceiptLine struct {
+	Name             string
+	Quantity         int
+	UnitPrice        Money
+	Subtotal         Money
+	RefundedQuantity int
+}
+
+// ReceiptTax is the share of the total that is tax at the given rate.
+type ReceiptTax struct {
+	Name   string
+	Rate   string
+	Amount Money
+}
+
+// NewReceipt builds the receipt of an order. Taxes are included in prices,
+// so each one is worked out from the total: with rates r1..rn the share of
+// rate ri is total * ri / (1 + r1 + ... + rn).
+func NewReceipt(order *Order, store StoreDetails, taxes []TaxRate, mode RoundingMode, location *time.Location) (*Receipt, error) {
+	receipt := &Receipt{
+		Store:          store,
+		OrderID:        order.ID,
+		Number:         order.Number,
+		Status:         order.Status,
+		PlacedAt:       order.CreatedAt.In(location),
+		Subtotal:       order.Subtotal,
+		CouponCode:     order.CouponCode,
+		Discounts:      order.Discounts,
+		Total:          order.Total,
+		AmountPaid:     order.AmountPaid,
+		AmountRefunded: order.AmountRefunded,
+	}
+
+	for _, line := range order.Lines {
+		receipt.Lines = append(receipt.Lines, ReceiptLine{
+			Name:             line.Product.Name,
+			Quantity:         line.Quantity,
+			UnitPrice:        line.UnitPrice,
+			Subtotal:         line.Subtotal,
+			RefundedQuantity: line.RefundedQuantity,
+		})
+	}
+
+	var totalBasisPoints int64
+	for _, tax := range taxes {
+		totalBasisPoints += tax.BasisPoints
+	}
+
+	for _, tax := range taxes {
+		amount, err := order.Total.MulRatio(tax.BasisPoints, 10000+totalBasisPoints, mode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate %s: %w", tax.Name, err)
+		}
+
+		receipt.Taxes = append(receipt.Taxes, ReceiptTax{
+			Name:   tax.Name,
+			Rate:   tax.Percent(),
+			Amount: amount,
+		})
+	}
+
+	return receipt, nil
+}
+
+// RenderedReceipt is a receipt ready to be sent to a browser or printer.
+type RenderedReceipt struct {
+	ContentType string
+	Body        []byte
+}
@@ -0,0 +1,210 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	domainerrors "ooliokartchallenge/internal/domain/errors"
+)
+
+type Refund struct {
+	ID     string       `json:"id"`
+	Amount Money        `json:"amount"`
+	Lines  []RefundLine `json:"lines"`
+	Reason string       `json:"reason,omitempty"`
+	Actor  string       `json:"actor"`
+	At     time.Time    `json:"at"`
+}
+
+type RefundLine struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	Amount    Money  `json:"amount"`
+}
+
+// RefundRequest asks for some quantity of some lines back. Without lines
+// everything not yet refunded is returned.
+type RefundRequest struct {
+	Lines  []RefundLineRequest `json:"lines,omitempty"`
+	Reason string              `json:"reason,omitempty"`
+}
+
+type RefundLineRequest struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Validate reports every invalid line as a validation error wrapping
+// ErrInvalidRefundRequest.
+func (rr *RefundRequest) Validate() error {
+	violations := domainerrors.NewValidationError(domainerrors.ErrInvalidRefundRequest)
+	firstIndex := make(map[string]int, len(rr.Lines))
+
+	for i, line := range rr.Lines {
+		if strings.TrimSpace(line.ProductID) == "" {
+			violations.AddItem("lines", i, "productId", domainerrors.ViolationRequired, "productId is required")
+		} else if first, seen := firstIndex[line.ProductID]; seen {
+			violations.AddItem("lines", i, "productId", domainerrors.ViolationDuplicate,
+				fmt.Sprintf("productId '%s' is already listed at index %d", line.ProductID, first))
+		} else {
+			firstIndex[line.ProductID] = i
+		}
+
+		if line.Quantity <= 0 {
+			violations.AddItem("lines", i, "quantity", domainerrors.ViolationNotPositive, "quantity must be greater than 0")
+		}
+	}
+
+	return violations.OrNil()
+}
+
+type CancelRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// Cancel moves the order to cancelled. Only orders that have not been paid
+// can be cancelled; paid orders are refunded instead.
+func (o *Order) Cancel(actor, reason string, at time.Time) error {
+	return o.Transition(OrderStatusCancelled, actor, reason, at)
+}
+
+// Refund returns money for the requested lines. Partial quantities are
+// refunded pro rata, rounded down, and the last unit of a line refunds
+// whatever is left of it so a line never refunds more than it cost. Once
+// every line is fully refunded the order moves to refunded.
+func (o *Order) Refund(req RefundRequest, actor string, at time.Time) (*Refund, error) {
+	if !o.Status.CanTransitionTo(OrderStatusRefunded) || !o.AmountPaid.IsPositive() {
+		return nil, fmt.Errorf("%w: order in status '%s' has no payment to refund", domainerrors.ErrOrderNotRefundable, o.Status)
+	}
+
+	requested := req.Lines
+	if len(requested) == 0 {
+		for _, line := range o.Lines {
+			if remaining := line.Quantity - line.RefundedQuantity; remaining > 0 {
+				requested = append(requested, RefundLineRequest{ProductID: line.ProductID, Quantity: remaining})
+			}
+		}
+	}
+
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("%w: nothing left to refund", domainerrors.ErrOrderNotRefundable)
+	}
+
+	refund := &Refund{
+		ID:     fmt.Sprintf("%s-R%d", o.ID, len(o.Refunds)+1),
+		Amount: Zero(o.Currency),
+		Reason: req.Reason,
+		Actor:  actor,
+		At:     at,
+	}
+
+	lines := append([]OrderLine(nil), o.Lines...)
+
+	for _, lineRequest := range requested {
+		index := -1
+		for i := range lines {
+			if lines[i].ProductID == lineRequest.ProductID {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return nil, fmt.Errorf("%w: product '%s' is not part of the order", domainerrors.ErrInvalidRefundRequest, lineRequest.ProductID)
+		}
+
+		line := &lines[index]
+		remaining := line.Quantity - line.RefundedQuantity
+		if lineRequest.Quantity > remaining {
+			return nil, fmt.Errorf("%w: only %d of product '%s' left to refund", domainerrors.ErrRefundExceedsPayment, remaining, line.ProductID)
+		}
+
+		amount, err := line.refundAmount(lineRequest.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		line.RefundedQuantity += lineRequest.Quantity
+		if line.RefundedAmount, err = line.RefundedAmount.Add(amount); err != nil {
+			return nil, err
+		}
+		if refund.Amount, err = refund.Amount.Add(amount); err != nil {
+			return nil, err
+		}
+
+		refund.Lines = append(refund.Lines, RefundLine{
+			ProductID: line.ProductID,
+			Quantity:  lineRequest.Quantity,
+			Amount:    amount,
+		})
+	}
+
+	refunded, err := o.AmountRefunded.Add(refund.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if exceeds, err := refunded.Compare(o.AmountPaid); err != nil {
+		return nil, err
+	} else if exceeds > 0 {
+		return nil, fmt.Errorf("%w: refunds would total %s of %s paid", domainerrors.ErrRefundExceedsPayment, refunded, o.AmountPaid)
+	}
+
+	o.Lines = lines
+	o.AmountRefunded = refunded
+	if o.Payment != nil {
+		if o.Payment.Refunded, err = o.Payment.Refunded.Add(refund.Amount); err != nil {
+			return nil, err
+		}
+	}
+	o.Refunds = append(o.Refunds, *refund)
+
+	if o.fullyRefunded() {
+		if err := o.Transition(OrderStatusRefunded, actor, refundReason(refund), at); err != nil {
+			return nil, err
+		}
+	} else {
+		o.History = append(o.History, StatusChange{
+			From:   o.Status,
+			To:     o.Status,
+			Actor:  actor,
+			Reason: "partial " + refundReason(refund),
+			At:     at,
+		})
+		o.UpdatedAt = at
+	}
+
+	return refund, nil
+}
+
+func (o *Order) fullyRefunded() bool {
+	for _, line := range o.Lines {
+		if line.RefundedQuantity < line.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+func refundReason(refund *Refund) string {
+	reason := fmt.Sprintf("refund %s of %s", refund.ID, refund.Amount)
+	if refund.Reason != "" {
+		reason += ": " + refund.Reason
+	}
+	return reason
+}
+
+// refundAmount prices quantity units of the line at what was actually paid
+// for them, after the line's share of the discount.
+func (l *OrderLine) refundAmount(quantity int) (Money, error) {
+	if quantity == l.Quantity-l.RefundedQuantity {
+		return l.Total.Sub(l.RefundedAmount)
+	}
+
+	if l.Quantity == 0 {
+		return Money{}, errors.New("order line has no quantity")
+	}
+
+	return l.Total.MulRatio(int64(quantity), int64(l.Quantity), RoundDown)
+}
@@ -0,0 +1,70 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type SagaStatus string
+
+const (
+	SagaStatusRunning      SagaStatus = "running"
+	SagaStatusCompleted    SagaStatus = "completed"
+	SagaStatusCompensating SagaStatus = "compensating"
+	SagaStatusCompensated  SagaStatus = "compensated"
+	// SagaStatusFailed means a compensation failed and the saga needs a
+	// person to look at it.
+	SagaStatusFailed SagaStatus = "failed"
+)
+
+type SagaStepStatus string
+
+const (
+	SagaStepPending            SagaStepStatus = "pending"
+	SagaStepRunning            SagaStepStatus = "running"
+	SagaStepCompleted          SagaStepStatus = "completed"
+	SagaStepFailed             SagaStepStatus = "failed"
+	SagaStepCompensated        SagaStepStatus = "compensated"
+	SagaStepCompensationFailed SagaStepStatus = "compensation_failed"
+)
+
+// SagaRecord is the durable log of one saga run. State holds the saga's
+// data as of the last completed step so an interrupted run can be picked up
+// after a restart.
+type SagaRecord struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Status    SagaStatus      `json:"status"`
+	Steps     []SagaStepLog   `json:"steps"`
+	State     json.RawMessage `json:"state"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type SagaStepLog struct {
+	Name       string         `json:"name"`
+	Status     SagaStepStatus `json:"status"`
+	Attempts   int            `json:"attempts"`
+	Error      string         `json:"error,omitempty"`
+	StartedAt  *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+}
+
+// IsFinished reports whether the saga has nothing left to run or undo.
+func (r *SagaRecord) IsFinished() bool {
+	switch r.Status {
+	case SagaStatusCompleted, SagaStatusCompensated, SagaStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Clone returns a deep copy so callers can't mutate stored records.
+func (r *SagaRecord) Clone() *SagaRecord {
+	clone := *r
+	clone.Steps = append([]SagaStepLog(nil), r.Steps...)
+	clone.State = append(json.RawMessage(nil), r.State...)
+	return &clone
+}
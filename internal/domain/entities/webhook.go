@@ -0,0 +1,112 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookSubscription sends the chosen order events to URL, signed with
+// Secret. Subscriptions belong to the API key that created them.
+type WebhookSubscription struct {
+	ID         string   `json:"id"`
+	Owner      string   `json:"-"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	// Secret is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	for _, wanted := range s.EventTypes {
+		if wanted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy without the secret, for listing.
+func (s *WebhookSubscription) Redacted() WebhookSubscription {
+	redacted := *s
+	redacted.EventTypes = append([]string(nil), s.EventTypes...)
+	redacted.Secret = ""
+	return redacted
+}
+
+// WebhookSubscriptionRequest creates a subscription. Without a secret one
+// is generated.
+type WebhookSubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+func (r *WebhookSubscriptionRequest) Validate() error {
+	target, err := url.Parse(r.URL)
+	if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	if len(r.EventTypes) == 0 {
+		return errors.New("eventTypes are required")
+	}
+
+	for i, eventType := range r.EventTypes {
+		if !IsOrderEventType(eventType) {
+			return fmt.Errorf("eventTypes at index %d: unknown event type '%s'", i, eventType)
+		}
+	}
+
+	if r.Secret != "" && len(strings.TrimSpace(r.Secret)) < 16 {
+		return errors.New("secret must be at least 16 characters")
+	}
+
+	return nil
+}
+
+// WebhookDelivery is one attempt to hand an event to a subscription,
+// retried until it succeeds or ends up in the dead-letter list.
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscriptionId"`
+	Owner          string     `json:"-"`
+	Event          OrderEvent `json:"event"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	FailedAt       *time.Time `json:"failedAt,omitempty"`
+}
+
+// WebhookRetryPolicy spaces out redeliveries with exponential backoff,
+// capped at MaxDelay, until MaxAttempts have been made.
+type WebhookRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff is the delay before retrying after the given failed attempt,
+// before jitter.
+func (p WebhookRetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func DefaultWebhookRetryPolicy() WebhookRetryPolicy {
+	return WebhookRetryPolicy{
+		MaxAttempts: 6,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Minute,
+	}
+}
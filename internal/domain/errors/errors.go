@@ -4,12 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type APIError struct {
-	Code    int    `json:"code"`
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Code    int          `json:"code"`
+	Type    string       `json:"type"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+	// CorrelationID matches the response to the server logs of the request.
+	CorrelationID string `json:"correlationId,omitempty"`
 }
 
 func (e APIError) Error() string {
@@ -24,10 +29,126 @@ func NewAPIError(code int, message string) APIError {
 	}
 }
 
+// Stable codes of field violations. Clients can rely on them, unlike the
+// messages, which are meant for people.
+const (
+	ViolationRequired     = "required"
+	ViolationNotPositive  = "must_be_positive"
+	ViolationDuplicate    = "duplicate"
+	ViolationExceedsLimit = "exceeds_limit"
+)
+
+// FieldError describes one offending field of a request. Pointer is the
+// RFC 6901 JSON pointer to the value, such as "/items/1/quantity". Index is
+// set when the field belongs to an element of a list, such as an order item.
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Index   *int   `json:"index,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError groups every field violation found in a request under a
+// sentinel error that decides the status code.
+type ValidationError struct {
+	Err    error
+	Fields []FieldError
+}
+
+func NewValidationError(err error) *ValidationError {
+	return &ValidationError{Err: err}
+}
+
+// Add records a violation on a top level field.
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{
+		Pointer: JSONPointer(field),
+		Code:    code,
+		Field:   field,
+		Message: message,
+	})
+}
+
+// AddItem records a violation on a field of the element at index of list.
+func (e *ValidationError) AddItem(list string, index int, field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{
+		Pointer: JSONPointer(list, strconv.Itoa(index), field),
+		Code:    code,
+		Field:   field,
+		Index:   &index,
+		Message: message,
+	})
+}
+
+// JSONPointer joins reference tokens into a JSON pointer, escaping "~" and
+// "/" as RFC 6901 requires.
+func JSONPointer(tokens ...string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return pointer.String()
+}
+
+// OrNil returns e when it holds violations, so validators can return it
+// without a typed nil ending up in an error interface.
+func (e *ValidationError) OrNil() error {
+	if !e.HasErrors() {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Pointer, field.Message))
+	}
+	return fmt.Sprintf("%s: %s", e.Err.Error(), strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 type ErrorResponse struct {
 	Error APIError `json:"error"`
 }
 
+// ProblemDetails is the RFC 7807 form of an APIError, sent as
+// application/problem+json to clients that ask for it. Errors lists every
+// field violation of a rejected request.
+type ProblemDetails struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	CorrelationID string       `json:"correlationId,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+// Problem converts the error for the request at instance. Problems carry no
+// type of their own, so the title is the status text as RFC 7807 asks for
+// "about:blank".
+func (e APIError) Problem(instance string) ProblemDetails {
+	return ProblemDetails{
+		Type:          "about:blank",
+		Title:         http.StatusText(e.Code),
+		Status:        e.Code,
+		Detail:        e.Message,
+		Instance:      instance,
+		CorrelationID: e.CorrelationID,
+		Errors:        e.Details,
+	}
+}
+
 var (
 	// Product errors
 	ErrProductNotFound  = errors.New("product not found")
@@ -38,17 +159,78 @@ var (
 	ErrEmptyOrderItems     = errors.New("order must contain at least one item")
 	ErrInvalidQuantity     = errors.New("quantity must be greater than 0")
 	ErrInvalidProductRef   = errors.New("invalid product reference in order")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrInvalidOrderStatus  = errors.New("invalid order status")
+	ErrOrderReconciliation = errors.New("order totals do not reconcile")
+
+	// Order lifecycle errors
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	ErrOrderNotRefundable      = errors.New("order cannot be refunded")
+	ErrInvalidRefundRequest    = errors.New("invalid refund request")
+	ErrRefundExceedsPayment    = errors.New("refund exceeds amount paid")
+
+	// Payment errors
+	ErrPaymentDeclined      = errors.New("payment declined")
+	ErrPaymentTimeout       = errors.New("payment provider timed out")
+	ErrPaymentNotAuthorized = errors.New("payment has not been authorized")
+	ErrPaymentFailed        = errors.New("payment operation failed")
+
+	// Webhook errors
+	ErrWebhookNotFound       = errors.New("webhook subscription not found")
+	ErrInvalidWebhook        = errors.New("invalid webhook subscription")
+	ErrDeadLetterNotFound    = errors.New("dead-lettered delivery not found")
+	ErrWebhookDeliveryFailed = errors.New("webhook delivery failed")
+
+	// Receipt errors
+	ErrInvalidReceiptRequest = errors.New("invalid receipt request")
+
+	// Export errors
+	ErrInvalidExportRequest = errors.New("invalid export request")
+
+	// Saga errors
+	ErrSagaNotFound = errors.New("saga not found")
+
+	// Inventory errors
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// Cart errors
+	ErrCartNotFound     = errors.New("cart not found")
+	ErrCartItemNotFound = errors.New("item not found in cart")
+	ErrCartEmpty        = errors.New("cart is empty")
+	ErrCartConflict     = errors.New("cart was changed by another request")
+
+	// Quote errors
+	ErrInvalidQuoteToken = errors.New("invalid quote token")
+	ErrQuoteExpired      = errors.New("quote has expired")
+	ErrQuoteMismatch     = errors.New("quote does not match the order request")
+
+	// Money errors
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrAmountOverflow   = errors.New("amount out of range")
 
 	// Promo code errors
-	ErrInvalidPromoCode  = errors.New("invalid promo code")
-	ErrPromoCodeTooShort = errors.New("promo code must be at least 8 characters")
-	ErrPromoCodeTooLong  = errors.New("promo code must be at most 10 characters")
-	ErrPromoCodeNotFound = errors.New("promo code not found in sufficient databases")
+	ErrInvalidPromoCode   = errors.New("invalid promo code")
+	ErrPromoCodeTooShort  = errors.New("promo code must be at least 8 characters")
+	ErrPromoCodeTooLong   = errors.New("promo code must be at most 10 characters")
+	ErrPromoCodeNotFound  = errors.New("promo code not found in sufficient databases")
+	ErrPromoCodeExhausted = errors.New("promo code has reached its redemption limit")
 
 	// Authentication errors
 	ErrUnauthorized  = errors.New("unauthorized")
 	ErrMissingAPIKey = errors.New("missing API key")
 	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrForbidden     = errors.New("API key lacks the required scope")
+	ErrInvalidToken  = errors.New("invalid bearer token")
+
+	// Request signing and per-route scheme errors
+	ErrInvalidSignature     = errors.New("invalid request signature")
+	ErrAuthSchemeNotAllowed = errors.New("authentication scheme not accepted on this route")
+
+	// API key management errors
+	ErrAPIKeyNotFound       = errors.New("API key not found")
+	ErrAPIKeyInactive       = errors.New("API key has been revoked, rotated or has expired")
+	ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
 
 	// Validation errors
 	ErrValidationFailed = errors.New("validation failed")
@@ -57,6 +239,15 @@ var (
 	ErrInvalidJSON      = errors.New("invalid JSON format")
 	ErrDuplicateItem    = errors.New("duplicate item")
 	ErrExceedsLimit     = errors.New("exceeds allowed limit")
+	ErrRequestTooLarge  = errors.New("request body too large")
+
+	// Idempotency errors
+	ErrInvalidIdempotencyKey  = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyReused   = errors.New("idempotency key already used with a different request")
+	ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still being processed")
+
+	// Rate limit errors
+	ErrRateLimited = errors.New("rate limit exceeded")
 
 	// Internal errors
 	ErrInternalServer = errors.New("internal server error")
@@ -71,17 +262,61 @@ func MapErrorToAPIError(err error) APIError {
 		return apiErr
 	}
 
+	apiError := mapSentinelError(err)
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		apiError.Details = validationErr.Fields
+	}
+
+	return apiError
+}
+
+func mapSentinelError(err error) APIError {
 	switch {
 	case errors.Is(err, ErrInvalidProductID):
 		return NewAPIError(http.StatusBadRequest, err.Error())
 
-	case errors.Is(err, ErrProductNotFound):
+	case errors.Is(err, ErrProductNotFound),
+		errors.Is(err, ErrOrderNotFound),
+		errors.Is(err, ErrCartNotFound),
+		errors.Is(err, ErrCartItemNotFound),
+		errors.Is(err, ErrWebhookNotFound),
+		errors.Is(err, ErrAPIKeyNotFound),
+		errors.Is(err, ErrDeadLetterNotFound):
 		return NewAPIError(http.StatusNotFound, err.Error())
 
+	case errors.Is(err, ErrInvalidStatusTransition),
+		errors.Is(err, ErrOrderNotRefundable),
+		errors.Is(err, ErrInsufficientStock),
+		errors.Is(err, ErrIdempotencyKeyReused),
+		errors.Is(err, ErrIdempotencyKeyInFlight),
+		errors.Is(err, ErrAPIKeyInactive),
+		errors.Is(err, ErrCartConflict),
+		errors.Is(err, ErrPaymentNotAuthorized):
+		return NewAPIError(http.StatusConflict, err.Error())
+
+	case errors.Is(err, ErrPaymentDeclined):
+		return NewAPIError(http.StatusPaymentRequired, err.Error())
+
+	case errors.Is(err, ErrPaymentTimeout):
+		return NewAPIError(http.StatusGatewayTimeout, err.Error())
+
+	case errors.Is(err, ErrPaymentFailed):
+		return NewAPIError(http.StatusBadGateway, err.Error())
+
 	case errors.Is(err, ErrInvalidOrderRequest),
 		errors.Is(err, ErrEmptyOrderItems),
 		errors.Is(err, ErrInvalidQuantity),
 		errors.Is(err, ErrInvalidProductRef),
+		errors.Is(err, ErrInvalidOrderStatus),
+		errors.Is(err, ErrInvalidIdempotencyKey),
+		errors.Is(err, ErrCartEmpty),
+		errors.Is(err, ErrInvalidRefundRequest),
+		errors.Is(err, ErrInvalidWebhook),
+		errors.Is(err, ErrInvalidReceiptRequest),
+		errors.Is(err, ErrInvalidExportRequest),
+		errors.Is(err, ErrInvalidAPIKeyRequest),
 		errors.Is(err, ErrInvalidJSON),
 		errors.Is(err, ErrRequiredField),
 		errors.Is(err, ErrInvalidFormat):
@@ -89,20 +324,39 @@ func MapErrorToAPIError(err error) APIError {
 
 	case errors.Is(err, ErrUnauthorized),
 		errors.Is(err, ErrMissingAPIKey),
-		errors.Is(err, ErrInvalidAPIKey):
+		errors.Is(err, ErrInvalidAPIKey),
+		errors.Is(err, ErrInvalidToken),
+		errors.Is(err, ErrInvalidSignature),
+		errors.Is(err, ErrAuthSchemeNotAllowed):
 		return NewAPIError(http.StatusUnauthorized, err.Error())
 
+	case errors.Is(err, ErrForbidden):
+		return NewAPIError(http.StatusForbidden, err.Error())
+
 	case errors.Is(err, ErrInvalidPromoCode),
 		errors.Is(err, ErrPromoCodeTooShort),
 		errors.Is(err, ErrPromoCodeTooLong),
-		errors.Is(err, ErrPromoCodeNotFound):
+		errors.Is(err, ErrPromoCodeNotFound),
+		errors.Is(err, ErrPromoCodeExhausted),
+		errors.Is(err, ErrRefundExceedsPayment),
+		errors.Is(err, ErrInvalidQuoteToken),
+		errors.Is(err, ErrQuoteExpired),
+		errors.Is(err, ErrQuoteMismatch):
 		return NewAPIError(http.StatusUnprocessableEntity, err.Error())
 
 	case errors.Is(err, ErrValidationFailed),
 		errors.Is(err, ErrDuplicateItem),
-		errors.Is(err, ErrExceedsLimit):
+		errors.Is(err, ErrExceedsLimit),
+		errors.Is(err, ErrInvalidAmount),
+		errors.Is(err, ErrAmountOverflow):
 		return NewAPIError(http.StatusBadRequest, err.Error())
 
+	case errors.Is(err, ErrRequestTooLarge):
+		return NewAPIError(http.StatusRequestEntityTooLarge, err.Error())
+
+	case errors.Is(err, ErrRateLimited):
+		return NewAPIError(http.StatusTooManyRequests, err.Error())
+
 	default:
 		return NewAPIError(http.StatusInternalServerError, "internal server error")
 	}
@@ -3,6 +3,7 @@ package interfaces
 import (
 	"context"
 	"ooliokartchallenge/internal/domain/entities"
+	"time"
 )
 
 type ProductRepository interface {
@@ -13,3 +14,125 @@ type ProductRepository interface {
 type PromoRepository interface {
 	ValidateCode(ctx context.Context, code string) (bool, error)
 }
+
+type PromoRedemptionRepository interface {
+	// Redeem records that orderID used code, failing once the code has no
+	// redemptions left.
+	Redeem(ctx context.Context, code, orderID string) error
+	// Release gives back the redemption made by orderID. Releasing an unknown
+	// redemption is a no-op.
+	Release(ctx context.Context, code, orderID string) error
+}
+
+type StockRepository interface {
+	// Reserve holds stock for every item of an order, or for none of them.
+	Reserve(ctx context.Context, orderID string, items []entities.OrderItem) error
+	// Release returns everything reserved for orderID. Releasing twice is a no-op.
+	Release(ctx context.Context, orderID string) error
+}
+
+// OrderRepository stores orders. Save and Update move the events recorded
+// on the order to the outbox in the same write, and fail without storing
+// the order if the outbox does.
+type OrderRepository interface {
+	Save(ctx context.Context, order *entities.Order) error
+	GetByID(ctx context.Context, id string) (*entities.Order, error)
+	// Update applies fn to the stored order atomically and persists the result
+	// only if fn returns nil.
+	Update(ctx context.Context, id string, fn func(order *entities.Order) error) (*entities.Order, error)
+	// ForEachCreatedBetween calls fn with every order created in [from, to),
+	// oldest first, one at a time so callers can stream them. It stops at
+	// the first error fn returns.
+	ForEachCreatedBetween(ctx context.Context, from, to time.Time, fn func(order *entities.Order) error) error
+}
+
+type OutboxRepository interface {
+	// Append adds events to the outbox. Repositories call it while holding
+	// the write that raised the events.
+	Append(ctx context.Context, events []entities.OrderEvent) error
+	// Pending returns up to limit events not yet dispatched, oldest first.
+	Pending(ctx context.Context, limit int) ([]entities.OutboxEntry, error)
+	// MarkDispatched removes an event once every sink has accepted it.
+	MarkDispatched(ctx context.Context, eventID string) error
+	// MarkFailed records a failed dispatch attempt; the event stays pending.
+	MarkFailed(ctx context.Context, eventID string, cause error) error
+}
+
+type IdempotencyRepository interface {
+	// Reserve claims key for a new request. When the key is already held it
+	// returns the existing record and false instead.
+	Reserve(ctx context.Context, key, requestHash string, ttl time.Duration) (*entities.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+type APIKeyRepository interface {
+	// Save creates or replaces the key with the same ID.
+	Save(ctx context.Context, key *entities.APIKey) error
+	GetByID(ctx context.Context, id string) (*entities.APIKey, error)
+	List(ctx context.Context) ([]*entities.APIKey, error)
+	Update(ctx context.Context, id string, fn func(key *entities.APIKey) error) (*entities.APIKey, error)
+	// Touch records that the key was used at the given time.
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+type SigningKeyRepository interface {
+	GetByID(ctx context.Context, id string) (*entities.SigningKey, error)
+}
+
+// NonceStore remembers the nonces of signed requests so each is only
+// accepted once.
+type NonceStore interface {
+	// Claim records nonce until expiresAt and reports false if it was
+	// already recorded and has not expired.
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+type APIKeyAuditRepository interface {
+	Append(ctx context.Context, entry entities.APIKeyAuditEntry) error
+	// List returns every entry, oldest first.
+	List(ctx context.Context) ([]entities.APIKeyAuditEntry, error)
+}
+
+// RateLimitStore keeps token buckets by key. The in-memory store only
+// limits a single instance; a shared store limits across instances.
+type RateLimitStore interface {
+	// Take removes a token from the bucket for key if one is available,
+	// creating a full bucket on first use.
+	Take(ctx context.Context, key string, limit entities.RateLimit, now time.Time) (entities.RateLimitDecision, error)
+}
+
+type CartRepository interface {
+	Save(ctx context.Context, cart *entities.Cart) error
+	GetByID(ctx context.Context, id string) (*entities.Cart, error)
+	// Update runs fn under the repository lock and stores the result with
+	// its version bumped. fn must not block.
+	Update(ctx context.Context, id string, fn func(cart *entities.Cart) error) (*entities.Cart, error)
+	// Delete removes the cart and returns it, failing if it no longer exists.
+	Delete(ctx context.Context, id string) (*entities.Cart, error)
+}
+
+type SagaRepository interface {
+	// Save creates or replaces the record with the same ID.
+	Save(ctx context.Context, record *entities.SagaRecord) error
+	GetByID(ctx context.Context, id string) (*entities.SagaRecord, error)
+	// ListUnfinished returns every saga still running or compensating,
+	// oldest first.
+	ListUnfinished(ctx context.Context) ([]*entities.SagaRecord, error)
+}
+
+type WebhookRepository interface {
+	Save(ctx context.Context, subscription *entities.WebhookSubscription) error
+	GetByID(ctx context.Context, owner, id string) (*entities.WebhookSubscription, error)
+	List(ctx context.Context, owner string) ([]entities.WebhookSubscription, error)
+	// ListForEvent returns the subscriptions of every owner that want eventType.
+	ListForEvent(ctx context.Context, eventType string) ([]entities.WebhookSubscription, error)
+	Delete(ctx context.Context, owner, id string) error
+}
+
+type WebhookDeadLetterRepository interface {
+	Add(ctx context.Context, delivery *entities.WebhookDelivery) error
+	List(ctx context.Context, owner string) ([]entities.WebhookDelivery, error)
+	// Take removes the delivery from the list and returns it.
+	Take(ctx context.Context, owner, id string) (*entities.WebhookDelivery, error)
+}
@@ -3,6 +3,7 @@ package interfaces
 import (
 	"context"
 	"ooliokartchallenge/internal/domain/entities"
+	"time"
 )
 
 type ProductService interface {
@@ -12,8 +13,121 @@ type ProductService interface {
 
 type OrderService interface {
 	PlaceOrder(ctx context.Context, req entities.OrderRequest) (*entities.Order, error)
+	QuoteOrder(ctx context.Context, req entities.OrderRequest) (*entities.Quote, error)
+	GetOrder(ctx context.Context, id string) (*entities.Order, error)
+	TransitionOrder(ctx context.Context, id string, req entities.TransitionRequest) (*entities.Order, error)
+	CancelOrder(ctx context.Context, id string, req entities.CancelRequest) (*entities.Order, error)
+	RefundOrder(ctx context.Context, id string, req entities.RefundRequest) (*entities.Order, error)
+	// RecoverUnfinishedOrders settles order placements interrupted by a
+	// restart and returns how many it recovered.
+	RecoverUnfinishedOrders(ctx context.Context) (int, error)
+}
+
+type APIKeyService interface {
+	// Authenticate returns the principal of an enabled, unexpired key.
+	Authenticate(ctx context.Context, secret string) (*entities.Principal, error)
+	// CreateKey and RotateKey return the new key with its secret, which
+	// is not stored and cannot be retrieved again.
+	CreateKey(ctx context.Context, req entities.APIKeyRequest) (*entities.APIKey, error)
+	ListKeys(ctx context.Context) ([]entities.APIKey, error)
+	RotateKey(ctx context.Context, id string, req entities.RotateAPIKeyRequest) (*entities.APIKey, error)
+	RevokeKey(ctx context.Context, id string) error
+	ListAuditLog(ctx context.Context) ([]entities.APIKeyAuditEntry, error)
 }
 
 type PromoService interface {
 	ValidatePromoCode(ctx context.Context, code string) (bool, error)
+	RedeemPromoCode(ctx context.Context, code, orderID string) error
+	ReleasePromoCode(ctx context.Context, code, orderID string) error
+}
+
+type CartService interface {
+	CreateCart(ctx context.Context) (*entities.PricedCart, error)
+	GetCart(ctx context.Context, id string) (*entities.PricedCart, error)
+	AddItem(ctx context.Context, id string, req entities.CartItemRequest) (*entities.PricedCart, error)
+	UpdateItem(ctx context.Context, id string, req entities.CartItemRequest) (*entities.PricedCart, error)
+	RemoveItem(ctx context.Context, id, productID string) (*entities.PricedCart, error)
+	ApplyCoupon(ctx context.Context, id string, req entities.CartCouponRequest) (*entities.PricedCart, error)
+	RemoveCoupon(ctx context.Context, id string) (*entities.PricedCart, error)
+	Checkout(ctx context.Context, id string, req entities.CheckoutRequest) (*entities.Order, error)
+}
+
+type OrderExportService interface {
+	// ExportOrders calls emit with every line of every order in the range,
+	// oldest order first. It validates the request before emitting anything.
+	ExportOrders(ctx context.Context, req entities.OrderExportRequest, emit func(row entities.OrderExportRow) error) error
+}
+
+type ReceiptService interface {
+	RenderReceipt(ctx context.Context, orderID string, req entities.ReceiptRequest) (*entities.RenderedReceipt, error)
+}
+
+// ReceiptRenderer lays a receipt out in one of the receipt formats.
+// paperWidth is in millimetres.
+type ReceiptRenderer interface {
+	Render(receipt *entities.Receipt, format entities.ReceiptFormat, paperWidth int) (*entities.RenderedReceipt, error)
+}
+
+// OrderIDGenerator issues opaque, unique and roughly time-ordered order IDs.
+type OrderIDGenerator interface {
+	NewID() (string, error)
+}
+
+// OrderNumberSequencer issues short human-friendly order numbers for tickets
+// and receipts. They are only unique within a day.
+type OrderNumberSequencer interface {
+	Next(ctx context.Context, at time.Time) (string, error)
+}
+
+// TokenVerifier authenticates bearer tokens issued by an identity provider
+// and maps their claims to a principal, as APIKeyService does for keys.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*entities.Principal, error)
+}
+
+type QuoteSigner interface {
+	Sign(claims entities.QuoteClaims) (string, error)
+	Verify(token string) (*entities.QuoteClaims, error)
+}
+
+// PaymentGateway moves money through a payment provider. Authorize holds
+// funds on a card, Capture collects them, Void releases a hold that was not
+// captured and Refund returns captured funds.
+type PaymentGateway interface {
+	Authorize(ctx context.Context, req entities.PaymentRequest) (*entities.PaymentAuthorization, error)
+	Capture(ctx context.Context, authorizationID string, amount entities.Money) error
+	Void(ctx context.Context, authorizationID string) error
+	Refund(ctx context.Context, authorizationID string, amount entities.Money) error
+}
+
+// OrderEventPublisher is told about every change to an order once it has
+// been stored.
+type OrderEventPublisher interface {
+	Publish(ctx context.Context, event entities.OrderEvent)
+}
+
+// EventSink is somewhere the outbox dispatcher publishes order events. An
+// event a sink fails to accept is offered to every sink again later, so
+// sinks must tolerate duplicates.
+type EventSink interface {
+	Name() string
+	Deliver(ctx context.Context, event entities.OrderEvent) error
+}
+
+type WebhookService interface {
+	OrderEventPublisher
+	CreateSubscription(ctx context.Context, req entities.WebhookSubscriptionRequest) (*entities.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]entities.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeadLetters(ctx context.Context) ([]entities.WebhookDelivery, error)
+	ReplayDeadLetter(ctx context.Context, id string) (*entities.WebhookDelivery, error)
+	// Close waits for deliveries in flight, including their retries, until
+	// ctx ends.
+	Close(ctx context.Context) error
+}
+
+// WebhookSender makes one delivery attempt. It returns the receiver's status
+// code, if any, and an error unless the receiver accepted the event.
+type WebhookSender interface {
+	Send(ctx context.Context, subscription *entities.WebhookSubscription, delivery *entities.WebhookDelivery) (int, error)
 }
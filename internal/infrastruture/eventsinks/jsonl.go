@@ -0,0 +1,62 @@
+package eventsinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONLSink appends every event to a file as one JSON object per line.
+type JSONLSink struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewJSONLSink opens path for appending, creating it and its directory
+// when missing.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+
+	return &JSONLSink{file: file}, nil
+}
+
+func (s *JSONLSink) Name() string {
+	return "jsonl"
+}
+
+// Deliver writes the event and syncs the file, so an accepted event is on
+// disk before it leaves the outbox.
+func (s *JSONLSink) Deliver(ctx context.Context, event entities.OrderEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+
+	return s.file.Sync()
+}
+
+func (s *JSONLSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.file.Close()
+}
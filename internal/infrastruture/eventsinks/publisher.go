@@ -0,0 +1,30 @@
+package eventsinks
+
+import (
+	"context"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+)
+
+// PublisherSink forwards events to an OrderEventPublisher, such as the
+// webhook service, which takes over retrying them.
+type PublisherSink struct {
+	name      string
+	publisher interfaces.OrderEventPublisher
+}
+
+func NewPublisherSink(name string, publisher interfaces.OrderEventPublisher) interfaces.EventSink {
+	return &PublisherSink{
+		name:      name,
+		publisher: publisher,
+	}
+}
+
+func (s *PublisherSink) Name() string {
+	return s.name
+}
+
+func (s *PublisherSink) Deliver(ctx context.Context, event entities.OrderEvent) error {
+	s.publisher.Publish(ctx, event)
+	return nil
+}
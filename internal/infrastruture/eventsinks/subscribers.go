@@ -0,0 +1,55 @@
+// Package eventsinks holds the places the outbox dispatcher publishes order
+// events to.
+package eventsinks
+
+import (
+	"context"
+	"errors"
+	"ooliokartchallenge/internal/domain/entities"
+	"sync"
+)
+
+// Handler reacts to an order event inside the process. Returning an error
+// leaves the event in the outbox to be offered again.
+type Handler func(ctx context.Context, event entities.OrderEvent) error
+
+// Subscribers hands events to in-process handlers.
+type Subscribers struct {
+	handlers map[string][]Handler
+	mutex    sync.RWMutex
+}
+
+func NewSubscribers() *Subscribers {
+	return &Subscribers{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// Subscribe registers handler for eventType, or for every event type when
+// eventType is empty.
+func (s *Subscribers) Subscribe(eventType string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[eventType] = append(s.handlers[eventType], handler)
+}
+
+func (s *Subscribers) Name() string {
+	return "subscribers"
+}
+
+// Deliver runs every handler interested in the event, even after one fails.
+func (s *Subscribers) Deliver(ctx context.Context, event entities.OrderEvent) error {
+	s.mutex.RLock()
+	handlers := append(append([]Handler(nil), s.handlers[""]...), s.handlers[event.Type]...)
+	s.mutex.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
+)
+
+type APIKeyHandler struct {
+	apiKeyService interfaces.APIKeyService
+	logger        *logger.Logger
+}
+
+func NewAPIKeyHandler(apiKeyService interfaces.APIKeyService, log *logger.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		logger:        log,
+	}
+}
+
+// CreateKey handles POST /admin/api-keys requests. The secret is only
+// returned in this response.
+func (h *APIKeyHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var keyRequest entities.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&keyRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	key, err := h.apiKeyService.CreateKey(r.Context(), keyRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, key)
+}
+
+// ListKeys handles GET /admin/api-keys requests, without hashes or secrets
+func (h *APIKeyHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.ListKeys(r.Context())
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, keys)
+}
+
+// RotateKey handles POST /admin/api-keys/{id}/rotate requests. The body is
+// optional and the new secret is only returned in this response.
+func (h *APIKeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	var rotateRequest entities.RotateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&rotateRequest); err != nil && err != io.EOF {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	key, err := h.apiKeyService.RotateKey(r.Context(), r.PathValue("id"), rotateRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, key)
+}
+
+// RevokeKey handles DELETE /admin/api-keys/{id} requests
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.apiKeyService.RevokeKey(r.Context(), r.PathValue("id")); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAuditLog handles GET /admin/api-keys/audit requests, oldest entry first
+func (h *APIKeyHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.apiKeyService.ListAuditLog(r.Context())
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, entries)
+}
+
+func (h *APIKeyHandler) respond(w http.ResponseWriter, r *http.Request, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.WithContext(r.Context()).Error("Failed to encode API key response", "encode_error", err.Error())
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
+)
+
+type CartHandler struct {
+	cartService interfaces.CartService
+	logger      *logger.Logger
+}
+
+func NewCartHandler(cartService interfaces.CartService, log *logger.Logger) *CartHandler {
+	return &CartHandler{
+		cartService: cartService,
+		logger:      log,
+	}
+}
+
+// CreateCart handles POST /cart requests to start a new empty cart
+func (h *CartHandler) CreateCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.cartService.CreateCart(r.Context())
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, cart)
+}
+
+// GetCart handles GET /cart/{id} requests to return a cart with live pricing
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.cartService.GetCart(r.Context(), r.PathValue("id"))
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// AddItem handles POST /cart/{id}/items requests to add a product to a cart
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	var itemRequest entities.CartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&itemRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	cart, err := h.cartService.AddItem(r.Context(), r.PathValue("id"), itemRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// UpdateItem handles PUT /cart/{id}/items/{productId} requests to change an item's quantity
+func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	var itemRequest entities.CartItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&itemRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+	itemRequest.ProductID = r.PathValue("productId")
+
+	cart, err := h.cartService.UpdateItem(r.Context(), r.PathValue("id"), itemRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// RemoveItem handles DELETE /cart/{id}/items/{productId} requests
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.cartService.RemoveItem(r.Context(), r.PathValue("id"), r.PathValue("productId"))
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// ApplyCoupon handles PUT /cart/{id}/coupon requests
+func (h *CartHandler) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	var couponRequest entities.CartCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&couponRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	cart, err := h.cartService.ApplyCoupon(r.Context(), r.PathValue("id"), couponRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// RemoveCoupon handles DELETE /cart/{id}/coupon requests
+func (h *CartHandler) RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.cartService.RemoveCoupon(r.Context(), r.PathValue("id"))
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, cart)
+}
+
+// Checkout handles POST /cart/{id}/checkout requests to turn a cart into an order.
+// The body is optional.
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	var checkoutRequest entities.CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&checkoutRequest); err != nil && err != io.EOF {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	order, err := h.cartService.Checkout(r.Context(), r.PathValue("id"), checkoutRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, order)
+}
+
+func (h *CartHandler) respond(w http.ResponseWriter, r *http.Request, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.WithContext(r.Context()).Error("Failed to encode cart response", "encode_error", err.Error())
+	}
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"ooliokartchallenge/internal/domain/entities"
 	"ooliokartchallenge/internal/domain/errors"
 	"ooliokartchallenge/pkg/logger"
 )
@@ -11,6 +15,7 @@ import (
 
 func HandleError(w http.ResponseWriter, r *http.Request, err error, log *logger.Logger) {
 	apiError := errors.MapErrorToAPIError(err)
+	apiError.CorrelationID = logger.GetCorrelationID(r.Context())
 
 	contextLogger := log.WithContext(r.Context())
 	contextLogger.Error("Request failed",
@@ -19,16 +24,56 @@ func HandleError(w http.ResponseWriter, r *http.Request, err error, log *logger.
 		"path", r.URL.Path,
 		"status_code", apiError.Code,
 		"error_type", apiError.Type,
+		"api_key_id", entities.APIKeyIDFromContext(r.Context()),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(apiError.Code)
+	if encodeErr := WriteAPIError(w, r, apiError); encodeErr != nil {
+		contextLogger.Error("Failed to encode error response", "encode_error", encodeErr.Error())
+	}
+}
 
-	errorResponse := errors.ErrorResponse{
-		Error: apiError,
+// WriteAPIError writes apiError as RFC 7807 application/problem+json when
+// the Accept header prefers it, and as the {"error": ...} envelope otherwise.
+func WriteAPIError(w http.ResponseWriter, r *http.Request, apiError errors.APIError) error {
+	w.Header().Add("Vary", "Accept")
+
+	if !acceptsProblemJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(apiError.Code)
+		return json.NewEncoder(w).Encode(errors.ErrorResponse{Error: apiError})
 	}
 
-	if encodeErr := json.NewEncoder(w).Encode(errorResponse); encodeErr != nil {
-		contextLogger.Error("Failed to encode error response", "encode_error", encodeErr.Error())
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(apiError.Code)
+	return json.NewEncoder(w).Encode(apiError.Problem(r.URL.Path))
+}
+
+// acceptsProblemJSON reports whether accept names application/problem+json
+// with a quality at least that of application/json. Wildcards keep the
+// envelope, so existing clients see no change.
+func acceptsProblemJSON(accept string) bool {
+	problemQuality, jsonQuality := 0.0, 0.0
+
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := params["q"]; found {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/problem+json":
+			problemQuality = max(problemQuality, quality)
+		case "application/json":
+			jsonQuality = max(jsonQuality, quality)
+		}
 	}
+
+	return problemQuality > 0 && problemQuality >= jsonQuality
 }
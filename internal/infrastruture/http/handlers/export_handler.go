@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushRows is how many rows are buffered before they are pushed to
+// the client.
+const exportFlushRows = 100
+
+var exportCSVHeader = []string{
+	"order_id", "order_number", "created_at", "status", "currency",
+	"product_id", "product_name", "quantity", "unit_price", "discount", "total",
+}
+
+type ExportHandler struct {
+	exportService interfaces.OrderExportService
+	logger        *logger.Logger
+}
+
+func NewExportHandler(exportService interfaces.OrderExportService, log *logger.Logger) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		logger:        log,
+	}
+}
+
+// ExportOrders handles GET /admin/orders/export?from=&to=&format=csv|jsonl
+// requests. Rows are streamed as they are read and gzip encoded when the
+// client accepts it.
+func (h *ExportHandler) ExportOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		HandleError(w, r, fmt.Errorf("%w: format must be csv or jsonl, got '%s'", errors.ErrInvalidExportRequest, format), h.logger)
+		return
+	}
+
+	exportRequest := entities.OrderExportRequest{
+		From: query.Get("from"),
+		To:   query.Get("to"),
+	}
+
+	stream := newExportStream(w, format, acceptsGzip(r))
+
+	err := h.exportService.ExportOrders(r.Context(), exportRequest, stream.write)
+	if err == nil {
+		err = stream.close()
+	}
+	if err == nil {
+		return
+	}
+
+	// Once rows have been sent the status can no longer change, so the
+	// client only sees a truncated body.
+	if !stream.started {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.logger.WithContext(r.Context()).Error("Order export aborted",
+		"error", err.Error(),
+		"rows", stream.rows,
+	)
+}
+
+// exportStream writes rows to the response, sending the headers with the
+// first row so validation errors can still be reported with a status.
+type exportStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	format     string
+	gzip       *gzip.Writer
+	csv        *csv.Writer
+	json       *json.Encoder
+	started    bool
+	rows       int
+}
+
+func newExportStream(w http.ResponseWriter, format string, compress bool) *exportStream {
+	stream := &exportStream{
+		w:          w,
+		controller: http.NewResponseController(w),
+		format:     format,
+	}
+	if compress {
+		stream.gzip = gzip.NewWriter(w)
+	}
+	return stream
+}
+
+func (s *exportStream) start() error {
+	s.started = true
+
+	contentType := "text/csv; charset=utf-8"
+	if s.format == "jsonl" {
+		contentType = "application/x-ndjson"
+	}
+
+	s.w.Header().Set("Content-Type", contentType)
+	s.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="orders.%s"`, s.format))
+	s.w.Header().Add("Vary", "Accept-Encoding")
+	if s.gzip != nil {
+		s.w.Header().Set("Content-Encoding", "gzip")
+	}
+	s.w.WriteHeader(http.StatusOK)
+
+	var out io.Writer = s.w
+	if s.gzip != nil {
+		out = s.gzip
+	}
+
+	if s.format == "jsonl" {
+		s.json = json.NewEncoder(out)
+		return nil
+	}
+
+	s.csv = csv.NewWriter(out)
+	return s.csv.Write(exportCSVHeader)
+}
+
+func (s *exportStream) write(row entities.OrderExportRow) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if s.json != nil {
+		err = s.json.Encode(row)
+	} else {
+		err = s.csv.Write([]string{
+			row.OrderID,
+			row.OrderNumber,
+			row.CreatedAt.UTC().Format(time.RFC3339),
+			string(row.Status),
+			row.Currency,
+			row.ProductID,
+			row.ProductName,
+			strconv.Itoa(row.Quantity),
+			row.UnitPrice.String(),
+			row.Discount.String(),
+			row.Total.String(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	s.rows++
+	if s.rows%exportFlushRows == 0 {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush pushes buffered rows through every layer down to the client.
+func (s *exportStream) flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	if s.gzip != nil {
+		if err := s.gzip.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.controller.Flush(); err != nil && !stderrors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// close finishes the export, sending the headers first when the range had
+// no orders.
+func (s *exportStream) close() error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	if s.gzip != nil {
+		return s.gzip.Close()
+	}
+	return nil
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+// without refusing it with q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+
+		quality := strings.ReplaceAll(params, " ", "")
+		return quality != "q=0" && quality != "q=0.0" && quality != "q=0.00" && quality != "q=0.000"
+	}
+	return false
+}
@@ -45,3 +45,154 @@ func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// QuoteOrder handles POST /order/quote requests to price an order without placing it
+func (h *OrderHandler) QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var orderRequest entities.OrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&orderRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	quote, err := h.orderService.QuoteOrder(ctx, orderRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(quote); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+}
+
+// GetOrder handles GET /order/{id} requests to return an order with its timeline
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orderID := r.PathValue("id")
+
+	if orderID == "" {
+		HandleError(w, r, errors.ErrOrderNotFound, h.logger)
+		return
+	}
+
+	order, err := h.orderService.GetOrder(ctx, orderID)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+}
+
+// TransitionOrder handles POST /order/{id}/transition requests to move an order to a new status
+func (h *OrderHandler) TransitionOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orderID := r.PathValue("id")
+
+	if orderID == "" {
+		HandleError(w, r, errors.ErrOrderNotFound, h.logger)
+		return
+	}
+
+	var transitionRequest entities.TransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&transitionRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	order, err := h.orderService.TransitionOrder(ctx, orderID, transitionRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+}
+
+// CancelOrder handles POST /order/{id}/cancel requests
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orderID := r.PathValue("id")
+
+	if orderID == "" {
+		HandleError(w, r, errors.ErrOrderNotFound, h.logger)
+		return
+	}
+
+	var cancelRequest entities.CancelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&cancelRequest); err != nil {
+			HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+			return
+		}
+	}
+
+	order, err := h.orderService.CancelOrder(ctx, orderID, cancelRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+}
+
+// RefundOrder handles POST /order/{id}/refund requests for full or partial refunds
+func (h *OrderHandler) RefundOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	orderID := r.PathValue("id")
+
+	if orderID == "" {
+		HandleError(w, r, errors.ErrOrderNotFound, h.logger)
+		return
+	}
+
+	var refundRequest entities.RefundRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&refundRequest); err != nil {
+			HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+			return
+		}
+	}
+
+	order, err := h.orderService.RefundOrder(ctx, orderID, refundRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(order); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+}
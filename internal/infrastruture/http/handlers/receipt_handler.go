@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
+	"strconv"
+)
+
+type ReceiptHandler struct {
+	receiptService interfaces.ReceiptService
+	logger         *logger.Logger
+}
+
+func NewReceiptHandler(receiptService interfaces.ReceiptService, log *logger.Logger) *ReceiptHandler {
+	return &ReceiptHandler{
+		receiptService: receiptService,
+		logger:         log,
+	}
+}
+
+// GetReceipt handles GET /order/{id}/receipt?format=html|text|escpos&width=58|80
+// requests. The format defaults to html and the width to the configured paper.
+func (h *ReceiptHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	receiptRequest := entities.ReceiptRequest{
+		Format: entities.ReceiptFormat(query.Get("format")),
+	}
+	if receiptRequest.Format == "" {
+		receiptRequest.Format = entities.ReceiptFormatHTML
+	}
+
+	if width := query.Get("width"); width != "" {
+		paperWidth, err := strconv.Atoi(width)
+		if err != nil {
+			HandleError(w, r, fmt.Errorf("%w: width must be a number of millimetres", errors.ErrInvalidReceiptRequest), h.logger)
+			return
+		}
+		receiptRequest.PaperWidth = paperWidth
+	}
+
+	receipt, err := h.receiptService.RenderReceipt(r.Context(), r.PathValue("id"), receiptRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.Header().Set("Content-Type", receipt.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(receipt.Body)))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(receipt.Body); err != nil {
+		h.logger.WithContext(r.Context()).Error("Failed to write receipt", "error", err.Error())
+	}
+}
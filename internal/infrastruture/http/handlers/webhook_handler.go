@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/pkg/logger"
+)
+
+type WebhookHandler struct {
+	webhookService interfaces.WebhookService
+	logger         *logger.Logger
+}
+
+func NewWebhookHandler(webhookService interfaces.WebhookService, log *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		logger:         log,
+	}
+}
+
+// CreateSubscription handles POST /webhooks requests. The secret is only
+// returned in this response.
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var subscriptionRequest entities.WebhookSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&subscriptionRequest); err != nil {
+		HandleError(w, r, errors.ErrInvalidJSON, h.logger)
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(r.Context(), subscriptionRequest)
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusCreated, subscription)
+}
+
+// ListSubscriptions handles GET /webhooks requests for the caller's subscriptions
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.webhookService.ListSubscriptions(r.Context())
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, subscriptions)
+}
+
+// DeleteSubscription handles DELETE /webhooks/{id} requests
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.webhookService.DeleteSubscription(r.Context(), r.PathValue("id")); err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeadLetters handles GET /webhooks/dead-letters requests for deliveries that ran out of retries
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := h.webhookService.ListDeadLetters(r.Context())
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusOK, deliveries)
+}
+
+// ReplayDeadLetter handles POST /webhooks/dead-letters/{id}/replay requests to deliver again
+func (h *WebhookHandler) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.webhookService.ReplayDeadLetter(r.Context(), r.PathValue("id"))
+	if err != nil {
+		HandleError(w, r, err, h.logger)
+		return
+	}
+
+	h.respond(w, r, http.StatusAccepted, delivery)
+}
+
+func (h *WebhookHandler) respond(w http.ResponseWriter, r *http.Request, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		h.logger.WithContext(r.Context()).Error("Failed to encode webhook response", "encode_error", err.Error())
+	}
+}
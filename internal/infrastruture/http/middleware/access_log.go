@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"ooliokartchallenge/pkg/logger"
+	"strings"
+	"time"
+)
+
+const (
+	redacted = "[REDACTED]"
+
+	// maxLoggedBodyBytes caps how much of a request body is buffered for
+	// the access log; larger bodies are passed through but not logged.
+	maxLoggedBodyBytes = 16 << 10
+)
+
+// AccessLogOptions decides what the access log records about each request.
+type AccessLogOptions struct {
+	// TrustedProxies are the networks whose X-Forwarded-For entries are
+	// believed when working out the client IP.
+	TrustedProxies []netip.Prefix
+	// Headers lists the request headers to log; those also in
+	// RedactHeaders are logged as [REDACTED].
+	Headers       []string
+	RedactHeaders []string
+	// LogBody logs JSON request bodies with the RedactFields keys, at any
+	// depth, replaced by [REDACTED].
+	LogBody      bool
+	RedactFields []string
+	// SuccessSampleRate is the fraction of 2xx responses logged, between 0
+	// and 1. Other responses are always logged.
+	SuccessSampleRate float64
+}
+
+type AccessLogMiddleware struct {
+	options       AccessLogOptions
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+	logger        *logger.Logger
+}
+
+func NewAccessLogMiddleware(options AccessLogOptions, logger *logger.Logger) (*AccessLogMiddleware, error) {
+	if options.SuccessSampleRate < 0 || options.SuccessSampleRate > 1 {
+		return nil, fmt.Errorf("access log sample rate must be between 0 and 1, got %g", options.SuccessSampleRate)
+	}
+
+	m := &AccessLogMiddleware{
+		options:       options,
+		redactHeaders: make(map[string]bool),
+		redactFields:  make(map[string]bool),
+		logger:        logger,
+	}
+	for _, header := range options.RedactHeaders {
+		m.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range options.RedactFields {
+		m.redactFields[strings.ToLower(field)] = true
+	}
+
+	return m, nil
+}
+
+// LogRequests writes one log line per request once it has been served.
+// It must sit between Correlate and the ServeMux so the correlation ID is
+// known and the matched route pattern can be read back from the request.
+func (m *AccessLogMiddleware) LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		fields := &accessLogFields{}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogFieldsKey{}, fields))
+
+		var body any
+		if m.options.LogBody {
+			body = m.captureBody(r)
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if !m.sampled(recorder.statusCode) {
+			return
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		attrs := []any{
+			"method", r.Method,
+			"route", route,
+			"status_code", recorder.statusCode,
+			"bytes", recorder.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", clientIP(r, m.options.TrustedProxies),
+		}
+		if fields.apiKeyID != "" {
+			attrs = append(attrs, "api_key_id", fields.apiKeyID)
+		}
+		if headers := m.headers(r); len(headers) > 0 {
+			attrs = append(attrs, "headers", headers)
+		}
+		if body != nil {
+			attrs = append(attrs, "body", body)
+		}
+
+		m.logger.WithContext(r.Context()).Info("HTTP request", attrs...)
+	})
+}
+
+func (m *AccessLogMiddleware) sampled(statusCode int) bool {
+	if statusCode < 200 || statusCode > 299 || m.options.SuccessSampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < m.options.SuccessSampleRate
+}
+
+func (m *AccessLogMiddleware) headers(r *http.Request) map[string]string {
+	headers := make(map[string]string)
+
+	for _, name := range m.options.Headers {
+		name = http.CanonicalHeaderKey(name)
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		if m.redactHeaders[name] {
+			headers[name] = redacted
+		} else {
+			headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	return headers
+}
+
+// captureBody reads a JSON body for logging and puts it back for the
+// handler. Bodies that are too large or not JSON are not logged.
+func (m *AccessLogMiddleware) captureBody(r *http.Request) any {
+	if r.Body == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxLoggedBodyBytes+1))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(data), r.Body), Closer: r.Body}
+	if err != nil || len(data) == 0 || len(data) > maxLoggedBodyBytes {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return nil
+	}
+
+	return m.redact(body)
+}
+
+func (m *AccessLogMiddleware) redact(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if m.redactFields[strings.ToLower(key)] {
+				value[key] = redacted
+			} else {
+				value[key] = m.redact(field)
+			}
+		}
+	case []any:
+		for i, element := range value {
+			value[i] = m.redact(element)
+		}
+	}
+	return value
+}
+
+// accessLogFields collects what inner middleware learns about the request,
+// such as the API key, which the access log cannot see in the context it
+// created.
+type accessLogFields struct {
+	apiKeyID string
+}
+
+type accessLogFieldsKey struct{}
+
+func recordAccessLogAPIKeyID(ctx context.Context, apiKeyID string) {
+	if fields, ok := ctx.Value(accessLogFieldsKey{}).(*accessLogFields); ok {
+		fields.apiKeyID = apiKeyID
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// statusRecorder notes the status and size of a response. Unwrap lets
+// http.ResponseController reach the underlying writer for flushing.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	bytes       int64
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if !sr.wroteHeader {
+		sr.statusCode = statusCode
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	sr.wroteHeader = true
+	n, err := sr.ResponseWriter.Write(data)
+	sr.bytes += int64(n)
+	return n, err
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
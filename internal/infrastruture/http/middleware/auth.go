@@ -1,38 +1,120 @@
 package middleware
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
 	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/http/handlers"
 	"ooliokartchallenge/pkg/logger"
+	"strings"
 )
 
 const (
 	APIKeyHeader = "api_key"
-	ValidAPIKey  = "apitest"
+
+	// APIKeyActor is recorded in order timelines for requests authenticated by API key.
+	APIKeyActor = "api_key"
+	// BearerTokenActor is recorded for requests authenticated by bearer token.
+	BearerTokenActor = "bearer_token"
 )
 
 type AuthMiddleware struct {
-	logger *logger.Logger
+	apiKeyService     interfaces.APIKeyService
+	tokenVerifier     interfaces.TokenVerifier
+	signatureVerifier *SignatureVerifier
+	schemes           entities.AuthSchemePolicy
+	logger            *logger.Logger
 }
 
-func NewAuthMiddleware(logger *logger.Logger) *AuthMiddleware {
+// NewAuthMiddleware only accepts bearer tokens when tokenVerifier is set and
+// signed requests when signatureVerifier is, on the routes schemes allows.
+func NewAuthMiddleware(
+	apiKeyService interfaces.APIKeyService,
+	tokenVerifier interfaces.TokenVerifier,
+	signatureVerifier *SignatureVerifier,
+	schemes entities.AuthSchemePolicy,
+	logger *logger.Logger,
+) *AuthMiddleware {
 	return &AuthMiddleware{
-		logger: logger,
+		apiKeyService:     apiKeyService,
+		tokenVerifier:     tokenVerifier,
+		signatureVerifier: signatureVerifier,
+		schemes:           schemes,
+		logger:            logger,
 	}
 }
 
+// RequireAPIKey authenticates the request with whichever scheme its headers
+// use: a signature, the api_key header or an Authorization: Bearer token.
+// Each leads to the same principal and scopes. It must wrap the handler
+// inside the ServeMux, as the schemes accepted depend on the matched route.
 func (m *AuthMiddleware) RequireAPIKey(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get(APIKeyHeader)
-
-		if apiKey == "" {
-			m.handleAuthError(w, r, errors.ErrMissingAPIKey)
+		principal, actor, err := m.authenticate(r)
+		if err != nil {
+			m.handleAuthError(w, r, err)
 			return
 		}
 
-		if apiKey != ValidAPIKey {
-			m.handleAuthError(w, r, errors.ErrInvalidAPIKey)
+		ctx := entities.WithActor(r.Context(), actor)
+		ctx = entities.WithPrincipal(ctx, principal)
+		recordAccessLogAPIKeyID(ctx, principal.KeyID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *AuthMiddleware) authenticate(r *http.Request) (*entities.Principal, string, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	isBearer := strings.EqualFold(scheme, "Bearer") && token != ""
+
+	switch {
+	case r.Header.Get(SignatureHeader) != "":
+		if err := m.allow(r, entities.AuthSchemeSignature, m.signatureVerifier != nil); err != nil {
+			return nil, "", err
+		}
+		principal, err := m.signatureVerifier.Verify(r)
+		return principal, SignedRequestActor, err
+
+	case r.Header.Get(APIKeyHeader) != "":
+		if err := m.allow(r, entities.AuthSchemeAPIKey, true); err != nil {
+			return nil, "", err
+		}
+		principal, err := m.apiKeyService.Authenticate(r.Context(), r.Header.Get(APIKeyHeader))
+		return principal, APIKeyActor, err
+
+	case isBearer:
+		if err := m.allow(r, entities.AuthSchemeBearer, m.tokenVerifier != nil); err != nil {
+			return nil, "", err
+		}
+		principal, err := m.tokenVerifier.Verify(r.Context(), strings.TrimSpace(token))
+		return principal, BearerTokenActor, err
+
+	default:
+		return nil, "", errors.ErrMissingAPIKey
+	}
+}
+
+// allow rejects schemes the route does not accept, or the server is not
+// configured for.
+func (m *AuthMiddleware) allow(r *http.Request, scheme string, configured bool) error {
+	if !configured || !m.schemes.Allows(r.Pattern, scheme) {
+		return fmt.Errorf("%w: %s", errors.ErrAuthSchemeNotAllowed, scheme)
+	}
+	return nil
+}
+
+// RequireScope rejects callers whose key was not granted scope. It must be
+// wrapped by RequireAPIKey.
+func (m *AuthMiddleware) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := entities.PrincipalFromContext(r.Context())
+		if principal == nil || !principal.HasScope(scope) {
+			m.handleAuthError(w, r, fmt.Errorf("%w: %s", errors.ErrForbidden, scope))
 			return
 		}
 
@@ -40,8 +122,17 @@ func (m *AuthMiddleware) RequireAPIKey(next http.Handler) http.Handler {
 	})
 }
 
+// APIKeyID derives a stable identifier for an API key that can be stored
+// and logged without revealing the key. It names the key configured with
+// API_KEY when no key file is used.
+func APIKeyID(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return "key_" + hex.EncodeToString(hash[:8])
+}
+
 func (m *AuthMiddleware) handleAuthError(w http.ResponseWriter, r *http.Request, err error) {
 	apiError := errors.MapErrorToAPIError(err)
+	apiError.CorrelationID = logger.GetCorrelationID(r.Context())
 
 	contextLogger := m.logger.WithContext(r.Context())
 	contextLogger.Warn("Authentication failed",
@@ -51,16 +142,10 @@ func (m *AuthMiddleware) handleAuthError(w http.ResponseWriter, r *http.Request,
 		"user_agent", r.Header.Get("User-Agent"),
 		"status_code", apiError.Code,
 		"error_type", apiError.Type,
+		"api_key_id", entities.APIKeyIDFromContext(r.Context()),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(apiError.Code)
-
-	errorResponse := errors.ErrorResponse{
-		Error: apiError,
-	}
-
-	if encodeErr := json.NewEncoder(w).Encode(errorResponse); encodeErr != nil {
+	if encodeErr := handlers.WriteAPIError(w, r, apiError); encodeErr != nil {
 		contextLogger.Error("Failed to encode auth error response", "encode_error", encodeErr.Error())
 	}
 }
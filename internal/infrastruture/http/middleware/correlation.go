@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"ooliokartchallenge/pkg/logger"
+	"strings"
+)
+
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+
+	maxRequestIDLength = 128
+)
+
+// CorrelationMiddleware tags every request with a correlation ID so log
+// lines and error responses for the same request can be matched up.
+type CorrelationMiddleware struct{}
+
+func NewCorrelationMiddleware() *CorrelationMiddleware {
+	return &CorrelationMiddleware{}
+}
+
+// Correlate takes the ID from X-Request-ID, or the trace ID of a W3C
+// traceparent header, and generates one when neither is usable. The ID is
+// stored in the request context and echoed in the X-Request-ID response
+// header.
+func (m *CorrelationMiddleware) Correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID, ok := parseRequestID(r.Header.Get(RequestIDHeader))
+		if !ok {
+			correlationID, ok = parseTraceparent(r.Header.Get(TraceparentHeader))
+		}
+		if !ok {
+			correlationID = newCorrelationID()
+		}
+
+		w.Header().Set(RequestIDHeader, correlationID)
+
+		ctx := logger.WithCorrelationID(r.Context(), correlationID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseRequestID accepts client supplied IDs made of a safe set of
+// characters, so they can be logged and echoed without escaping.
+func parseRequestID(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || len(value) > maxRequestIDLength {
+		return "", false
+	}
+
+	for _, char := range value {
+		isAlphanumeric := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+		if !isAlphanumeric && !strings.ContainsRune("-_.:", char) {
+			return "", false
+		}
+	}
+
+	return value, true
+}
+
+// parseTraceparent returns the trace ID of a version-traceid-parentid-flags
+// header as described by W3C Trace Context. Unknown future versions may
+// append fields, which are ignored.
+func parseTraceparent(value string) (string, bool) {
+	fields := strings.Split(strings.TrimSpace(value), "-")
+	if len(fields) < 4 {
+		return "", false
+	}
+
+	version, traceID, parentID, flags := fields[0], fields[1], fields[2], fields[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(fields) != 4) {
+		return "", false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	if !isLowerHex(parentID, 16) || parentID == strings.Repeat("0", 16) || !isLowerHex(flags, 2) {
+		return "", false
+	}
+
+	return traceID, true
+}
+
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for _, char := range value {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newCorrelationID generates an ID shaped like a W3C trace ID, so generated
+// and propagated IDs look alike in the logs.
+func newCorrelationID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
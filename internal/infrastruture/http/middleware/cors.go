@@ -1,28 +1,183 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 )
 
-type CORSMiddleware struct{}
+const corsAllowedHeaders = "Content-Type, Authorization, api_key, Idempotency-Key, X-Request-ID, traceparent, X-Signature, X-Signature-Key, X-Signature-Timestamp, X-Signature-Nonce"
 
-func NewCORSMiddleware() *CORSMiddleware {
-	return &CORSMiddleware{}
+// corsMethods are the methods checked against the ServeMux to find the
+// ones a path accepts.
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type CORSOptions struct {
+	// AllowedOrigins are origins such as "https://shop.example.com".
+	// "https://*.example.com" allows every subdomain of example.com, but
+	// not example.com itself, and "*" allows every origin.
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies and Authorization headers.
+	// It cannot be combined with "*".
+	AllowCredentials bool
+	// ExposedHeaders are the response headers scripts may read.
+	ExposedHeaders []string
+}
+
+// CORSMiddleware answers preflight requests with the methods the matched
+// path is registered for, and tells browsers which origins may read
+// responses.
+type CORSMiddleware struct {
+	options        CORSOptions
+	anyOrigin      bool
+	exposedHeaders string
+}
+
+func NewCORSMiddleware(options CORSOptions) (*CORSMiddleware, error) {
+	m := &CORSMiddleware{
+		options:        options,
+		exposedHeaders: strings.Join(options.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range options.AllowedOrigins {
+		if origin == "*" {
+			m.anyOrigin = true
+			continue
+		}
+		if err := validateOriginPattern(origin); err != nil {
+			return nil, err
+		}
+	}
+	if m.anyOrigin && options.AllowCredentials {
+		return nil, fmt.Errorf("CORS credentials cannot be allowed for every origin")
+	}
+
+	return m, nil
 }
 
-func (m *CORSMiddleware) EnableCORS(next http.Handler) http.Handler {
+// EnableCORS wraps the ServeMux, which it asks which methods a path has.
+// Preflight requests for a method the path does not have, or for a path
+// with no routes, are passed on so the ServeMux answers 405 or 404.
+func (m *CORSMiddleware) EnableCORS(mux *http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, api_key")
-		w.Header().Set("Access-Control-Max-Age", "86400")
+		w.Header().Add("Vary", "Origin")
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && m.allows(origin)
+
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && origin != "" && requestedMethod != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			methods := routeMethods(mux, r)
+			if !slices.Contains(methods, requestedMethod) {
+				mux.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed {
+				m.setOriginHeaders(w, origin)
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", "86400")
+			}
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if allowed {
+			m.setOriginHeaders(w, origin)
+			if m.exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", m.exposedHeaders)
+			}
+		}
+
+		mux.ServeHTTP(w, r)
 	})
 }
+
+func (m *CORSMiddleware) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if m.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if m.options.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (m *CORSMiddleware) allows(origin string) bool {
+	if m.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, pattern := range m.options.AllowedOrigins {
+		pattern = strings.ToLower(pattern)
+
+		prefix, suffix, wildcard := strings.Cut(pattern, "*.")
+		if !wildcard {
+			if origin == pattern {
+				return true
+			}
+			continue
+		}
+
+		if len(origin) <= len(prefix)+len(suffix)+1 || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, "."+suffix) {
+			continue
+		}
+		subdomain := origin[len(prefix) : len(origin)-len(suffix)-1]
+		if isHostLabels(subdomain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeMethods returns the methods the ServeMux has a route for at the
+// request's path.
+func routeMethods(mux *http.ServeMux, r *http.Request) []string {
+	var methods []string
+	probe := r.Clone(r.Context())
+	for _, method := range corsMethods {
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// validateOriginPattern accepts scheme://host[:port] where the host may
+// start with "*." for any subdomain.
+func validateOriginPattern(pattern string) error {
+	parsed, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" || parsed.User != nil {
+		return fmt.Errorf("CORS origin '%s' must look like https://shop.example.com or https://*.example.com", pattern)
+	}
+	if strings.Count(pattern, "*") > 1 || (strings.Contains(pattern, "*") && !strings.Contains(pattern, "://*.")) {
+		return fmt.Errorf("CORS origin '%s' may only use * for the leftmost subdomain", pattern)
+	}
+	return nil
+}
+
+func isHostLabels(value string) bool {
+	for _, label := range strings.Split(value, ".") {
+		if label == "" {
+			return false
+		}
+		for _, char := range label {
+			isAlphanumeric := (char >= 'a' && char <= 'z') || (char >= '0' && char <= '9')
+			if !isAlphanumeric && char != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
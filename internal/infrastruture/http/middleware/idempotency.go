@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/http/handlers"
+	"ooliokartchallenge/pkg/logger"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+type IdempotencyMiddleware struct {
+	store  interfaces.IdempotencyRepository
+	ttl    time.Duration
+	logger *logger.Logger
+}
+
+func NewIdempotencyMiddleware(store interfaces.IdempotencyRepository, ttl time.Duration, logger *logger.Logger) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		store:  store,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Idempotent stores the first response for each Idempotency-Key, scoped to the
+// caller's API key, and replays it for retries carrying the same body.
+func (m *IdempotencyMiddleware) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+
+		if idempotencyKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			handlers.HandleError(w, r, errors.ErrInvalidIdempotencyKey, m.logger)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			handlers.HandleError(w, r, errors.ErrInvalidJSON, m.logger)
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			handlers.HandleError(w, r, fmt.Errorf("%w: body is larger than %d bytes", errors.ErrRequestTooLarge, maxIdempotentRequestBytes), m.logger)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		storeKey := m.scopedKey(r, idempotencyKey)
+		requestHash := hashRequest(r, body)
+
+		existing, reserved, err := m.store.Reserve(ctx, storeKey, requestHash, m.ttl)
+		if err != nil {
+			handlers.HandleError(w, r, err, m.logger)
+			return
+		}
+
+		if !reserved {
+			m.replay(w, r, existing, requestHash)
+			return
+		}
+
+		// The key is released unless a response is stored, so a handler that
+		// panics does not leave it in flight until it expires.
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := m.store.Release(ctx, storeKey); err != nil {
+				m.logger.WithContext(ctx).Error("Failed to release idempotency key", "error", err.Error())
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors are not remembered so the client can retry them.
+		if recorder.statusCode >= http.StatusInternalServerError {
+			return
+		}
+
+		if err := m.store.Complete(ctx, storeKey, recorder.statusCode, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			m.logger.WithContext(ctx).Error("Failed to store idempotent response", "error", err.Error())
+			return
+		}
+		stored = true
+	})
+}
+
+func (m *IdempotencyMiddleware) replay(w http.ResponseWriter, r *http.Request, record *entities.IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		handlers.HandleError(w, r, errors.ErrIdempotencyKeyReused, m.logger)
+		return
+	}
+
+	if !record.Completed {
+		handlers.HandleError(w, r, errors.ErrIdempotencyKeyInFlight, m.logger)
+		return
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.StatusCode)
+
+	if _, err := w.Write(record.Body); err != nil {
+		m.logger.WithContext(r.Context()).Error("Failed to replay idempotent response", "error", err.Error())
+	}
+}
+
+// scopedKey namespaces the client supplied key by a hash of the principal's
+// key ID so different clients can reuse the same key without colliding,
+// whichever way they authenticated.
+func (m *IdempotencyMiddleware) scopedKey(r *http.Request, idempotencyKey string) string {
+	var keyID string
+	if principal := entities.PrincipalFromContext(r.Context()); principal != nil {
+		keyID = principal.KeyID
+	}
+	keyIDHash := sha256.Sum256([]byte(keyID))
+	return hex.EncodeToString(keyIDHash[:]) + ":" + idempotencyKey
+}
+
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if !rr.wroteHeader {
+		rr.statusCode = statusCode
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(data)
+	return rr.ResponseWriter.Write(data)
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/http/handlers"
+	"ooliokartchallenge/pkg/logger"
+	"strconv"
+	"time"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+)
+
+type RateLimitOptions struct {
+	Policy entities.RateLimitPolicy
+	// KeyTiers maps API key IDs to their tier for keys that do not name
+	// one. Other keys are in the standard tier and requests without a key
+	// in the anonymous tier.
+	KeyTiers map[string]string
+	// TrustedProxies are used to find the client IP of anonymous requests.
+	TrustedProxies []netip.Prefix
+}
+
+// RateLimitMiddleware limits each API key, or each client IP for requests
+// without one, with a token bucket per route.
+type RateLimitMiddleware struct {
+	store   interfaces.RateLimitStore
+	options RateLimitOptions
+	logger  *logger.Logger
+}
+
+func NewRateLimitMiddleware(store interfaces.RateLimitStore, options RateLimitOptions, logger *logger.Logger) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		store:   store,
+		options: options,
+		logger:  logger,
+	}
+}
+
+// Limit must wrap the handler inside RequireAPIKey, where the route has
+// been matched and the API key is known. Routes without a matching rule
+// are not limited, and requests are let through if the store fails.
+func (m *RateLimitMiddleware) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tier, caller := entities.RateLimitTierAnonymous, "ip:"+clientIP(r, m.options.TrustedProxies)
+		if principal := entities.PrincipalFromContext(r.Context()); principal != nil {
+			tier, caller = m.keyTier(principal), "key:"+principal.KeyID
+		}
+
+		limit, limited := m.options.Policy.Limit(tier, r.Pattern)
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.take(w, r, next, limit, r.Pattern+"|"+caller)
+	})
+}
+
+// LimitClientIP wraps RequireAPIKey so that requests are limited by client
+// IP before they are authenticated, and guessing keys, tokens or signatures
+// costs budget too. Only rules naming the ip tier apply, so clients behind
+// one address are not held to the budget of a single caller.
+func (m *RateLimitMiddleware) LimitClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, limited := m.options.Policy.ExactTierLimit(entities.RateLimitTierClientIP, r.Pattern)
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.take(w, r, next, limit, r.Pattern+"|client-ip:"+clientIP(r, m.options.TrustedProxies))
+	})
+}
+
+// take spends a token of the bucket at key and answers 429 when there is
+// none left.
+func (m *RateLimitMiddleware) take(w http.ResponseWriter, r *http.Request, next http.Handler, limit entities.RateLimit, key string) {
+	decision, err := m.store.Take(r.Context(), key, limit, time.Now())
+	if err != nil {
+		m.logger.WithContext(r.Context()).Warn("Rate limit check failed, allowing request", "error", err.Error())
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set(RateLimitLimitHeader, strconv.Itoa(limit.Requests))
+	w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(decision.Remaining))
+	w.Header().Set(RateLimitResetHeader, strconv.FormatInt(ceilSeconds(decision.Reset), 10))
+	w.Header().Set(RateLimitPolicyHeader, limit.Policy())
+
+	if !decision.Allowed {
+		retryAfter := ceilSeconds(decision.RetryAfter)
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		handlers.HandleError(w, r, fmt.Errorf("%w: retry in %d seconds", errors.ErrRateLimited, retryAfter), m.logger)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// keyTier prefers the tier stored with the key over KeyTiers.
+func (m *RateLimitMiddleware) keyTier(principal *entities.Principal) string {
+	if principal.Tier != "" {
+		return principal.Tier
+	}
+	if tier, exists := m.options.KeyTiers[principal.KeyID]; exists {
+		return tier
+	}
+	return entities.RateLimitTierStandard
+}
+
+func ceilSeconds(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Seconds()))
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/infrastruture/http/handlers"
+	"ooliokartchallenge/pkg/logger"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecoveryMiddleware turns handler panics into 500 responses instead of
+// dropped connections, and keeps a count of panics per route.
+type RecoveryMiddleware struct {
+	crashReportDir string
+	logger         *logger.Logger
+
+	mutex  sync.Mutex
+	panics map[string]int64
+}
+
+// NewRecoveryMiddleware writes a crash report for every panic to
+// crashReportDir, creating it if needed. An empty crashReportDir only logs.
+func NewRecoveryMiddleware(crashReportDir string, logger *logger.Logger) (*RecoveryMiddleware, error) {
+	if crashReportDir != "" {
+		if err := os.MkdirAll(crashReportDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create crash report directory: %w", err)
+		}
+	}
+
+	return &RecoveryMiddleware{
+		crashReportDir: crashReportDir,
+		logger:         logger,
+		panics:         make(map[string]int64),
+	}, nil
+}
+
+// Recover must sit between Correlate and the ServeMux so the correlation ID
+// is known and the matched route pattern can be read back from the request.
+// http.ErrAbortHandler is passed on, as it is how handlers deliberately
+// abort a response.
+func (m *RecoveryMiddleware) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			m.report(r, recovered, debug.Stack())
+
+			// Part of the response is already on its way, so the best the
+			// client can be told is that it is incomplete.
+			if recorder.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			m.writeError(w, r)
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// PanicCounts returns how many panics each route pattern has had.
+func (m *RecoveryMiddleware) PanicCounts() map[string]int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	counts := make(map[string]int64, len(m.panics))
+	for route, count := range m.panics {
+		counts[route] = count
+	}
+	return counts
+}
+
+func (m *RecoveryMiddleware) report(r *http.Request, recovered any, stack []byte) {
+	route := r.Pattern
+	if route == "" {
+		route = "unmatched"
+	}
+
+	m.mutex.Lock()
+	m.panics[route]++
+	count := m.panics[route]
+	m.mutex.Unlock()
+
+	contextLogger := m.logger.WithContext(r.Context())
+	attrs := []any{
+		"panic", fmt.Sprint(recovered),
+		"method", r.Method,
+		"route", route,
+		"path", r.URL.Path,
+		"route_panics", count,
+		"stack", string(stack),
+	}
+
+	if m.crashReportDir != "" {
+		path, err := m.writeCrashReport(r, route, recovered, stack)
+		if err != nil {
+			contextLogger.Error("Failed to write crash report", "error", err.Error())
+		} else {
+			attrs = append(attrs, "crash_report", path)
+		}
+	}
+
+	contextLogger.Error("Recovered from panic", attrs...)
+}
+
+// writeCrashReport leaves out headers and bodies, which may carry API keys
+// and other secrets.
+func (m *RecoveryMiddleware) writeCrashReport(r *http.Request, route string, recovered any, stack []byte) (string, error) {
+	now := time.Now().UTC()
+	correlationID := logger.GetCorrelationID(r.Context())
+
+	name := "crash-" + now.Format("20060102T150405.000000000Z")
+	if correlationID != "" {
+		name += "-" + strings.NewReplacer(":", "_", ".", "_").Replace(correlationID)
+	}
+	path := filepath.Join(m.crashReportDir, name+".txt")
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&report, "correlation_id: %s\n", correlationID)
+	fmt.Fprintf(&report, "method: %s\n", r.Method)
+	fmt.Fprintf(&report, "route: %s\n", route)
+	fmt.Fprintf(&report, "path: %s\n", r.URL.Path)
+	fmt.Fprintf(&report, "panic: %v\n\n", recovered)
+	report.Write(stack)
+
+	if err := os.WriteFile(path, []byte(report.String()), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (m *RecoveryMiddleware) writeError(w http.ResponseWriter, r *http.Request) {
+	apiError := errors.MapErrorToAPIError(errors.ErrInternalServer)
+	apiError.CorrelationID = logger.GetCorrelationID(r.Context())
+
+	if err := handlers.WriteAPIError(w, r, apiError); err != nil {
+		m.logger.WithContext(r.Context()).Error("Failed to encode panic error response", "encode_error", err.Error())
+	}
+}
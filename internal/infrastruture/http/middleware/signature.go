@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature"
+
+	// SignedRequestActor is recorded for requests authenticated by signature.
+	SignedRequestActor = "signed_request"
+	// SignaturePrincipalPrefix starts the key ID of principals authenticated
+	// by signature, so they never collide with API key IDs.
+	SignaturePrincipalPrefix = "hmac:"
+
+	maxSignedBodyBytes = 1 << 20
+	maxNonceLength     = 128
+)
+
+// SignatureVerifier authenticates requests signed with a shared key, for
+// clients that should not send a static secret with every request.
+type SignatureVerifier struct {
+	keys   interfaces.SigningKeyRepository
+	nonces interfaces.NonceStore
+	window time.Duration
+}
+
+// NewSignatureVerifier accepts timestamps up to window away from the local
+// clock. Nonces are remembered until their timestamp leaves the window.
+func NewSignatureVerifier(keys interfaces.SigningKeyRepository, nonces interfaces.NonceStore, window time.Duration) *SignatureVerifier {
+	return &SignatureVerifier{
+		keys:   keys,
+		nonces: nonces,
+		window: window,
+	}
+}
+
+// RequestSignature returns the X-Signature value for a request:
+// "sha256=" followed by the hex HMAC-SHA256, keyed with the shared secret,
+// of the method, the path with its query, the Unix timestamp, the nonce and
+// the hex SHA-256 of the body, each on its own line.
+func RequestSignature(secret, method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of r and returns the principal of
+// the signing key. The body is read to hash it and put back for the handler.
+func (v *SignatureVerifier) Verify(r *http.Request) (*entities.Principal, error) {
+	keyID := r.Header.Get(SignatureKeyHeader)
+	timestamp := r.Header.Get(SignatureTimestampHeader)
+	nonce := r.Header.Get(SignatureNonceHeader)
+	signature := r.Header.Get(SignatureHeader)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, fmt.Errorf("%w: %s, %s, %s and %s are required", errors.ErrInvalidSignature, SignatureKeyHeader, SignatureTimestampHeader, SignatureNonceHeader, SignatureHeader)
+	}
+	if len(nonce) > maxNonceLength {
+		return nil, fmt.Errorf("%w: nonce is longer than %d characters", errors.ErrInvalidSignature, maxNonceLength)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp must be Unix seconds", errors.ErrInvalidSignature)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := time.Since(signedAt); skew > v.window || skew < -v.window {
+		return nil, fmt.Errorf("%w: timestamp is outside the %s window", errors.ErrInvalidSignature, v.window)
+	}
+
+	key, err := v.keys.GetByID(r.Context(), keyID)
+	if err != nil {
+		return nil, err
+	}
+	if !key.Enabled {
+		return nil, fmt.Errorf("%w: key is disabled", errors.ErrInvalidSignature)
+	}
+
+	body, err := readSignedBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := RequestSignature(key.Secret, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, fmt.Errorf("%w: signature mismatch", errors.ErrInvalidSignature)
+	}
+
+	// Nonces are only claimed for valid signatures, so nobody can use up
+	// the nonces of a client without its key.
+	fresh, err := v.nonces.Claim(r.Context(), key.ID+"|"+nonce, signedAt.Add(v.window))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check nonce: %w", err)
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: nonce has already been used", errors.ErrInvalidSignature)
+	}
+
+	return &entities.Principal{
+		KeyID:  SignaturePrincipalPrefix + key.ID,
+		Name:   key.Name,
+		Scopes: key.Scopes,
+		Tier:   key.Tier,
+	}, nil
+}
+
+func readSignedBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read body", errors.ErrInvalidSignature)
+	}
+	if len(body) > maxSignedBodyBytes {
+		return nil, fmt.Errorf("%w: body is larger than %d bytes", errors.ErrInvalidSignature, maxSignedBodyBytes)
+	}
+
+	r.Body = readCloser{Reader: bytes.NewReader(body), Closer: r.Body}
+	return body, nil
+}
@@ -2,28 +2,59 @@ package http
 
 import (
 	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
 	"ooliokartchallenge/internal/infrastruture/http/handlers"
 	"ooliokartchallenge/internal/infrastruture/http/middleware"
 )
 
 type Router struct {
-	productHandler *handlers.ProductHandler
-	orderHandler   *handlers.OrderHandler
-	authMiddleware *middleware.AuthMiddleware
-	corsMiddleware *middleware.CORSMiddleware
+	productHandler        *handlers.ProductHandler
+	orderHandler          *handlers.OrderHandler
+	cartHandler           *handlers.CartHandler
+	webhookHandler        *handlers.WebhookHandler
+	receiptHandler        *handlers.ReceiptHandler
+	exportHandler         *handlers.ExportHandler
+	apiKeyHandler         *handlers.APIKeyHandler
+	authMiddleware        *middleware.AuthMiddleware
+	corsMiddleware        *middleware.CORSMiddleware
+	idempotencyMiddleware *middleware.IdempotencyMiddleware
+	correlationMiddleware *middleware.CorrelationMiddleware
+	accessLogMiddleware   *middleware.AccessLogMiddleware
+	recoveryMiddleware    *middleware.RecoveryMiddleware
+	rateLimitMiddleware   *middleware.RateLimitMiddleware
 }
 
 func NewRouter(
 	productHandler *handlers.ProductHandler,
 	orderHandler *handlers.OrderHandler,
+	cartHandler *handlers.CartHandler,
+	webhookHandler *handlers.WebhookHandler,
+	receiptHandler *handlers.ReceiptHandler,
+	exportHandler *handlers.ExportHandler,
+	apiKeyHandler *handlers.APIKeyHandler,
 	authMiddleware *middleware.AuthMiddleware,
 	corsMiddleware *middleware.CORSMiddleware,
+	idempotencyMiddleware *middleware.IdempotencyMiddleware,
+	correlationMiddleware *middleware.CorrelationMiddleware,
+	accessLogMiddleware *middleware.AccessLogMiddleware,
+	recoveryMiddleware *middleware.RecoveryMiddleware,
+	rateLimitMiddleware *middleware.RateLimitMiddleware,
 ) *Router {
 	return &Router{
-		productHandler: productHandler,
-		orderHandler:   orderHandler,
-		authMiddleware: authMiddleware,
-		corsMiddleware: corsMiddleware,
+		productHandler:        productHandler,
+		orderHandler:          orderHandler,
+		cartHandler:           cartHandler,
+		webhookHandler:        webhookHandler,
+		receiptHandler:        receiptHandler,
+		exportHandler:         exportHandler,
+		apiKeyHandler:         apiKeyHandler,
+		authMiddleware:        authMiddleware,
+		corsMiddleware:        corsMiddleware,
+		idempotencyMiddleware: idempotencyMiddleware,
+		correlationMiddleware: correlationMiddleware,
+		accessLogMiddleware:   accessLogMiddleware,
+		recoveryMiddleware:    recoveryMiddleware,
+		rateLimitMiddleware:   rateLimitMiddleware,
 	}
 }
 
@@ -32,13 +63,59 @@ func (r *Router) SetupRoutes() http.Handler {
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /product", r.productHandler.ListProducts)
-	mux.HandleFunc("GET /product/{id}", r.productHandler.GetProduct)
+	// Rate limits apply after authentication so API keys are limited by
+	// key and everyone else by client IP. Protected routes are also limited
+	// by client IP before authentication, so failed attempts are limited.
+	public := func(handler http.Handler) http.Handler {
+		return r.rateLimitMiddleware.Limit(handler)
+	}
+	// protected accepts any valid key when scope is empty.
+	protected := func(scope string, handler http.Handler) http.Handler {
+		if scope != "" {
+			handler = r.authMiddleware.RequireScope(scope, handler)
+		}
+		return r.rateLimitMiddleware.LimitClientIP(r.authMiddleware.RequireAPIKey(r.rateLimitMiddleware.Limit(handler)))
+	}
 
-	protectedOrderHandler := r.authMiddleware.RequireAPIKey(http.HandlerFunc(r.orderHandler.PlaceOrder))
+	mux.Handle("GET /product", public(http.HandlerFunc(r.productHandler.ListProducts)))
+	mux.Handle("GET /product/{id}", public(http.HandlerFunc(r.productHandler.GetProduct)))
+
+	protectedOrderHandler := protected(entities.ScopeOrdersWrite, r.idempotencyMiddleware.Idempotent(http.HandlerFunc(r.orderHandler.PlaceOrder)))
 	mux.Handle("POST /order", protectedOrderHandler)
+	mux.Handle("POST /order/quote", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.orderHandler.QuoteOrder)))
+	mux.Handle("GET /order/{id}", protected("", http.HandlerFunc(r.orderHandler.GetOrder)))
+	mux.Handle("POST /order/{id}/transition", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.orderHandler.TransitionOrder)))
+	mux.Handle("POST /order/{id}/cancel", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.orderHandler.CancelOrder)))
+	mux.Handle("POST /order/{id}/refund", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.orderHandler.RefundOrder)))
+	mux.Handle("GET /order/{id}/receipt", protected("", http.HandlerFunc(r.receiptHandler.GetReceipt)))
+
+	mux.Handle("POST /cart", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.CreateCart)))
+	mux.Handle("GET /cart/{id}", protected("", http.HandlerFunc(r.cartHandler.GetCart)))
+	mux.Handle("POST /cart/{id}/items", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.AddItem)))
+	mux.Handle("PUT /cart/{id}/items/{productId}", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.UpdateItem)))
+	mux.Handle("DELETE /cart/{id}/items/{productId}", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.RemoveItem)))
+	mux.Handle("PUT /cart/{id}/coupon", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.ApplyCoupon)))
+	mux.Handle("DELETE /cart/{id}/coupon", protected(entities.ScopeOrdersWrite, http.HandlerFunc(r.cartHandler.RemoveCoupon)))
+	mux.Handle("POST /cart/{id}/checkout", protected(entities.ScopeOrdersWrite, r.idempotencyMiddleware.Idempotent(http.HandlerFunc(r.cartHandler.Checkout))))
+
+	mux.Handle("POST /webhooks", protected(entities.ScopeWebhooksAdmin, http.HandlerFunc(r.webhookHandler.CreateSubscription)))
+	mux.Handle("GET /webhooks", protected(entities.ScopeWebhooksAdmin, http.HandlerFunc(r.webhookHandler.ListSubscriptions)))
+	mux.Handle("DELETE /webhooks/{id}", protected(entities.ScopeWebhooksAdmin, http.HandlerFunc(r.webhookHandler.DeleteSubscription)))
+	mux.Handle("GET /webhooks/dead-letters", protected(entities.ScopeWebhooksAdmin, http.HandlerFunc(r.webhookHandler.ListDeadLetters)))
+	mux.Handle("POST /webhooks/dead-letters/{id}/replay", protected(entities.ScopeWebhooksAdmin, http.HandlerFunc(r.webhookHandler.ReplayDeadLetter)))
+
+	mux.Handle("GET /admin/orders/export", protected(entities.ScopeOrdersAdmin, http.HandlerFunc(r.exportHandler.ExportOrders)))
+
+	mux.Handle("POST /admin/api-keys", protected(entities.ScopeKeysAdmin, http.HandlerFunc(r.apiKeyHandler.CreateKey)))
+	mux.Handle("GET /admin/api-keys", protected(entities.ScopeKeysAdmin, http.HandlerFunc(r.apiKeyHandler.ListKeys)))
+	mux.Handle("GET /admin/api-keys/audit", protected(entities.ScopeKeysAdmin, http.HandlerFunc(r.apiKeyHandler.ListAuditLog)))
+	mux.Handle("POST /admin/api-keys/{id}/rotate", protected(entities.ScopeKeysAdmin, http.HandlerFunc(r.apiKeyHandler.RotateKey)))
+	mux.Handle("DELETE /admin/api-keys/{id}", protected(entities.ScopeKeysAdmin, http.HandlerFunc(r.apiKeyHandler.RevokeKey)))
 
 	finalHandler := r.corsMiddleware.EnableCORS(mux)
+	finalHandler = r.recoveryMiddleware.Recover(finalHandler)
+	finalHandler = r.accessLogMiddleware.LogRequests(finalHandler)
+	finalHandler = r.correlationMiddleware.Correlate(finalHandler)
 
 	return finalHandler
 }
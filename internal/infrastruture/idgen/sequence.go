@@ -0,0 +1,51 @@
+package idgen
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+const (
+	ticketsPerLetter = 999
+	ticketLetters    = 26
+)
+
+// DailySequencer hands out short ticket numbers such as "#A042" that restart
+// every day in the store's time zone. Numbers run A001-A999, then B001 and so
+// on, giving 25974 tickets per day.
+type DailySequencer struct {
+	location *time.Location
+	day      string
+	counter  int
+	mutex    sync.Mutex
+}
+
+func NewDailySequencer(location *time.Location) interfaces.OrderNumberSequencer {
+	return &DailySequencer{
+		location: location,
+	}
+}
+
+func (s *DailySequencer) Next(ctx context.Context, at time.Time) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	day := at.In(s.location).Format(time.DateOnly)
+	if day != s.day {
+		s.day = day
+		s.counter = 0
+	}
+
+	if s.counter >= ticketsPerLetter*ticketLetters {
+		return "", fmt.Errorf("daily order number sequence exhausted for %s", day)
+	}
+	s.counter++
+
+	letter := 'A' + rune((s.counter-1)/ticketsPerLetter)
+	number := (s.counter-1)%ticketsPerLetter + 1
+
+	return fmt.Sprintf("#%c%03d", letter, number), nil
+}
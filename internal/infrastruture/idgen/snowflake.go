@@ -0,0 +1,71 @@
+package idgen
+
+import (
+	"fmt"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	MaxSnowflakeNodeID    = 1<<snowflakeNodeBits - 1
+	maxSnowflakeSequence  = 1<<snowflakeSequenceBits - 1
+)
+
+// snowflakeEpoch keeps the 41 bit timestamp usable until roughly 2093.
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator produces 63 bit decimal IDs laid out as 41 bits of
+// milliseconds since snowflakeEpoch, 10 bits of node ID and a 12 bit
+// per-millisecond sequence. Every instance must use a distinct node ID.
+type SnowflakeGenerator struct {
+	nodeID     int64
+	now        func() time.Time
+	lastMillis int64
+	sequence   int64
+	mutex      sync.Mutex
+}
+
+func NewSnowflakeGenerator(nodeID int64) (interfaces.OrderIDGenerator, error) {
+	if nodeID < 0 || nodeID > MaxSnowflakeNodeID {
+		return nil, fmt.Errorf("snowflake node ID must be between 0 and %d, got %d", MaxSnowflakeNodeID, nodeID)
+	}
+
+	return &SnowflakeGenerator{
+		nodeID: nodeID,
+		now:    time.Now,
+	}, nil
+}
+
+func (g *SnowflakeGenerator) NewID() (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	millis := g.now().Sub(snowflakeEpoch).Milliseconds()
+
+	// If the clock stepped back, keep issuing from the last timestamp seen
+	// rather than risk repeating an ID.
+	if millis < g.lastMillis {
+		millis = g.lastMillis
+	}
+
+	if millis == g.lastMillis {
+		g.sequence++
+		if g.sequence > maxSnowflakeSequence {
+			for millis <= g.lastMillis {
+				time.Sleep(100 * time.Microsecond)
+				millis = g.now().Sub(snowflakeEpoch).Milliseconds()
+			}
+			g.sequence = 0
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMillis = millis
+
+	id := millis<<(snowflakeNodeBits+snowflakeSequenceBits) | g.nodeID<<snowflakeSequenceBits | g.sequence
+	return strconv.FormatInt(id, 10), nil
+}
@@ -0,0 +1,87 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"fmt"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator produces 26 character ULIDs: a 48 bit millisecond timestamp
+// followed by 80 random bits. IDs generated within the same millisecond
+// increment the random part so they stay strictly ordered.
+type ULIDGenerator struct {
+	now        func() time.Time
+	lastMillis uint64
+	lastRandom [10]byte
+	mutex      sync.Mutex
+}
+
+func NewULIDGenerator() interfaces.OrderIDGenerator {
+	return &ULIDGenerator{
+		now: time.Now,
+	}
+}
+
+func (g *ULIDGenerator) NewID() (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	millis := uint64(g.now().UnixMilli())
+
+	if millis <= g.lastMillis {
+		millis = g.lastMillis
+		if !incrementBytes(g.lastRandom[:]) {
+			return "", fmt.Errorf("ULID random component exhausted for millisecond %d", millis)
+		}
+	} else {
+		if _, err := rand.Read(g.lastRandom[:]); err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		g.lastMillis = millis
+	}
+
+	var raw [16]byte
+	for i := 0; i < 6; i++ {
+		raw[i] = byte(millis >> (40 - 8*i))
+	}
+	copy(raw[6:], g.lastRandom[:])
+
+	return encodeCrockford(raw), nil
+}
+
+// incrementBytes adds one to a big-endian number, reporting false on overflow.
+func incrementBytes(value []byte) bool {
+	for i := len(value) - 1; i >= 0; i-- {
+		value[i]++
+		if value[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCrockford writes 128 bits as 26 base32 characters, most significant first.
+func encodeCrockford(raw [16]byte) string {
+	encoded := make([]byte, 26)
+
+	// 130 bits of output for 128 bits of input: the first character only
+	// carries the top 3 bits.
+	var bitBuffer uint32
+	bitCount := 2
+	position := 0
+	for _, b := range raw {
+		bitBuffer = bitBuffer<<8 | uint32(b)
+		bitCount += 8
+		for bitCount >= 5 {
+			bitCount -= 5
+			encoded[position] = crockfordAlphabet[(bitBuffer>>bitCount)&0x1F]
+			position++
+		}
+	}
+
+	return string(encoded)
+}
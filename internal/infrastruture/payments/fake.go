@@ -0,0 +1,223 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+)
+
+// Magic card tokens understood by FakeGateway. Any other token is approved.
+const (
+	TokenApproved          = "tok_visa"
+	TokenDeclined          = "tok_decline"
+	TokenInsufficientFunds = "tok_insufficient_funds"
+	// TokenTimeout never answers; the call returns once its context ends.
+	TokenTimeout = "tok_timeout"
+	// Token3DS needs customer authentication. The first authorization is
+	// pending and retrying it for the same reference approves it.
+	Token3DS = "tok_3ds"
+	// Token3DSFailed is like Token3DS but the retry is declined.
+	Token3DSFailed = "tok_3ds_fail"
+)
+
+type fakeAuthorization struct {
+	id        string
+	reference string
+	token     string
+	amount    entities.Money
+	status    entities.PaymentStatus
+	captured  entities.Money
+	refunded  entities.Money
+}
+
+// FakeGateway is a deterministic in-process payment provider for local
+// development and tests. Its behaviour is chosen by the card token.
+type FakeGateway struct {
+	authorizations map[string]*fakeAuthorization
+	byReference    map[string]*fakeAuthorization
+	sequence       int
+	mutex          sync.Mutex
+}
+
+func NewFakeGateway() interfaces.PaymentGateway {
+	return &FakeGateway{
+		authorizations: make(map[string]*fakeAuthorization),
+		byReference:    make(map[string]*fakeAuthorization),
+	}
+}
+
+func (g *FakeGateway) Authorize(ctx context.Context, req entities.PaymentRequest) (*entities.PaymentAuthorization, error) {
+	if req.Token == TokenTimeout {
+		<-ctx.Done()
+		return nil, fmt.Errorf("%w: %v", errors.ErrPaymentTimeout, ctx.Err())
+	}
+	if err := ended(ctx); err != nil {
+		return nil, err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if auth, exists := g.byReference[req.Reference]; exists {
+		return g.retry(auth)
+	}
+
+	switch req.Token {
+	case TokenDeclined:
+		return nil, fmt.Errorf("%w: card was declined", errors.ErrPaymentDeclined)
+	case TokenInsufficientFunds:
+		return nil, fmt.Errorf("%w: insufficient funds", errors.ErrPaymentDeclined)
+	}
+
+	g.sequence++
+	auth := &fakeAuthorization{
+		id:        fmt.Sprintf("auth_%06d", g.sequence),
+		reference: req.Reference,
+		token:     req.Token,
+		amount:    req.Amount,
+		status:    entities.PaymentStatusAuthorized,
+		captured:  entities.Zero(req.Amount.Currency()),
+		refunded:  entities.Zero(req.Amount.Currency()),
+	}
+	if req.Token == Token3DS || req.Token == Token3DSFailed {
+		auth.status = entities.PaymentStatusPending
+	}
+
+	g.authorizations[auth.id] = auth
+	g.byReference[auth.reference] = auth
+
+	return toAuthorization(auth), nil
+}
+
+// retry answers a repeated authorization for the same reference, which is
+// how a pending 3DS challenge is completed.
+func (g *FakeGateway) retry(auth *fakeAuthorization) (*entities.PaymentAuthorization, error) {
+	if auth.status == entities.PaymentStatusPending {
+		if auth.token == Token3DSFailed {
+			auth.status = entities.PaymentStatusDeclined
+		} else {
+			auth.status = entities.PaymentStatusAuthorized
+		}
+	}
+
+	if auth.status == entities.PaymentStatusDeclined {
+		return nil, fmt.Errorf("%w: customer authentication failed", errors.ErrPaymentDeclined)
+	}
+
+	return toAuthorization(auth), nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, authorizationID string, amount entities.Money) error {
+	if err := ended(ctx); err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	auth, err := g.find(authorizationID)
+	if err != nil {
+		return err
+	}
+
+	if auth.status != entities.PaymentStatusAuthorized {
+		return fmt.Errorf("%w: cannot capture a %s authorization", errors.ErrPaymentFailed, auth.status)
+	}
+
+	if exceeds, err := amount.Compare(auth.amount); err != nil {
+		return err
+	} else if exceeds > 0 {
+		return fmt.Errorf("%w: capture of %s exceeds authorized %s", errors.ErrPaymentFailed, amount, auth.amount)
+	}
+
+	auth.status = entities.PaymentStatusCaptured
+	auth.captured = amount
+	return nil
+}
+
+func (g *FakeGateway) Void(ctx context.Context, authorizationID string) error {
+	if err := ended(ctx); err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	auth, err := g.find(authorizationID)
+	if err != nil {
+		return err
+	}
+
+	switch auth.status {
+	case entities.PaymentStatusVoided:
+		return nil
+	case entities.PaymentStatusAuthorized, entities.PaymentStatusPending:
+		auth.status = entities.PaymentStatusVoided
+		return nil
+	default:
+		return fmt.Errorf("%w: cannot void a %s authorization", errors.ErrPaymentFailed, auth.status)
+	}
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, authorizationID string, amount entities.Money) error {
+	if err := ended(ctx); err != nil {
+		return err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	auth, err := g.find(authorizationID)
+	if err != nil {
+		return err
+	}
+
+	if auth.status != entities.PaymentStatusCaptured {
+		return fmt.Errorf("%w: cannot refund a %s authorization", errors.ErrPaymentFailed, auth.status)
+	}
+
+	refunded, err := auth.refunded.Add(amount)
+	if err != nil {
+		return err
+	}
+
+	if exceeds, err := refunded.Compare(auth.captured); err != nil {
+		return err
+	} else if exceeds > 0 {
+		return fmt.Errorf("%w: refunds of %s exceed captured %s", errors.ErrPaymentFailed, refunded, auth.captured)
+	}
+
+	auth.refunded = refunded
+	return nil
+}
+
+// ended fails calls made after their context has ended, as a real
+// provider would never see them.
+func ended(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrPaymentTimeout, err)
+	}
+	return nil
+}
+
+func (g *FakeGateway) find(authorizationID string) (*fakeAuthorization, error) {
+	auth, exists := g.authorizations[authorizationID]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown authorization '%s'", errors.ErrPaymentFailed, authorizationID)
+	}
+	return auth, nil
+}
+
+func toAuthorization(auth *fakeAuthorization) *entities.PaymentAuthorization {
+	authorization := &entities.PaymentAuthorization{
+		ID:     auth.id,
+		Status: auth.status,
+	}
+	if auth.status == entities.PaymentStatusPending {
+		authorization.NextAction = "https://3ds.fake.local/challenge/" + auth.id
+	}
+	return authorization
+}
@@ -0,0 +1,18 @@
+package receipts
+
+// ESC/POS control sequences understood by Epson compatible thermal
+// printers.
+const (
+	// escInit resets the printer to its power-on settings.
+	escInit        = "\x1b@"
+	escAlignLeft   = "\x1ba\x00"
+	escAlignCenter = "\x1ba\x01"
+	escBoldOn      = "\x1bE\x01"
+	escBoldOff     = "\x1bE\x00"
+	// escTallOn doubles the character height only, so the number of
+	// columns per line is unchanged.
+	escTallOn  = "\x1d!\x01"
+	escTallOff = "\x1d!\x00"
+	// escFeedAndCut feeds the paper past the cutter and makes a partial cut.
+	escFeedAndCut = "\x1dVB\x03"
+)
@@ -0,0 +1,224 @@
+// Package receipts renders order receipts from templates. The built-in
+// templates can be replaced by files of the same name in an override
+// directory.
+package receipts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"unicode/utf8"
+)
+
+// Template file names, also used to look templates up in the override
+// directory.
+const (
+	HTMLTemplate   = "receipt.html.tmpl"
+	TextTemplate   = "receipt.text.tmpl"
+	ESCPOSTemplate = "receipt.escpos.tmpl"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Characters per line of font A on common thermal printers.
+var columnsPerWidth = map[int]int{
+	entities.PaperWidth58mm: 32,
+	entities.PaperWidth80mm: 48,
+}
+
+type TemplateRenderer struct {
+	html   *htmltemplate.Template
+	text   *texttemplate.Template
+	escpos *texttemplate.Template
+}
+
+// NewTemplateRenderer parses every template up front so a broken override
+// is reported at startup rather than on the first receipt. An empty
+// overrideDir uses the built-in templates only.
+func NewTemplateRenderer(overrideDir string) (interfaces.ReceiptRenderer, error) {
+	renderer := &TemplateRenderer{}
+
+	source, err := readTemplate(overrideDir, HTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if renderer.html, err = htmltemplate.New(HTMLTemplate).Funcs(htmltemplate.FuncMap(commonFuncs())).Parse(source); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", HTMLTemplate, err)
+	}
+
+	if renderer.text, err = parseLayoutTemplate(overrideDir, TextTemplate); err != nil {
+		return nil, err
+	}
+	if renderer.escpos, err = parseLayoutTemplate(overrideDir, ESCPOSTemplate); err != nil {
+		return nil, err
+	}
+
+	return renderer, nil
+}
+
+func (r *TemplateRenderer) Render(receipt *entities.Receipt, format entities.ReceiptFormat, paperWidth int) (*entities.RenderedReceipt, error) {
+	columns, ok := columnsPerWidth[paperWidth]
+	if !ok {
+		return nil, fmt.Errorf("unsupported paper width %dmm", paperWidth)
+	}
+
+	var body bytes.Buffer
+	var contentType string
+	var err error
+
+	switch format {
+	case entities.ReceiptFormatHTML:
+		contentType = "text/html; charset=utf-8"
+		err = r.html.Execute(&body, receipt)
+	case entities.ReceiptFormatText:
+		contentType = "text/plain; charset=utf-8"
+		err = executeLayout(r.text, &body, receipt, layoutFuncs(columns, false))
+	case entities.ReceiptFormatESCPOS:
+		contentType = "application/octet-stream"
+		err = executeLayout(r.escpos, &body, receipt, layoutFuncs(columns, true))
+	default:
+		return nil, fmt.Errorf("unsupported receipt format '%s'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.RenderedReceipt{
+		ContentType: contentType,
+		Body:        body.Bytes(),
+	}, nil
+}
+
+// readTemplate returns the override for name when overrideDir has one and
+// the built-in template otherwise.
+func readTemplate(overrideDir, name string) (string, error) {
+	if overrideDir != "" {
+		data, err := os.ReadFile(filepath.Join(overrideDir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read receipt template: %w", err)
+		}
+	}
+
+	data, err := fs.ReadFile(builtinTemplates, "templates/"+name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read built-in receipt template: %w", err)
+	}
+	return string(data), nil
+}
+
+// parseLayoutTemplate parses a column based template. Its layout helpers
+// depend on the paper width, so they are bound again for every render.
+func parseLayoutTemplate(overrideDir, name string) (*texttemplate.Template, error) {
+	source, err := readTemplate(overrideDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := texttemplate.New(name).Funcs(commonFuncs()).Funcs(layoutFuncs(0, false)).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func executeLayout(tmpl *texttemplate.Template, body *bytes.Buffer, receipt *entities.Receipt, funcs texttemplate.FuncMap) error {
+	bound, err := tmpl.Clone()
+	if err != nil {
+		return fmt.Errorf("failed to prepare %s: %w", tmpl.Name(), err)
+	}
+
+	if err := bound.Funcs(funcs).Execute(body, receipt); err != nil {
+		return fmt.Errorf("failed to execute %s: %w", tmpl.Name(), err)
+	}
+	return nil
+}
+
+func commonFuncs() texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"money": func(amount entities.Money) string {
+			return amount.String()
+		},
+	}
+}
+
+// layoutFuncs lays text out in fixed width columns. For ESC/POS the text is
+// also narrowed to ASCII, which every printer code page agrees on, and the
+// printer commands emit their control sequences; for plain text they emit
+// nothing.
+func layoutFuncs(columns int, escpos bool) texttemplate.FuncMap {
+	clean := func(text string) string { return text }
+	if escpos {
+		clean = toASCII
+	}
+
+	command := func(sequence string) func() string {
+		return func() string {
+			if !escpos {
+				return ""
+			}
+			return sequence
+		}
+	}
+
+	return texttemplate.FuncMap{
+		"width": func() int { return columns },
+		"rule": func() string {
+			return strings.Repeat("-", columns)
+		},
+		"center": func(text string) string {
+			text = truncate(clean(text), columns)
+			return strings.Repeat(" ", (columns-utf8.RuneCountInString(text))/2) + text
+		},
+		// row puts left and right on one line with right flush to the
+		// margin, wrapping left onto its own line when both do not fit.
+		"row": func(left, right string) string {
+			left, right = clean(left), truncate(clean(right), columns)
+			leftWidth, rightWidth := utf8.RuneCountInString(left), utf8.RuneCountInString(right)
+			if gap := columns - leftWidth - rightWidth; gap >= 1 {
+				return left + strings.Repeat(" ", gap) + right
+			}
+			return truncate(left, columns) + "\n" + strings.Repeat(" ", columns-rightWidth) + right
+		},
+		"text": func(text string) string {
+			return truncate(clean(text), columns)
+		},
+
+		"init":        command(escInit),
+		"alignLeft":   command(escAlignLeft),
+		"alignCenter": command(escAlignCenter),
+		"boldOn":      command(escBoldOn),
+		"boldOff":     command(escBoldOff),
+		"tallOn":      command(escTallOn),
+		"tallOff":     command(escTallOff),
+		"cut":         command(escFeedAndCut),
+	}
+}
+
+func truncate(text string, columns int) string {
+	runes := []rune(text)
+	if len(runes) <= columns {
+		return text
+	}
+	return string(runes[:columns])
+}
+
+func toASCII(text string) string {
+	return strings.Map(func(char rune) rune {
+		if char < 0x20 || char > 0x7e {
+			return '?'
+		}
+		return char
+	}, text)
+}
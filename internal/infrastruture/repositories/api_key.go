@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APIKeyRepository keeps API keys in memory and, when given a path, loads
+// them from and mirrors them to a JSON file.
+type APIKeyRepository struct {
+	path  string
+	keys  map[string]*entities.APIKey
+	mutex sync.Mutex
+}
+
+// NewAPIKeyRepository loads the keys in path, failing on any invalid key so
+// a typo cannot silently lock callers out. An empty path keeps keys in
+// memory only.
+func NewAPIKeyRepository(path string) (interfaces.APIKeyRepository, error) {
+	repo := &APIKeyRepository{
+		path: path,
+		keys: make(map[string]*entities.APIKey),
+	}
+
+	if path == "" {
+		return repo, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var keys []*entities.APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys %s: %w", path, err)
+	}
+	for _, key := range keys {
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid API key in %s: %w", path, err)
+		}
+		if _, duplicate := repo.keys[key.ID]; duplicate {
+			return nil, fmt.Errorf("duplicate API key ID '%s' in %s", key.ID, path)
+		}
+		repo.keys[key.ID] = key
+	}
+
+	return repo, nil
+}
+
+// Save never stores the secret of a newly issued key, only its hash.
+func (r *APIKeyRepository) Save(ctx context.Context, key *entities.APIKey) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := key.Clone()
+	stored.Secret = ""
+	return r.replace(stored)
+}
+
+func (r *APIKeyRepository) GetByID(ctx context.Context, id string) (*entities.APIKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key, exists := r.keys[id]
+	if !exists {
+		return nil, errors.ErrAPIKeyNotFound
+	}
+
+	return key.Clone(), nil
+}
+
+func (r *APIKeyRepository) Update(ctx context.Context, id string, fn func(key *entities.APIKey) error) (*entities.APIKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, exists := r.keys[id]
+	if !exists {
+		return nil, errors.ErrAPIKeyNotFound
+	}
+
+	working := stored.Clone()
+	if err := fn(working); err != nil {
+		return nil, err
+	}
+	working.Secret = ""
+
+	if err := r.replace(working.Clone()); err != nil {
+		return nil, err
+	}
+	return working, nil
+}
+
+// Touch only changes the key, and rewrites the file, the first time it is
+// used in each minute, so busy keys do not rewrite the file per request.
+func (r *APIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, exists := r.keys[id]
+	if !exists {
+		return errors.ErrAPIKeyNotFound
+	}
+
+	minute := at.UTC().Truncate(time.Minute)
+	if stored.LastUsedAt != nil && !stored.LastUsedAt.Before(minute) {
+		return nil
+	}
+
+	touched := stored.Clone()
+	touched.LastUsedAt = &minute
+	return r.replace(touched)
+}
+
+func (r *APIKeyRepository) List(ctx context.Context) ([]*entities.APIKey, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.sorted(), nil
+}
+
+// replace stores key and persists, restoring the previous key when the file
+// cannot be written.
+func (r *APIKeyRepository) replace(key *entities.APIKey) error {
+	previous, existed := r.keys[key.ID]
+	r.keys[key.ID] = key
+
+	if err := r.persist(); err != nil {
+		if existed {
+			r.keys[key.ID] = previous
+		} else {
+			delete(r.keys, key.ID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// sorted returns copies of the keys, oldest first.
+func (r *APIKeyRepository) sorted() []*entities.APIKey {
+	keys := make([]*entities.APIKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key.Clone())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// persist rewrites the whole file through a temporary file so a crash never
+// leaves a half written key file behind.
+func (r *APIKeyRepository) persist() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode API keys: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create API key directory: %w", err)
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// APIKeyAuditRepository keeps the API key audit log in memory and, when
+// given a path, appends every entry to a file as one JSON object per line.
+type APIKeyAuditRepository struct {
+	file    *os.File
+	entries []entities.APIKeyAuditEntry
+	mutex   sync.Mutex
+}
+
+// NewAPIKeyAuditRepository loads the entries already in path and opens it
+// for appending. An empty path keeps the log in memory only.
+func NewAPIKeyAuditRepository(path string) (interfaces.APIKeyAuditRepository, error) {
+	repo := &APIKeyAuditRepository{}
+
+	if path == "" {
+		return repo, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create API key audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open API key audit log: %w", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry entities.APIKeyAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to parse API key audit log %s line %d: %w", path, line, err)
+		}
+		repo.entries = append(repo.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read API key audit log: %w", err)
+	}
+
+	repo.file = file
+	return repo, nil
+}
+
+// Append writes and syncs the entry before keeping it, so an operation is
+// never reported as audited when it is not on disk.
+func (r *APIKeyAuditRepository) Append(ctx context.Context, entry entities.APIKeyAuditEntry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode API key audit entry: %w", err)
+		}
+
+		if _, err := r.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write API key audit log: %w", err)
+		}
+		if err := r.file.Sync(); err != nil {
+			return fmt.Errorf("failed to write API key audit log: %w", err)
+		}
+	}
+
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *APIKeyAuditRepository) List(ctx context.Context) ([]entities.APIKeyAuditEntry, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.Clone(r.entries), nil
+}
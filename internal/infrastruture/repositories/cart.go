@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+const cartSweepInterval = time.Minute
+
+type CartRepository struct {
+	carts     map[string]*entities.Cart
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewCartRepository() interfaces.CartRepository {
+	return &CartRepository{
+		carts:     make(map[string]*entities.Cart),
+		lastSweep: time.Now(),
+	}
+}
+
+func (r *CartRepository) Save(ctx context.Context, cart *entities.Cart) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sweepExpired(time.Now())
+
+	if _, exists := r.carts[cart.ID]; exists {
+		return fmt.Errorf("cart %s already exists", cart.ID)
+	}
+
+	r.carts[cart.ID] = cart.Clone()
+	return nil
+}
+
+func (r *CartRepository) GetByID(ctx context.Context, id string) (*entities.Cart, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cart, err := r.live(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return cart.Clone(), nil
+}
+
+func (r *CartRepository) Update(ctx context.Context, id string, fn func(cart *entities.Cart) error) (*entities.Cart, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, err := r.live(id)
+	if err != nil {
+		return nil, err
+	}
+
+	working := stored.Clone()
+	if err := fn(working); err != nil {
+		return nil, err
+	}
+	working.Version = stored.Version + 1
+
+	r.carts[id] = working.Clone()
+	return working, nil
+}
+
+func (r *CartRepository) Delete(ctx context.Context, id string) (*entities.Cart, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cart, err := r.live(id)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(r.carts, id)
+	return cart.Clone(), nil
+}
+
+// live returns the stored cart unless it is missing or has expired.
+func (r *CartRepository) live(id string) (*entities.Cart, error) {
+	cart, exists := r.carts[id]
+	if !exists {
+		return nil, errors.ErrCartNotFound
+	}
+
+	if cart.IsExpired(time.Now()) {
+		delete(r.carts, id)
+		return nil, errors.ErrCartNotFound
+	}
+
+	return cart, nil
+}
+
+func (r *CartRepository) sweepExpired(now time.Time) {
+	if now.Sub(r.lastSweep) < cartSweepInterval {
+		return
+	}
+
+	for id, cart := range r.carts {
+		if cart.IsExpired(now) {
+			delete(r.carts, id)
+		}
+	}
+	r.lastSweep = now
+}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+const idempotencySweepInterval = time.Minute
+
+type IdempotencyRepository struct {
+	records   map[string]*entities.IdempotencyRecord
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewIdempotencyRepository() interfaces.IdempotencyRepository {
+	return &IdempotencyRepository{
+		records:   make(map[string]*entities.IdempotencyRecord),
+		lastSweep: time.Now(),
+	}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key, requestHash string, ttl time.Duration) (*entities.IdempotencyRecord, bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.sweepExpired(now)
+
+	if existing, exists := r.records[key]; exists && !existing.IsExpired(now) {
+		recordCopy := *existing
+		return &recordCopy, false, nil
+	}
+
+	r.records[key] = &entities.IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	record, exists := r.records[key]
+	if !exists {
+		return nil
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.records, key)
+	return nil
+}
+
+// sweepExpired drops expired records at most once per sweep interval so the
+// map does not grow without bound.
+func (r *IdempotencyRepository) sweepExpired(now time.Time) {
+	if now.Sub(r.lastSweep) < idempotencySweepInterval {
+		return
+	}
+
+	for key, record := range r.records {
+		if record.IsExpired(now) {
+			delete(r.records, key)
+		}
+	}
+	r.lastSweep = now
+}
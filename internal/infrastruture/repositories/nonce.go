@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+// NonceRepository remembers at most maxNonces nonces. When it is full the
+// oldest nonce is forgotten even if it has not expired, so maxNonces must
+// cover the signed requests expected within one expiry period for replays
+// to be caught.
+type NonceRepository struct {
+	maxNonces int
+	nonces    map[string]*list.Element
+	// order holds nonces oldest first. Every nonce lives for about the
+	// same time, so the front is also the first to expire.
+	order *list.List
+	mutex sync.Mutex
+}
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+func NewNonceRepository(maxNonces int) interfaces.NonceStore {
+	return &NonceRepository{
+		maxNonces: maxNonces,
+		nonces:    make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+func (r *NonceRepository) Claim(ctx context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for oldest := r.order.Front(); oldest != nil && !now.Before(oldest.Value.(*nonceEntry).expiresAt); oldest = r.order.Front() {
+		r.forget(oldest)
+	}
+
+	if _, seen := r.nonces[nonce]; seen {
+		return false, nil
+	}
+
+	if r.order.Len() > 0 && r.order.Len() >= r.maxNonces {
+		r.forget(r.order.Front())
+	}
+
+	r.nonces[nonce] = r.order.PushBack(&nonceEntry{nonce: nonce, expiresAt: expiresAt})
+	return true, nil
+}
+
+func (r *NonceRepository) forget(element *list.Element) {
+	r.order.Remove(element)
+	delete(r.nonces, element.Value.(*nonceEntry).nonce)
+}
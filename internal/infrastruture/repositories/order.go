@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sort"
+	"sync"
+	"time"
+)
+
+type OrderRepository struct {
+	orders map[string]*entities.Order
+	outbox interfaces.OutboxRepository
+	mutex  sync.RWMutex
+}
+
+func NewOrderRepository(outbox interfaces.OutboxRepository) interfaces.OrderRepository {
+	return &OrderRepository{
+		orders: make(map[string]*entities.Order),
+		outbox: outbox,
+	}
+}
+
+func (r *OrderRepository) Save(ctx context.Context, order *entities.Order) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.orders[order.ID]; exists {
+		return fmt.Errorf("order %s already exists", order.ID)
+	}
+
+	if err := r.appendEvents(ctx, order); err != nil {
+		return err
+	}
+
+	r.orders[order.ID] = order.Clone()
+	return nil
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, id string) (*entities.Order, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	order, exists := r.orders[id]
+	if !exists {
+		return nil, errors.ErrOrderNotFound
+	}
+
+	return order.Clone(), nil
+}
+
+func (r *OrderRepository) Update(ctx context.Context, id string, fn func(order *entities.Order) error) (*entities.Order, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, exists := r.orders[id]
+	if !exists {
+		return nil, errors.ErrOrderNotFound
+	}
+
+	working := stored.Clone()
+	if err := fn(working); err != nil {
+		return nil, err
+	}
+
+	if err := r.appendEvents(ctx, working); err != nil {
+		return nil, err
+	}
+
+	r.orders[id] = working.Clone()
+	return working, nil
+}
+
+func (r *OrderRepository) ForEachCreatedBetween(ctx context.Context, from, to time.Time, fn func(order *entities.Order) error) error {
+	type created struct {
+		id string
+		at time.Time
+	}
+
+	r.mutex.RLock()
+	var matches []created
+	for id, order := range r.orders {
+		if !order.CreatedAt.Before(from) && order.CreatedAt.Before(to) {
+			matches = append(matches, created{id: id, at: order.CreatedAt})
+		}
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].at.Equal(matches[j].at) {
+			return matches[i].id < matches[j].id
+		}
+		return matches[i].at.Before(matches[j].at)
+	})
+
+	// Orders are fetched one by one so writers are not held up while the
+	// caller streams.
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		order, err := r.GetByID(ctx, match.id)
+		if err != nil {
+			continue
+		}
+
+		if err := fn(order); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendEvents moves the events recorded on order to the outbox. It is
+// called with the write lock held so the events and the order are stored
+// together.
+func (r *OrderRepository) appendEvents(ctx context.Context, order *entities.Order) error {
+	events := order.TakeEvents()
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := r.outbox.Append(ctx, events); err != nil {
+		return fmt.Errorf("failed to write order events to the outbox: %w", err)
+	}
+
+	return nil
+}
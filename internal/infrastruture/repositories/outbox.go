@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+// OutboxRepository keeps undispatched events in memory, in the order they
+// were appended.
+type OutboxRepository struct {
+	entries []*entities.OutboxEntry
+	mutex   sync.Mutex
+}
+
+func NewOutboxRepository() interfaces.OutboxRepository {
+	return &OutboxRepository{}
+}
+
+func (r *OutboxRepository) Append(ctx context.Context, events []entities.OrderEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now().UTC()
+	for _, event := range events {
+		r.entries = append(r.entries, &entities.OutboxEntry{
+			Event:     event,
+			CreatedAt: now,
+		})
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) Pending(ctx context.Context, limit int) ([]entities.OutboxEntry, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if limit <= 0 || limit > len(r.entries) {
+		limit = len(r.entries)
+	}
+
+	pending := make([]entities.OutboxEntry, limit)
+	for i, entry := range r.entries[:limit] {
+		pending[i] = *entry
+	}
+
+	return pending, nil
+}
+
+// MarkDispatched is a no-op for events no longer in the outbox, so a
+// redelivered event can be acknowledged twice.
+func (r *OutboxRepository) MarkDispatched(ctx context.Context, eventID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, entry := range r.entries {
+		if entry.Event.ID == eventID {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *OutboxRepository) MarkFailed(ctx context.Context, eventID string, cause error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.Event.ID == eventID {
+			entry.Attempts++
+			entry.LastError = cause.Error()
+			return nil
+		}
+	}
+
+	return nil
+}
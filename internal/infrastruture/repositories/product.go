@@ -39,7 +39,7 @@ func getSampleProducts() []entities.Product {
 		{
 			ID:       "10",
 			Name:     "iPhone 15 Pro",
-			Price:    999.99,
+			Price:    entities.MustParseMoney("999.99", entities.DefaultCurrency),
 			Category: "Phone",
 			Image: entities.Image{
 				Thumbnail: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
@@ -51,7 +51,7 @@ func getSampleProducts() []entities.Product {
 		{
 			ID:       "11",
 			Name:     "Samsung Galaxy S24",
-			Price:    849.99,
+			Price:    entities.MustParseMoney("849.99", entities.DefaultCurrency),
 			Category: "Phone",
 			Image: entities.Image{
 				Thumbnail: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
@@ -63,7 +63,7 @@ func getSampleProducts() []entities.Product {
 		{
 			ID:       "12",
 			Name:     "iPad Pro 12.9",
-			Price:    1099.99,
+			Price:    entities.MustParseMoney("1099.99", entities.DefaultCurrency),
 			Category: "Tablet",
 			Image: entities.Image{
 				Thumbnail: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
@@ -75,7 +75,7 @@ func getSampleProducts() []entities.Product {
 		{
 			ID:       "13",
 			Name:     "MacBook Pro 14",
-			Price:    1999.99,
+			Price:    entities.MustParseMoney("1999.99", entities.DefaultCurrency),
 			Category: "Laptop",
 			Image: entities.Image{
 				Thumbnail: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
@@ -83,11 +83,12 @@ func getSampleProducts() []entities.Product {
 				Tablet:    "https://orderfoodonline.deno.dev/public/images/image-waffle-tablet.jpg",
 				Desktop:   "https://orderfoodonline.deno.dev/public/images/image-waffle-desktop.jpg",
 			},
+			MaxQuantity: 3,
 		},
 		{
 			ID:       "14",
 			Name:     "Dell XPS 13",
-			Price:    1299.99,
+			Price:    entities.MustParseMoney("1299.99", entities.DefaultCurrency),
 			Category: "Laptop",
 			Image: entities.Image{
 				Thumbnail: "https://orderfoodonline.deno.dev/public/images/image-waffle-thumbnail.jpg",
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+)
+
+type PromoRedemptionRepository struct {
+	maxRedemptions int
+	redemptions    map[string]map[string]bool
+	mutex          sync.Mutex
+}
+
+// NewPromoRedemptionRepository tracks which orders redeemed each code. A
+// maxRedemptions of 0 allows unlimited redemptions.
+func NewPromoRedemptionRepository(maxRedemptions int) interfaces.PromoRedemptionRepository {
+	return &PromoRedemptionRepository{
+		maxRedemptions: maxRedemptions,
+		redemptions:    make(map[string]map[string]bool),
+	}
+}
+
+func (r *PromoRedemptionRepository) Redeem(ctx context.Context, code, orderID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	orders := r.redemptions[code]
+	if orders[orderID] {
+		return nil
+	}
+
+	if r.maxRedemptions > 0 && len(orders) >= r.maxRedemptions {
+		return fmt.Errorf("%w: code '%s'", errors.ErrPromoCodeExhausted, code)
+	}
+
+	if orders == nil {
+		orders = make(map[string]bool)
+		r.redemptions[code] = orders
+	}
+	orders[orderID] = true
+
+	return nil
+}
+
+func (r *PromoRedemptionRepository) Release(ctx context.Context, code, orderID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.redemptions[code], orderID)
+	return nil
+}
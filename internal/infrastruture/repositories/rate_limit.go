@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+	"time"
+)
+
+// RateLimitRepository holds at most maxBuckets token buckets, evicting the
+// least recently used. An evicted bucket starts full when it is next used,
+// which only ever errs towards allowing a request.
+type RateLimitRepository struct {
+	maxBuckets int
+	buckets    map[string]*list.Element
+	recency    *list.List
+	mutex      sync.Mutex
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+func NewRateLimitRepository(maxBuckets int) interfaces.RateLimitStore {
+	return &RateLimitRepository{
+		maxBuckets: maxBuckets,
+		buckets:    make(map[string]*list.Element),
+		recency:    list.New(),
+	}
+}
+
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit entities.RateLimit, now time.Time) (entities.RateLimitDecision, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	capacity := float64(limit.Requests)
+	perSecond := capacity / limit.Period.Seconds()
+
+	bucket := r.bucket(key, capacity, now)
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*perSecond)
+		bucket.updated = now
+	}
+
+	decision := entities.RateLimitDecision{Limit: limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((1 - bucket.tokens) / perSecond)
+	}
+
+	decision.Remaining = int(bucket.tokens)
+	decision.Reset = secondsToDuration((capacity - bucket.tokens) / perSecond)
+
+	return decision, nil
+}
+
+// bucket returns the bucket for key, marking it most recently used.
+func (r *RateLimitRepository) bucket(key string, capacity float64, now time.Time) *tokenBucket {
+	if element, exists := r.buckets[key]; exists {
+		r.recency.MoveToFront(element)
+		return element.Value.(*tokenBucket)
+	}
+
+	if r.recency.Len() > 0 && r.recency.Len() >= r.maxBuckets {
+		oldest := r.recency.Back()
+		r.recency.Remove(oldest)
+		delete(r.buckets, oldest.Value.(*tokenBucket).key)
+	}
+
+	bucket := &tokenBucket{key: key, tokens: capacity, updated: now}
+	r.buckets[key] = r.recency.PushFront(bucket)
+	return bucket
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
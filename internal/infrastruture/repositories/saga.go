@@ -0,0 +1,232 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const sagaSweepInterval = time.Minute
+
+// SagaRepository keeps saga logs in memory and, when given a path, appends
+// every saved record to a file as one JSON object per line so unfinished
+// sagas survive a restart. The last line of a saga wins. Finished sagas are
+// dropped once they are older than the retention period, and the file is
+// compacted to one line per saga at startup and whenever some are dropped.
+type SagaRepository struct {
+	path      string
+	file      *os.File
+	retention time.Duration
+	records   map[string]*entities.SagaRecord
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewSagaRepository loads any sagas previously written to path. An empty
+// path keeps the log in memory only.
+func NewSagaRepository(path string, retention time.Duration) (interfaces.SagaRepository, error) {
+	now := time.Now()
+	repo := &SagaRepository{
+		path:      path,
+		retention: retention,
+		records:   make(map[string]*entities.SagaRecord),
+		lastSweep: now,
+	}
+
+	if path == "" {
+		return repo, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read saga log: %w", err)
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var record entities.SagaRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// A crash while appending leaves the last line cut short. It
+			// was never acknowledged, so it is dropped.
+			if len(bytes.TrimSpace(bytes.Join(lines[i+1:], nil))) == 0 {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse saga log %s line %d: %w", path, i+1, err)
+		}
+		repo.records[record.ID] = &record
+	}
+
+	repo.dropFinished(now)
+	if err := repo.compact(); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+func (r *SagaRepository) Save(ctx context.Context, record *entities.SagaRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := record.Clone()
+	if err := r.append(stored); err != nil {
+		return err
+	}
+
+	r.records[record.ID] = stored
+	r.sweepFinished(time.Now())
+
+	return nil
+}
+
+func (r *SagaRepository) GetByID(ctx context.Context, id string) (*entities.SagaRecord, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	record, exists := r.records[id]
+	if !exists {
+		return nil, errors.ErrSagaNotFound
+	}
+
+	return record.Clone(), nil
+}
+
+func (r *SagaRepository) ListUnfinished(ctx context.Context) ([]*entities.SagaRecord, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var unfinished []*entities.SagaRecord
+	for _, record := range r.records {
+		if !record.IsFinished() {
+			unfinished = append(unfinished, record.Clone())
+		}
+	}
+
+	sort.Slice(unfinished, func(i, j int) bool {
+		return unfinished[i].CreatedAt.Before(unfinished[j].CreatedAt)
+	})
+
+	return unfinished, nil
+}
+
+// sweepFinished drops expired finished sagas at most once per sweep
+// interval and compacts the file when any were dropped. A failed
+// compaction leaves the longer file in place to be compacted next time.
+func (r *SagaRepository) sweepFinished(now time.Time) {
+	if now.Sub(r.lastSweep) < sagaSweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	if r.dropFinished(now) > 0 {
+		_ = r.compact()
+	}
+}
+
+// dropFinished removes finished sagas older than the retention period and
+// returns how many it removed.
+func (r *SagaRepository) dropFinished(now time.Time) int {
+	if r.retention <= 0 {
+		return 0
+	}
+
+	dropped := 0
+	for id, record := range r.records {
+		if record.IsFinished() && now.Sub(record.UpdatedAt) > r.retention {
+			delete(r.records, id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// append writes and syncs the record before it is kept, so a step is never
+// reported as logged when it is not on disk.
+func (r *SagaRepository) append(record *entities.SagaRecord) error {
+	if r.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga log: %w", err)
+	}
+
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+
+	return nil
+}
+
+// compact rewrites the log with one line per saga through a temporary file
+// so a crash never leaves a half written log behind. The temporary file
+// becomes the file appended to from then on.
+func (r *SagaRepository) compact() error {
+	if r.path == "" {
+		return nil
+	}
+
+	records := make([]*entities.SagaRecord, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	var data bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode saga log: %w", err)
+		}
+		data.Write(append(line, '\n'))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create saga log directory: %w", err)
+	}
+
+	tmp := r.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+	if _, err := file.Write(data.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+
+	if err := os.Rename(tmp, r.path); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write saga log: %w", err)
+	}
+
+	if r.file != nil {
+		r.file.Close()
+	}
+	r.file = file
+
+	return nil
+}
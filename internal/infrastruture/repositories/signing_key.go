@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+)
+
+// SigningKeyRepository holds the signing keys of server-to-server clients,
+// read once from a JSON file.
+type SigningKeyRepository struct {
+	keys map[string]*entities.SigningKey
+}
+
+// NewSigningKeyRepository loads the keys in path, failing on any invalid
+// key. An empty path holds no keys.
+func NewSigningKeyRepository(path string) (interfaces.SigningKeyRepository, error) {
+	repo := &SigningKeyRepository{
+		keys: make(map[string]*entities.SigningKey),
+	}
+
+	if path == "" {
+		return repo, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing keys: %w", err)
+	}
+
+	var keys []*entities.SigningKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse signing keys %s: %w", path, err)
+	}
+	for _, key := range keys {
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid signing key in %s: %w", path, err)
+		}
+		if _, duplicate := repo.keys[key.ID]; duplicate {
+			return nil, fmt.Errorf("duplicate signing key ID '%s' in %s", key.ID, path)
+		}
+		repo.keys[key.ID] = key
+	}
+
+	return repo, nil
+}
+
+func (r *SigningKeyRepository) GetByID(ctx context.Context, id string) (*entities.SigningKey, error) {
+	key, exists := r.keys[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: unknown key '%s'", errors.ErrInvalidSignature, id)
+	}
+
+	clone := *key
+	return &clone, nil
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sync"
+)
+
+// StockRepository keeps available quantities in memory. Products without a
+// stock level are not tracked and never run out.
+type StockRepository struct {
+	available    map[string]int
+	reservations map[string][]entities.OrderItem
+	mutex        sync.Mutex
+}
+
+func NewStockRepository(levels map[string]int) interfaces.StockRepository {
+	available := make(map[string]int, len(levels))
+	for productID, quantity := range levels {
+		available[productID] = quantity
+	}
+
+	return &StockRepository{
+		available:    available,
+		reservations: make(map[string][]entities.OrderItem),
+	}
+}
+
+// SampleStockLevels returns starting stock for the sample catalog.
+func SampleStockLevels() map[string]int {
+	return map[string]int{
+		"10": 500,
+		"11": 500,
+		"12": 200,
+		"13": 50,
+		"14": 100,
+	}
+}
+
+func (r *StockRepository) Reserve(ctx context.Context, orderID string, items []entities.OrderItem) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.reservations[orderID]; exists {
+		return nil
+	}
+
+	for idx, item := range items {
+		available, tracked := r.available[item.ProductID]
+		if tracked && available < item.Quantity {
+			return fmt.Errorf("%w: item %d requests %d of product '%s', %d available", errors.ErrInsufficientStock, idx, item.Quantity, item.ProductID, available)
+		}
+	}
+
+	for _, item := range items {
+		if _, tracked := r.available[item.ProductID]; tracked {
+			r.available[item.ProductID] -= item.Quantity
+		}
+	}
+
+	r.reservations[orderID] = append([]entities.OrderItem(nil), items...)
+	return nil
+}
+
+func (r *StockRepository) Release(ctx context.Context, orderID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, item := range r.reservations[orderID] {
+		if _, tracked := r.available[item.ProductID]; tracked {
+			r.available[item.ProductID] += item.Quantity
+		}
+	}
+
+	delete(r.reservations, orderID)
+	return nil
+}
@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"context"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"sort"
+	"sync"
+)
+
+type WebhookRepository struct {
+	subscriptions map[string]*entities.WebhookSubscription
+	mutex         sync.RWMutex
+}
+
+func NewWebhookRepository() interfaces.WebhookRepository {
+	return &WebhookRepository{
+		subscriptions: make(map[string]*entities.WebhookSubscription),
+	}
+}
+
+func (r *WebhookRepository) Save(ctx context.Context, subscription *entities.WebhookSubscription) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *subscription
+	stored.EventTypes = append([]string(nil), subscription.EventTypes...)
+	r.subscriptions[subscription.ID] = &stored
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, owner, id string) (*entities.WebhookSubscription, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.Owner != owner {
+		return nil, errors.ErrWebhookNotFound
+	}
+
+	found := *subscription
+	found.EventTypes = append([]string(nil), subscription.EventTypes...)
+	return &found, nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context, owner string) ([]entities.WebhookSubscription, error) {
+	return r.filter(func(subscription *entities.WebhookSubscription) bool {
+		return subscription.Owner == owner
+	}), nil
+}
+
+func (r *WebhookRepository) ListForEvent(ctx context.Context, eventType string) ([]entities.WebhookSubscription, error) {
+	return r.filter(func(subscription *entities.WebhookSubscription) bool {
+		return subscription.Wants(eventType)
+	}), nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, owner, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	subscription, exists := r.subscriptions[id]
+	if !exists || subscription.Owner != owner {
+		return errors.ErrWebhookNotFound
+	}
+
+	delete(r.subscriptions, id)
+	return nil
+}
+
+func (r *WebhookRepository) filter(keep func(subscription *entities.WebhookSubscription) bool) []entities.WebhookSubscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	matched := []entities.WebhookSubscription{}
+	for _, subscription := range r.subscriptions {
+		if keep(subscription) {
+			found := *subscription
+			found.EventTypes = append([]string(nil), subscription.EventTypes...)
+			matched = append(matched, found)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+
+	return matched
+}
+
+// WebhookDeadLetterRepository keeps deliveries that ran out of retries
+// until they are replayed. It holds at most maxEntries, dropping the oldest.
+type WebhookDeadLetterRepository struct {
+	maxEntries int
+	deliveries []*entities.WebhookDelivery
+	mutex      sync.Mutex
+}
+
+func NewWebhookDeadLetterRepository(maxEntries int) interfaces.WebhookDeadLetterRepository {
+	return &WebhookDeadLetterRepository{
+		maxEntries: maxEntries,
+	}
+}
+
+func (r *WebhookDeadLetterRepository) Add(ctx context.Context, delivery *entities.WebhookDelivery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *delivery
+	r.deliveries = append(r.deliveries, &stored)
+
+	if r.maxEntries > 0 && len(r.deliveries) > r.maxEntries {
+		r.deliveries = append([]*entities.WebhookDelivery(nil), r.deliveries[len(r.deliveries)-r.maxEntries:]...)
+	}
+
+	return nil
+}
+
+func (r *WebhookDeadLetterRepository) List(ctx context.Context, owner string) ([]entities.WebhookDelivery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deliveries := []entities.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Owner == owner {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookDeadLetterRepository) Take(ctx context.Context, owner, id string) (*entities.WebhookDelivery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, delivery := range r.deliveries {
+		if delivery.ID == id && delivery.Owner == owner {
+			r.deliveries = append(r.deliveries[:i], r.deliveries[i+1:]...)
+			return delivery, nil
+		}
+	}
+
+	return nil, errors.ErrDeadLetterNotFound
+}
@@ -0,0 +1,323 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTPrincipalPrefix starts the key ID of principals authenticated by a
+// bearer token, so they never collide with API key IDs.
+const JWTPrincipalPrefix = "jwt:"
+
+// JWTOptions are the claims every token must carry. An empty Issuer or
+// Audience is not checked.
+type JWTOptions struct {
+	Issuer   string
+	Audience string
+	// ClockSkew is how far exp and nbf may be off from the local clock.
+	ClockSkew time.Duration
+}
+
+// JWTVerifier checks compact JWS tokens signed with HS256, RS256 or ES256
+// against the keys of a JWKS file.
+type JWTVerifier struct {
+	keys    []jwk
+	options JWTOptions
+}
+
+// NewJWTVerifier loads the keys in jwksPath, a JSON Web Key Set. HS256 keys
+// are "oct" keys, RS256 keys "RSA" and ES256 keys "EC" on P-256.
+func NewJWTVerifier(jwksPath string, options JWTOptions) (interfaces.TokenVerifier, error) {
+	data, err := os.ReadFile(jwksPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS %s: %w", jwksPath, err)
+	}
+
+	verifier := &JWTVerifier{options: options}
+	for i, raw := range set.Keys {
+		key, err := parseJWK(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d in JWKS %s: %w", i, jwksPath, err)
+		}
+		if key.use != "" && key.use != "sig" {
+			continue
+		}
+		verifier.keys = append(verifier.keys, key)
+	}
+	if len(verifier.keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no signing keys", jwksPath)
+	}
+
+	return verifier, nil
+}
+
+// Verify maps the sub claim to the principal's key ID, name to its name,
+// the space separated scope claim, or the scp array, to its scopes and tier
+// to its rate limit tier. Scopes this API does not know are dropped.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*entities.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", errors.ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", errors.ErrInvalidToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", errors.ErrInvalidToken)
+	}
+	if !v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("%w: signature mismatch", errors.ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", errors.ErrInvalidToken)
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidToken, err)
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Subject
+	}
+
+	return &entities.Principal{
+		KeyID:  JWTPrincipalPrefix + claims.Subject,
+		Name:   name,
+		Scopes: claims.scopes(),
+		Tier:   claims.Tier,
+	}, nil
+}
+
+// verifySignature tries the key named by kid, or every key for the
+// algorithm when the token names none. Keys are only used with the
+// algorithm of their type, so a public RSA key can never act as an HMAC
+// secret.
+func (v *JWTVerifier) verifySignature(alg, kid, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	for _, key := range v.keys {
+		if kid != "" && key.kid != kid {
+			continue
+		}
+		if key.alg() != alg {
+			continue
+		}
+
+		switch alg {
+		case "HS256":
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write([]byte(signingInput))
+			if hmac.Equal(signature, mac.Sum(nil)) {
+				return true
+			}
+		case "RS256":
+			if rsa.VerifyPKCS1v15(key.rsa, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		case "ES256":
+			// JWS signatures are the two 32 byte integers back to back
+			// rather than ASN.1.
+			if len(signature) != 64 {
+				continue
+			}
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(key.ecdsa, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (v *JWTVerifier) validate(claims jwtClaims) error {
+	now := time.Now()
+
+	if claims.Subject == "" {
+		return fmt.Errorf("token has no subject")
+	}
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("token has no expiry")
+	}
+	if !now.Before(time.Unix(*claims.ExpiresAt, 0).Add(v.options.ClockSkew)) {
+		return fmt.Errorf("token has expired")
+	}
+	if claims.NotBefore != nil && now.Before(time.Unix(*claims.NotBefore, 0).Add(-v.options.ClockSkew)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if v.options.Issuer != "" && claims.Issuer != v.options.Issuer {
+		return fmt.Errorf("token has issuer '%s'", claims.Issuer)
+	}
+	if v.options.Audience != "" && !slices.Contains(claims.Audience, v.options.Audience) {
+		return fmt.Errorf("token is not for audience '%s'", v.options.Audience)
+	}
+
+	return nil
+}
+
+type jwtClaims struct {
+	Subject   string     `json:"sub"`
+	Issuer    string     `json:"iss"`
+	Audience  stringList `json:"aud"`
+	ExpiresAt *int64     `json:"exp"`
+	NotBefore *int64     `json:"nbf"`
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	Scp       stringList `json:"scp"`
+	Tier      string     `json:"tier"`
+}
+
+func (c jwtClaims) scopes() []string {
+	granted := strings.Fields(c.Scope)
+	for _, scp := range c.Scp {
+		granted = append(granted, strings.Fields(scp)...)
+	}
+
+	scopes := []string{}
+	for _, scope := range granted {
+		if entities.IsAPIKeyScope(scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// stringList accepts a single string or an array of strings, as both aud
+// and scp may be either.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func decodeSegment(segment string, target any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// jwk is a verification key from a JWKS file. Exactly one of secret, rsa
+// and ecdsa is set, matching kty.
+type jwk struct {
+	kid string
+	kty string
+	use string
+
+	secret []byte
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+}
+
+func (k jwk) alg() string {
+	switch k.kty {
+	case "oct":
+		return "HS256"
+	case "RSA":
+		return "RS256"
+	case "EC":
+		return "ES256"
+	}
+	return ""
+}
+
+func parseJWK(raw json.RawMessage) (jwk, error) {
+	var fields struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		K   string `json:"k"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return jwk{}, err
+	}
+
+	key := jwk{kid: fields.Kid, kty: fields.Kty, use: fields.Use}
+	if fields.Alg != "" && fields.Alg != key.alg() {
+		return jwk{}, fmt.Errorf("kty '%s' cannot be used with alg '%s'", fields.Kty, fields.Alg)
+	}
+
+	switch fields.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(fields.K)
+		if err != nil || len(secret) < 32 {
+			return jwk{}, fmt.Errorf("oct key needs k of at least 32 bytes")
+		}
+		key.secret = secret
+
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(fields.N)
+		e, errE := base64.RawURLEncoding.DecodeString(fields.E)
+		if errN != nil || errE != nil || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return jwk{}, fmt.Errorf("RSA key needs n of at least 2048 bits and e")
+		}
+		key.rsa = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	case "EC":
+		x, errX := base64.RawURLEncoding.DecodeString(fields.X)
+		y, errY := base64.RawURLEncoding.DecodeString(fields.Y)
+		if fields.Crv != "P-256" || errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return jwk{}, fmt.Errorf("EC key needs crv P-256 and 32 byte x and y")
+		}
+		public, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return jwk{}, fmt.Errorf("EC key is not a point on P-256")
+		}
+		key.ecdsa = public
+
+	default:
+		return jwk{}, fmt.Errorf("unsupported kty '%s'", fields.Kty)
+	}
+
+	return key, nil
+}
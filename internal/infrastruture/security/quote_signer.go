@@ -0,0 +1,64 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"strings"
+)
+
+// QuoteSigner issues compact "payload.signature" tokens where the payload is
+// base64url JSON and the signature is HMAC-SHA256 over the encoded payload.
+type QuoteSigner struct {
+	secret []byte
+}
+
+func NewQuoteSigner(secret []byte) interfaces.QuoteSigner {
+	return &QuoteSigner{
+		secret: secret,
+	}
+}
+
+func (s *QuoteSigner) Sign(claims entities.QuoteClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quote claims: %w", err)
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + s.signature(encodedPayload), nil
+}
+
+func (s *QuoteSigner) Verify(token string) (*entities.QuoteClaims, error) {
+	encodedPayload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, fmt.Errorf("%w: malformed token", errors.ErrInvalidQuoteToken)
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.signature(encodedPayload))) {
+		return nil, fmt.Errorf("%w: signature mismatch", errors.ErrInvalidQuoteToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", errors.ErrInvalidQuoteToken)
+	}
+
+	var claims entities.QuoteClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", errors.ErrInvalidQuoteToken)
+	}
+
+	return &claims, nil
+}
+
+func (s *QuoteSigner) signature(encodedPayload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
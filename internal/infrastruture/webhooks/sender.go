@@ -0,0 +1,101 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), so receivers
+// can reject both tampered and stale deliveries.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Payload is the JSON body POSTed to subscribers.
+type Payload struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       *entities.Order `json:"data"`
+}
+
+type HTTPSender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewHTTPSender(timeout time.Duration) interfaces.WebhookSender {
+	return &HTTPSender{
+		client: &http.Client{Timeout: timeout},
+		now:    time.Now,
+	}
+}
+
+func (s *HTTPSender) Send(ctx context.Context, subscription *entities.WebhookSubscription, delivery *entities.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Payload{
+		ID:         delivery.Event.ID,
+		Type:       delivery.Event.Type,
+		OccurredAt: delivery.Event.OccurredAt,
+		Data:       delivery.Event.Order,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errors.ErrWebhookDeliveryFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "oolio-kart-webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errors.ErrWebhookDeliveryFailed, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w: receiver answered %d", errors.ErrWebhookDeliveryFailed, resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign computes the signature header value for a delivery body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time. Receivers written in
+// Go can use it directly.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -2,27 +2,173 @@ package internal
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"ooliokartchallenge/internal/application/outbox"
+	"ooliokartchallenge/internal/application/saga"
 	"ooliokartchallenge/internal/application/services"
 	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/errors"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/eventsinks"
 	httpInfra "ooliokartchallenge/internal/infrastruture/http"
 	"ooliokartchallenge/internal/infrastruture/http/handlers"
 	"ooliokartchallenge/internal/infrastruture/http/middleware"
+	"ooliokartchallenge/internal/infrastruture/idgen"
+	"ooliokartchallenge/internal/infrastruture/payments"
+	"ooliokartchallenge/internal/infrastruture/receipts"
 	"ooliokartchallenge/internal/infrastruture/repositories"
+	"ooliokartchallenge/internal/infrastruture/security"
+	"ooliokartchallenge/internal/infrastruture/webhooks"
 	"ooliokartchallenge/pkg/logger"
 )
 
 // TestServer holds the test server and dependencies
 type TestServer struct {
-	server  *httptest.Server
-	handler http.Handler
+	server      *httptest.Server
+	handler     http.Handler
+	subscribers *eventsinks.Subscribers
+	eventLog    string
+	accessLog   *lockedBuffer
+	payments    *slowRefundGateway
+	stock       *failingStockRepository
+
+	apiKeyService interfaces.APIKeyService
+}
+
+// Test API keys: apitest has every scope, the others exercise how keys are
+// turned away.
+const (
+	readOnlyAPIKey = "readonly-test-key"
+	writerAPIKey   = "writer-test-key"
+	disabledAPIKey = "disabled-test-key"
+	expiredAPIKey  = "expired-test-key"
+)
+
+// loadTestAPIKeys writes a key file and loads it the way the server does.
+func loadTestAPIKeys(t *testing.T) interfaces.APIKeyRepository {
+	t.Helper()
+
+	expired := time.Now().Add(-time.Hour)
+	keys := []entities.APIKey{
+		{ID: middleware.APIKeyID("apitest"), Name: "test", Hash: entities.HashAPIKey("apitest"), Scopes: entities.AllAPIKeyScopes(), Enabled: true},
+		{ID: "key_readonly", Name: "read only", Hash: entities.HashAPIKey(readOnlyAPIKey), Enabled: true},
+		{ID: "key_writer", Name: "writer", Hash: entities.HashAPIKey(writerAPIKey), Scopes: []string{entities.ScopeOrdersWrite}, Enabled: true},
+		{ID: "key_disabled", Name: "disabled", Hash: entities.HashAPIKey(disabledAPIKey), Scopes: []string{entities.ScopeOrdersWrite}},
+		{ID: "key_expired", Name: "expired", Hash: entities.HashAPIKey(expiredAPIKey), Scopes: []string{entities.ScopeOrdersWrite}, Enabled: true, ExpiresAt: &expired},
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatalf("Failed to encode API keys: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write API keys: %v", err)
+	}
+
+	repo, err := repositories.NewAPIKeyRepository(path)
+	if err != nil {
+		t.Fatalf("Failed to load API keys: %v", err)
+	}
+	return repo
+}
+
+// lockedBuffer collects log output written from concurrent requests.
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// slowRefundGateway holds every refund at the provider for a moment, so
+// concurrent refunds of one order overlap, and counts them per authorization.
+type slowRefundGateway struct {
+	interfaces.PaymentGateway
+	mutex   sync.Mutex
+	refunds map[string]int
+}
+
+func (g *slowRefundGateway) Refund(ctx context.Context, authorizationID string, amount entities.Money) error {
+	time.Sleep(20 * time.Millisecond)
+
+	g.mutex.Lock()
+	g.refunds[authorizationID]++
+	g.mutex.Unlock()
+
+	return g.PaymentGateway.Refund(ctx, authorizationID, amount)
+}
+
+func (g *slowRefundGateway) RefundCount(authorizationID string) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.refunds[authorizationID]
+}
+
+// failingStockRepository cannot release reservations while failing is set.
+type failingStockRepository struct {
+	interfaces.StockRepository
+	failing atomic.Bool
+}
+
+func (r *failingStockRepository) Release(ctx context.Context, orderID string) error {
+	if r.failing.Load() {
+		return fmt.Errorf("stock store unavailable")
+	}
+	return r.StockRepository.Release(ctx, orderID)
+}
+
+// failingAuditRepository refuses new entries while failing is set, like an
+// audit log on a full disk.
+type failingAuditRepository struct {
+	interfaces.APIKeyAuditRepository
+	failing atomic.Bool
+}
+
+func (r *failingAuditRepository) Append(ctx context.Context, entry entities.APIKeyAuditEntry) error {
+	if r.failing.Load() {
+		return fmt.Errorf("audit log unavailable")
+	}
+	return r.APIKeyAuditRepository.Append(ctx, entry)
 }
 
 // setupTestServer creates a test server with all dependencies
@@ -32,6 +178,12 @@ func setupTestServer(t *testing.T) *TestServer {
 
 	// Initialize repositories
 	productRepo := repositories.NewProductRepository()
+	outboxRepo := repositories.NewOutboxRepository()
+	orderRepo := repositories.NewOrderRepository(outboxRepo)
+	idempotencyRepo := repositories.NewIdempotencyRepository()
+	cartRepo := repositories.NewCartRepository()
+	stockRepo := &failingStockRepository{StockRepository: repositories.NewStockRepository(repositories.SampleStockLevels())}
+	redemptionRepo := repositories.NewPromoRedemptionRepository(0)
 
 	// Create test coupon files for promo repository
 	couponFiles := []string{
@@ -42,28 +194,118 @@ func setupTestServer(t *testing.T) *TestServer {
 	promoRepo := repositories.NewPromoRepository(couponFiles)
 
 	// Initialize services
-	promoService := services.NewPromoService(promoRepo)
+	promoService := services.NewPromoService(promoRepo, redemptionRepo)
 	productService := services.NewProductService(productRepo)
-	orderService := services.NewOrderService(productRepo, promoService)
+	quoteSigner := security.NewQuoteSigner([]byte("test-quote-secret"))
+	orderPolicy := entities.DefaultOrderPolicy()
+	orderPolicy.PaymentTimeout = 100 * time.Millisecond
+	sagaRepo, err := repositories.NewSagaRepository("", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create saga repository: %v", err)
+	}
+	paymentGateway := &slowRefundGateway{PaymentGateway: payments.NewFakeGateway(), refunds: make(map[string]int)}
+	webhookService := services.NewWebhookService(
+		repositories.NewWebhookRepository(),
+		repositories.NewWebhookDeadLetterRepository(100),
+		webhooks.NewHTTPSender(time.Second),
+		entities.WebhookRetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+	)
+	orderService := services.NewOrderService(productRepo, orderRepo, stockRepo, promoService, quoteSigner, idgen.NewULIDGenerator(), idgen.NewDailySequencer(time.UTC), paymentGateway, sagaRepo, orderPolicy, appLogger)
+	cartService := services.NewCartService(cartRepo, productRepo, orderService, promoService, time.Hour)
+
+	receiptRenderer, err := receipts.NewTemplateRenderer("")
+	if err != nil {
+		t.Fatalf("Failed to load receipt templates: %v", err)
+	}
+	receiptService := services.NewReceiptService(orderRepo, receiptRenderer, entities.ReceiptPolicy{
+		Store:        entities.StoreDetails{Name: "Test Kart", Address: "1 Test Street", Footer: "Thank you!"},
+		Taxes:        []entities.TaxRate{{Name: "GST", BasisPoints: 1000}},
+		RoundingMode: orderPolicy.RoundingMode,
+		Location:     time.UTC,
+		PaperWidth:   entities.PaperWidth80mm,
+	})
+
+	// Publish order events from the outbox
+	subscribers := eventsinks.NewSubscribers()
+	eventLogPath := filepath.Join(t.TempDir(), "events.jsonl")
+	eventLog, err := eventsinks.NewJSONLSink(eventLogPath)
+	if err != nil {
+		t.Fatalf("Failed to open event log: %v", err)
+	}
+	dispatcher := outbox.NewDispatcher(outboxRepo, 10*time.Millisecond, 100, subscribers, eventLog, eventsinks.NewPublisherSink("webhooks", webhookService))
+	dispatcher.Start()
+	t.Cleanup(func() {
+		_ = dispatcher.Drain(context.Background())
+		_ = eventLog.Close()
+	})
 
 	// Initialize handlers
 	productHandler := handlers.NewProductHandler(productService, appLogger)
 	orderHandler := handlers.NewOrderHandler(orderService, appLogger)
+	cartHandler := handlers.NewCartHandler(cartService, appLogger)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, appLogger)
+	receiptHandler := handlers.NewReceiptHandler(receiptService, appLogger)
+	exportHandler := handlers.NewExportHandler(services.NewOrderExportService(orderRepo, time.UTC), appLogger)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(appLogger)
-	corsMiddleware := middleware.NewCORSMiddleware()
+	apiKeyAuditRepo, err := repositories.NewAPIKeyAuditRepository("")
+	if err != nil {
+		t.Fatalf("Failed to create API key audit log: %v", err)
+	}
+	apiKeyService := services.NewAPIKeyService(loadTestAPIKeys(t), apiKeyAuditRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, appLogger)
+	authMiddleware := middleware.NewAuthMiddleware(apiKeyService, nil, nil, nil, appLogger)
+	corsMiddleware, err := middleware.NewCORSMiddleware(middleware.CORSOptions{
+		AllowedOrigins:   []string{"https://shop.example.com", "https://*.kiosk.example.com"},
+		AllowCredentials: true,
+		ExposedHeaders:   []string{"X-Request-ID", "Retry-After"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CORS middleware: %v", err)
+	}
+	correlationMiddleware := middleware.NewCorrelationMiddleware()
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(idempotencyRepo, time.Hour, appLogger)
+
+	accessLog := &lockedBuffer{}
+	trustedProxies, _ := middleware.ParseTrustedProxies("127.0.0.1")
+	accessLogMiddleware, err := middleware.NewAccessLogMiddleware(middleware.AccessLogOptions{
+		TrustedProxies:    trustedProxies,
+		Headers:           []string{"User-Agent", "api_key"},
+		RedactHeaders:     []string{"api_key"},
+		LogBody:           true,
+		RedactFields:      []string{"couponCode"},
+		SuccessSampleRate: 1,
+	}, &logger.Logger{Logger: slog.New(slog.NewJSONHandler(accessLog, nil))})
+	if err != nil {
+		t.Fatalf("Failed to create access log middleware: %v", err)
+	}
+
+	recoveryMiddleware, err := middleware.NewRecoveryMiddleware("", appLogger)
+	if err != nil {
+		t.Fatalf("Failed to create recovery middleware: %v", err)
+	}
+
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(repositories.NewRateLimitRepository(1000), middleware.RateLimitOptions{
+		Policy: entities.RateLimitPolicy{Rules: []entities.RateLimitRule{{Limit: entities.RateLimit{Requests: 100000, Period: time.Minute}}}},
+	}, appLogger)
 
 	// Initialize router
-	router := httpInfra.NewRouter(productHandler, orderHandler, authMiddleware, corsMiddleware)
+	router := httpInfra.NewRouter(productHandler, orderHandler, cartHandler, webhookHandler, receiptHandler, exportHandler, apiKeyHandler, authMiddleware, corsMiddleware, idempotencyMiddleware, correlationMiddleware, accessLogMiddleware, recoveryMiddleware, rateLimitMiddleware)
 	handler := router.SetupRoutes()
 
 	// Create test server
 	server := httptest.NewServer(handler)
 
 	return &TestServer{
-		server:  server,
-		handler: handler,
+		server:      server,
+		handler:     handler,
+		subscribers: subscribers,
+		eventLog:    eventLogPath,
+		accessLog:   accessLog,
+		payments:    paymentGateway,
+		stock:       stockRepo,
+
+		apiKeyService: apiKeyService,
 	}
 }
 
@@ -80,6 +322,86 @@ func TestOpenAPICompliance(t *testing.T) {
 		testOrderEndpoints(t, testServer)
 	})
 
+	t.Run("Order Lifecycle", func(t *testing.T) {
+		testOrderLifecycle(t, testServer)
+	})
+
+	t.Run("Idempotent Orders", func(t *testing.T) {
+		testIdempotentOrders(t, testServer)
+	})
+
+	t.Run("Order Quotes", func(t *testing.T) {
+		testOrderQuotes(t, testServer)
+	})
+
+	t.Run("Cart Endpoints", func(t *testing.T) {
+		testCartEndpoints(t, testServer)
+	})
+
+	t.Run("Cancellation And Refunds", func(t *testing.T) {
+		testCancellationAndRefunds(t, testServer)
+	})
+
+	t.Run("Payments", func(t *testing.T) {
+		testPayments(t, testServer)
+	})
+
+	t.Run("Sagas", func(t *testing.T) {
+		testSagas(t)
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		testWebhooks(t, testServer)
+	})
+
+	t.Run("Outbox", func(t *testing.T) {
+		testOutbox(t, testServer)
+	})
+
+	t.Run("Receipts", func(t *testing.T) {
+		testReceipts(t, testServer)
+	})
+
+	t.Run("Order Export", func(t *testing.T) {
+		testOrderExport(t, testServer)
+	})
+
+	t.Run("API Keys", func(t *testing.T) {
+		testAPIKeys(t, testServer)
+	})
+
+	t.Run("Bearer Tokens", func(t *testing.T) {
+		testBearerTokens(t, testServer)
+	})
+
+	t.Run("Request Signing", func(t *testing.T) {
+		testRequestSigning(t, testServer)
+	})
+
+	t.Run("CORS", func(t *testing.T) {
+		testCORS(t, testServer)
+	})
+
+	t.Run("Validation Problems", func(t *testing.T) {
+		testValidationProblems(t, testServer)
+	})
+
+	t.Run("Correlation IDs", func(t *testing.T) {
+		testCorrelationIDs(t, testServer)
+	})
+
+	t.Run("Access Log", func(t *testing.T) {
+		testAccessLog(t, testServer)
+	})
+
+	t.Run("Panic Recovery", func(t *testing.T) {
+		testPanicRecovery(t)
+	})
+
+	t.Run("Rate Limiting", func(t *testing.T) {
+		testRateLimiting(t, testServer)
+	})
+
 	t.Run("Error Response Format", func(t *testing.T) {
 		testErrorResponseFormat(t, testServer)
 	})
@@ -236,6 +558,77 @@ func testOrderEndpoints(t *testing.T, testServer *TestServer) {
 		validateOrderSchema(t, order)
 	})
 
+	t.Run("POST /order - Promo code discount is exact", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"10","quantity":1}]}`)
+
+		if order.Discounts.String() != "100.00" {
+			t.Errorf("Expected discounts 100.00, got %s", order.Discounts)
+		}
+		if order.Total.String() != "899.99" {
+			t.Errorf("Expected total 899.99, got %s", order.Total)
+		}
+		if order.Currency != "USD" {
+			t.Errorf("Expected currency USD, got '%s'", order.Currency)
+		}
+	})
+
+	t.Run("Only the catalog currency can be configured", func(t *testing.T) {
+		for _, currency := range []string{"USD", " usd "} {
+			if parsed, err := entities.ParseCurrency(currency); err != nil || parsed != "USD" {
+				t.Errorf("Expected '%s' to be accepted as USD, got '%s' (%v)", currency, parsed, err)
+			}
+		}
+		for _, currency := range []string{"EUR", "JPY", "XYZ", ""} {
+			if _, err := entities.ParseCurrency(currency); err == nil {
+				t.Errorf("Expected currency '%s' to be rejected", currency)
+			}
+		}
+	})
+
+	t.Run("POST /order - Duplicate items are merged into reconciled lines", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"11","quantity":1},{"productId":"13","quantity":1},{"productId":"11","quantity":2}]}`)
+
+		if len(order.Lines) != 2 || len(order.Items) != 2 || len(order.Products) != 2 {
+			t.Fatalf("Expected 2 merged lines, got %d lines, %d items", len(order.Lines), len(order.Items))
+		}
+
+		line := order.Lines[0]
+		if line.ProductID != "11" || line.Quantity != 3 || line.Product.ID != "11" {
+			t.Errorf("Unexpected first line: %+v", line)
+		}
+		if line.UnitPrice.String() != "849.99" || line.Subtotal.String() != "2549.97" {
+			t.Errorf("Unexpected first line pricing: unit %s, subtotal %s", line.UnitPrice, line.Subtotal)
+		}
+
+		if err := order.Reconcile(); err != nil {
+			t.Errorf("Order lines do not reconcile: %v", err)
+		}
+	})
+
+	t.Run("POST /order - Quantity limits report each offending item", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order", `{"items":[{"productId":"10","quantity":1},{"productId":"13","quantity":4},{"productId":"11","quantity":2147483648}]}`)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+		}
+
+		var errorResp errors.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+
+		details := errorResp.Error.Details
+		if len(details) != 2 {
+			t.Fatalf("Expected 2 field errors, got %+v", details)
+		}
+		for i, expectedIndex := range []int{1, 2} {
+			if details[i].Field != "quantity" || details[i].Index == nil || *details[i].Index != expectedIndex {
+				t.Errorf("Unexpected field error %d: %+v", i, details[i])
+			}
+		}
+	})
+
 	t.Run("POST /order - Invalid JSON", func(t *testing.T) {
 		req, _ := http.NewRequest("POST", testServer.server.URL+"/order", strings.NewReader("invalid json"))
 		req.Header.Set("Content-Type", "application/json")
@@ -280,6 +673,2486 @@ func testOrderEndpoints(t *testing.T, testServer *TestServer) {
 	})
 }
 
+// testOrderLifecycle validates order status transitions and the recorded timeline
+func testOrderLifecycle(t *testing.T, testServer *TestServer) {
+	order := placeTestOrder(t, testServer, `{"items":[{"productId":"10","quantity":1}]}`)
+
+	if order.Status != entities.OrderStatusPending {
+		t.Errorf("Expected new order status 'pending', got '%s'", order.Status)
+	}
+	if len(order.History) != 1 {
+		t.Fatalf("Expected 1 history entry, got %d", len(order.History))
+	}
+
+	t.Run("POST /order/{id}/transition - Legal transition", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order/"+order.ID+"/transition", `{"status":"confirmed","reason":"payment received"}`)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		var updated entities.Order
+		if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if updated.Status != entities.OrderStatusConfirmed {
+			t.Errorf("Expected status 'confirmed', got '%s'", updated.Status)
+		}
+		if len(updated.History) != 2 {
+			t.Fatalf("Expected 2 history entries, got %d", len(updated.History))
+		}
+
+		last := updated.History[1]
+		if last.From != entities.OrderStatusPending || last.To != entities.OrderStatusConfirmed {
+			t.Errorf("Unexpected history entry: %+v", last)
+		}
+		if last.Actor == "" || last.At.IsZero() {
+			t.Errorf("History entry missing actor or timestamp: %+v", last)
+		}
+	})
+
+	t.Run("POST /order/{id}/transition - Illegal transition", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order/"+order.ID+"/transition", `{"status":"completed"}`)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", resp.StatusCode)
+		}
+
+		validateErrorResponse(t, resp)
+	})
+
+	t.Run("POST /order/{id}/transition - Unknown status", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order/"+order.ID+"/transition", `{"status":"lost"}`)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+
+		validateErrorResponse(t, resp)
+	})
+
+	t.Run("GET /order/{id} - Unknown order", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "GET", "/order/order_missing", "")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+
+		validateErrorResponse(t, resp)
+	})
+}
+
+// testIdempotentOrders validates that retries with an Idempotency-Key replay the first response
+func testIdempotentOrders(t *testing.T, testServer *TestServer) {
+	sendOrder := func(key, body string) (*http.Response, entities.Order) {
+		req, _ := http.NewRequest("POST", testServer.server.URL+"/order", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("api_key", "apitest")
+		req.Header.Set("Idempotency-Key", key)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var order entities.Order
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return resp, order
+	}
+
+	body := `{"items":[{"productId":"11","quantity":1}]}`
+	first, firstOrder := sendOrder("retry-key-1", body)
+	if first.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", first.StatusCode)
+	}
+
+	t.Run("Retry with same body replays response", func(t *testing.T) {
+		resp, order := sendOrder("retry-key-1", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if order.ID != firstOrder.ID {
+			t.Errorf("Expected replayed order %s, got %s", firstOrder.ID, order.ID)
+		}
+		if resp.Header.Get("Idempotent-Replayed") != "true" {
+			t.Error("Expected Idempotent-Replayed header on retry")
+		}
+	})
+
+	t.Run("Retry with different body conflicts", func(t *testing.T) {
+		resp, _ := sendOrder("retry-key-1", `{"items":[{"productId":"11","quantity":2}]}`)
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Different key creates new order", func(t *testing.T) {
+		resp, order := sendOrder("retry-key-2", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if order.ID == firstOrder.ID {
+			t.Error("Expected a new order for a different idempotency key")
+		}
+	})
+
+	t.Run("Oversized body is rejected", func(t *testing.T) {
+		oversized := `{"items":[{"productId":"11","quantity":1}],"padding":"` + strings.Repeat("x", 1<<20) + `"}`
+		resp, _ := sendOrder("retry-key-3", oversized)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Panicking handler releases the key", func(t *testing.T) {
+		recoveryMiddleware, err := middleware.NewRecoveryMiddleware("", logger.New())
+		if err != nil {
+			t.Fatalf("Failed to create recovery middleware: %v", err)
+		}
+		idempotencyMiddleware := middleware.NewIdempotencyMiddleware(repositories.NewIdempotencyRepository(), time.Hour, logger.New())
+
+		calls := 0
+		server := httptest.NewServer(recoveryMiddleware.Recover(idempotencyMiddleware.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				panic("first attempt fails")
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))))
+		defer server.Close()
+
+		for _, expected := range []int{http.StatusInternalServerError, http.StatusCreated} {
+			req, _ := http.NewRequest("POST", server.URL+"/order", strings.NewReader(body))
+			req.Header.Set("Idempotency-Key", "panic-key")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != expected {
+				t.Errorf("Expected status %d, got %d", expected, resp.StatusCode)
+			}
+		}
+	})
+}
+
+// testOrderQuotes validates quoting and placing an order against a quote token
+func testOrderQuotes(t *testing.T, testServer *TestServer) {
+	requestBody := `{"couponCode":"HAPPYHRS","items":[{"productId":"12","quantity":2},{"productId":"14","quantity":1}]}`
+
+	resp := doAuthorizedRequest(t, testServer, "POST", "/order/quote", requestBody)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var quote entities.Quote
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		t.Fatalf("Failed to decode quote: %v", err)
+	}
+
+	if len(quote.Lines) != 2 || quote.Token == "" || quote.ExpiresAt.IsZero() {
+		t.Fatalf("Incomplete quote: %+v", quote)
+	}
+	if quote.Subtotal.String() != "3499.97" || quote.Discounts.String() != "350.00" || quote.Total.String() != "3149.97" {
+		t.Errorf("Unexpected quote pricing: subtotal %s, discounts %s, total %s", quote.Subtotal, quote.Discounts, quote.Total)
+	}
+
+	t.Run("POST /order - Honours quote token", func(t *testing.T) {
+		body := fmt.Sprintf(`{"couponCode":"HAPPYHRS","items":[{"productId":"12","quantity":2},{"productId":"14","quantity":1}],"quoteToken":%q}`, quote.Token)
+		order := placeTestOrder(t, testServer, body)
+
+		if order.Total != quote.Total || order.Discounts != quote.Discounts {
+			t.Errorf("Expected quoted total %s/%s, got %s/%s", quote.Total, quote.Discounts, order.Total, order.Discounts)
+		}
+	})
+
+	t.Run("POST /order - Quote for different items", func(t *testing.T) {
+		body := fmt.Sprintf(`{"couponCode":"HAPPYHRS","items":[{"productId":"12","quantity":3}],"quoteToken":%q}`, quote.Token)
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order", body)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422, got %d", resp.StatusCode)
+		}
+
+		validateErrorResponse(t, resp)
+	})
+
+	t.Run("POST /order - Tampered quote token", func(t *testing.T) {
+		body := fmt.Sprintf(`{"couponCode":"HAPPYHRS","items":[{"productId":"12","quantity":2},{"productId":"14","quantity":1}],"quoteToken":%q}`, quote.Token+"x")
+		resp := doAuthorizedRequest(t, testServer, "POST", "/order", body)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422, got %d", resp.StatusCode)
+		}
+
+		validateErrorResponse(t, resp)
+	})
+}
+
+// testCartEndpoints walks a cart from creation to checkout
+func testCartEndpoints(t *testing.T, testServer *TestServer) {
+	cartRequest := func(method, path, body string, expectedStatus int) entities.PricedCart {
+		t.Helper()
+
+		resp := doAuthorizedRequest(t, testServer, method, path, body)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("%s %s: expected status %d, got %d", method, path, expectedStatus, resp.StatusCode)
+		}
+
+		var cart entities.PricedCart
+		if expectedStatus < 300 {
+			if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
+				t.Fatalf("Failed to decode cart: %v", err)
+			}
+		}
+		return cart
+	}
+
+	cart := cartRequest("POST", "/cart", "", http.StatusCreated)
+	if cart.Cart == nil || cart.ID == "" || cart.Pricing != nil {
+		t.Fatalf("Expected new empty cart, got %+v", cart)
+	}
+	cartPath := "/cart/" + cart.ID
+
+	cartRequest("PUT", cartPath+"/coupon", `{"couponCode":"NOTACODE"}`, http.StatusUnprocessableEntity)
+	cart = cartRequest("PUT", cartPath+"/coupon", `{"couponCode":"HAPPYHRS"}`, http.StatusOK)
+	if cart.CouponCode != "HAPPYHRS" {
+		t.Errorf("Expected a valid coupon to be kept on an empty cart, got %+v", cart)
+	}
+	cartRequest("DELETE", cartPath+"/coupon", "", http.StatusOK)
+
+	cartRequest("POST", cartPath+"/items", `{"productId":"10","quantity":1}`, http.StatusOK)
+	cart = cartRequest("POST", cartPath+"/items", `{"productId":"10","quantity":1}`, http.StatusOK)
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 2 {
+		t.Errorf("Expected merged item with quantity 2, got %+v", cart.Items)
+	}
+	if cart.Pricing == nil || cart.Pricing.Total.String() != "1999.98" {
+		t.Errorf("Expected live total 1999.98, got %+v", cart.Pricing)
+	}
+
+	cartRequest("POST", cartPath+"/items", `{"productId":"999","quantity":1}`, http.StatusBadRequest)
+	cartRequest("PUT", cartPath+"/items/11", `{"quantity":1}`, http.StatusNotFound)
+
+	cart = cartRequest("PUT", cartPath+"/items/10", `{"quantity":1}`, http.StatusOK)
+	if cart.Items[0].Quantity != 1 {
+		t.Errorf("Expected quantity 1, got %d", cart.Items[0].Quantity)
+	}
+
+	cartRequest("PUT", cartPath+"/coupon", `{"couponCode":"NOTACODE"}`, http.StatusUnprocessableEntity)
+	cart = cartRequest("PUT", cartPath+"/coupon", `{"couponCode":"HAPPYHRS"}`, http.StatusOK)
+	if cart.Pricing == nil || cart.Pricing.Discounts.String() != "100.00" {
+		t.Errorf("Expected discount 100.00 after applying coupon, got %+v", cart.Pricing)
+	}
+
+	cart = cartRequest("DELETE", cartPath+"/coupon", "", http.StatusOK)
+	if cart.CouponCode != "" || !cart.Pricing.Discounts.IsZero() {
+		t.Errorf("Expected coupon removed, got %+v", cart)
+	}
+
+	t.Run("POST /cart/{id}/checkout - Places order", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", cartPath+"/checkout", "")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		var order entities.Order
+		if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+			t.Fatalf("Failed to decode order: %v", err)
+		}
+		validateOrderSchema(t, order)
+
+		cartRequest("GET", cartPath, "", http.StatusNotFound)
+	})
+
+	t.Run("POST /cart/{id}/checkout - Empty cart", func(t *testing.T) {
+		emptyCart := cartRequest("POST", "/cart", "", http.StatusCreated)
+		cartRequest("POST", "/cart/"+emptyCart.ID+"/checkout", "", http.StatusBadRequest)
+	})
+
+	t.Run("POST /cart/{id}/checkout - Authorizes the payment token", func(t *testing.T) {
+		paidCart := cartRequest("POST", "/cart", "", http.StatusCreated)
+		cartRequest("POST", "/cart/"+paidCart.ID+"/items", `{"productId":"12","quantity":1}`, http.StatusOK)
+
+		order := postOrder(t, testServer, "/cart/"+paidCart.ID+"/checkout", `{"paymentToken":"tok_visa"}`, http.StatusOK)
+		if order.Status != entities.OrderStatusConfirmed || order.Payment == nil || order.Payment.Status != entities.PaymentStatusAuthorized {
+			t.Errorf("Expected a confirmed order with an authorized payment, got status '%s' and %+v", order.Status, order.Payment)
+		}
+	})
+
+	t.Run("POST /cart/{id}/items - Concurrent changes are not lost", func(t *testing.T) {
+		busyCart := cartRequest("POST", "/cart", "", http.StatusCreated)
+
+		var wg sync.WaitGroup
+		statuses := make(chan int, 10)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp := doAuthorizedRequest(t, testServer, "POST", "/cart/"+busyCart.ID+"/items", `{"productId":"11","quantity":1}`)
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		added := 0
+		for status := range statuses {
+			switch status {
+			case http.StatusOK:
+				added++
+			case http.StatusConflict:
+			default:
+				t.Errorf("Expected status 200 or 409, got %d", status)
+			}
+		}
+
+		busyCart = cartRequest("GET", "/cart/"+busyCart.ID, "", http.StatusOK)
+		if added == 0 || len(busyCart.Items) != 1 || busyCart.Items[0].Quantity != added {
+			t.Errorf("Expected quantity %d from the successful adds, got %+v", added, busyCart.Items)
+		}
+	})
+}
+
+// testCancellationAndRefunds validates the cancel and refund flows
+func testCancellationAndRefunds(t *testing.T, testServer *TestServer) {
+	orderAction := func(path, body string, expectedStatus int) entities.Order {
+		t.Helper()
+		return postOrder(t, testServer, path, body, expectedStatus)
+	}
+
+	t.Run("POST /order/{id}/cancel - Cancels unpaid order once", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"12","quantity":1}]}`)
+
+		cancelled := orderAction("/order/"+order.ID+"/cancel", `{"reason":"customer changed mind"}`, http.StatusOK)
+		if cancelled.Status != entities.OrderStatusCancelled {
+			t.Errorf("Expected status 'cancelled', got '%s'", cancelled.Status)
+		}
+
+		orderAction("/order/"+order.ID+"/cancel", "", http.StatusConflict)
+	})
+
+	t.Run("POST /order/{id}/cancel - Reports the cancellation when stock is not released", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"12","quantity":1}]}`)
+
+		testServer.stock.failing.Store(true)
+		defer testServer.stock.failing.Store(false)
+
+		cancelled := orderAction("/order/"+order.ID+"/cancel", `{"reason":"customer changed mind"}`, http.StatusOK)
+		if cancelled.Status != entities.OrderStatusCancelled {
+			t.Errorf("Expected status 'cancelled', got '%s'", cancelled.Status)
+		}
+	})
+
+	t.Run("POST /order/{id}/refund - Unpaid order", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"12","quantity":1}]}`)
+		orderAction("/order/"+order.ID+"/refund", "", http.StatusConflict)
+	})
+
+	t.Run("POST /order/{id}/refund - Partial then full refund", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"11","quantity":3},{"productId":"13","quantity":1}]}`)
+		orderPath := "/order/" + order.ID
+
+		orderAction(orderPath+"/transition", `{"status":"confirmed"}`, http.StatusOK)
+		paid := orderAction(orderPath+"/transition", `{"status":"paid"}`, http.StatusOK)
+		if paid.AmountPaid != paid.Total {
+			t.Fatalf("Expected amount paid %s, got %s", paid.Total, paid.AmountPaid)
+		}
+
+		partial := orderAction(orderPath+"/refund", `{"lines":[{"productId":"11","quantity":1}],"reason":"damaged"}`, http.StatusOK)
+		if partial.Status != entities.OrderStatusPaid || len(partial.Refunds) != 1 {
+			t.Fatalf("Expected one partial refund on a paid order, got status '%s' with %d refunds", partial.Status, len(partial.Refunds))
+		}
+		if partial.Lines[0].RefundedQuantity != 1 || partial.Refunds[0].Amount.String() != "764.99" {
+			t.Errorf("Unexpected partial refund: %+v", partial.Refunds[0])
+		}
+
+		orderAction(orderPath+"/refund", `{"lines":[{"productId":"11","quantity":3}]}`, http.StatusUnprocessableEntity)
+
+		refunded := orderAction(orderPath+"/refund", "", http.StatusOK)
+		if refunded.Status != entities.OrderStatusRefunded {
+			t.Errorf("Expected status 'refunded', got '%s'", refunded.Status)
+		}
+		if refunded.AmountRefunded != refunded.AmountPaid {
+			t.Errorf("Expected full refund of %s, got %s", refunded.AmountPaid, refunded.AmountRefunded)
+		}
+	})
+}
+
+// testPayments validates payment authorization, capture, void and refund
+// through the fake gateway's magic card tokens
+func testPayments(t *testing.T, testServer *TestServer) {
+	const items = `"items":[{"productId":"10","quantity":2}]`
+
+	t.Run("POST /order - Authorized payment confirms the order", func(t *testing.T) {
+		order := postOrder(t, testServer, "/order", `{"paymentToken":"tok_visa",`+items+`}`, http.StatusOK)
+		if order.Status != entities.OrderStatusConfirmed {
+			t.Fatalf("Expected status 'confirmed', got '%s'", order.Status)
+		}
+		if order.Payment == nil || order.Payment.Status != entities.PaymentStatusAuthorized || order.Payment.Amount != order.Total {
+			t.Fatalf("Expected an authorization for %s, got %+v", order.Total, order.Payment)
+		}
+
+		orderPath := "/order/" + order.ID
+		paid := postOrder(t, testServer, orderPath+"/transition", `{"status":"paid"}`, http.StatusOK)
+		if paid.Payment.Status != entities.PaymentStatusCaptured || paid.Payment.Captured != paid.Total {
+			t.Fatalf("Expected capture of %s, got %+v", paid.Total, paid.Payment)
+		}
+
+		refunded := postOrder(t, testServer, orderPath+"/refund", `{"lines":[{"productId":"10","quantity":1}]}`, http.StatusOK)
+		if refunded.Payment.Refunded != refunded.AmountRefunded || !refunded.Payment.Refunded.IsPositive() {
+			t.Errorf("Expected payment refund of %s, got %s", refunded.AmountRefunded, refunded.Payment.Refunded)
+		}
+	})
+
+	t.Run("POST /order - Declined payment", func(t *testing.T) {
+		postOrder(t, testServer, "/order", `{"paymentToken":"tok_decline",`+items+`}`, http.StatusPaymentRequired)
+	})
+
+	t.Run("POST /order - Payment provider timeout", func(t *testing.T) {
+		postOrder(t, testServer, "/order", `{"paymentToken":"tok_timeout",`+items+`}`, http.StatusGatewayTimeout)
+	})
+
+	t.Run("POST /order - 3DS payment stays pending until confirmed", func(t *testing.T) {
+		order := postOrder(t, testServer, "/order", `{"paymentToken":"tok_3ds",`+items+`}`, http.StatusOK)
+		if order.Status != entities.OrderStatusPending || order.Payment == nil || order.Payment.Status != entities.PaymentStatusPending {
+			t.Fatalf("Expected a pending order and payment, got '%s' with %+v", order.Status, order.Payment)
+		}
+		if order.Payment.NextAction == "" {
+			t.Error("Expected a next action for the pending payment")
+		}
+
+		orderPath := "/order/" + order.ID
+		confirmed := postOrder(t, testServer, orderPath+"/transition", `{"status":"confirmed"}`, http.StatusOK)
+		if confirmed.Status != entities.OrderStatusConfirmed || confirmed.Payment.Status != entities.PaymentStatusAuthorized {
+			t.Fatalf("Expected a confirmed order with an authorized payment, got '%s' with %+v", confirmed.Status, confirmed.Payment)
+		}
+	})
+
+	t.Run("POST /order/{id}/cancel - Voids the authorization", func(t *testing.T) {
+		order := postOrder(t, testServer, "/order", `{"paymentToken":"tok_3ds",`+items+`}`, http.StatusOK)
+		orderPath := "/order/" + order.ID
+
+		postOrder(t, testServer, orderPath+"/transition", `{"status":"paid"}`, http.StatusConflict)
+
+		cancelled := postOrder(t, testServer, orderPath+"/cancel", "", http.StatusOK)
+		if cancelled.Payment.Status != entities.PaymentStatusVoided {
+			t.Errorf("Expected payment to be voided, got '%s'", cancelled.Payment.Status)
+		}
+	})
+
+	t.Run("POST /order/{id}/transition - Failed 3DS challenge", func(t *testing.T) {
+		order := postOrder(t, testServer, "/order", `{"paymentToken":"tok_3ds_fail",`+items+`}`, http.StatusOK)
+		orderPath := "/order/" + order.ID
+
+		postOrder(t, testServer, orderPath+"/transition", `{"status":"confirmed"}`, http.StatusPaymentRequired)
+
+		cancelled := postOrder(t, testServer, orderPath+"/cancel", "", http.StatusOK)
+		if cancelled.Payment.Status != entities.PaymentStatusDeclined {
+			t.Errorf("Expected payment to stay declined, got '%s'", cancelled.Payment.Status)
+		}
+	})
+
+	t.Run("POST /order/{id}/refund - Concurrent refunds pay out once", func(t *testing.T) {
+		order := postOrder(t, testServer, "/order", `{"paymentToken":"tok_visa",`+items+`}`, http.StatusOK)
+		orderPath := "/order/" + order.ID
+		postOrder(t, testServer, orderPath+"/transition", `{"status":"paid"}`, http.StatusOK)
+
+		var wg sync.WaitGroup
+		statuses := make(chan int, 8)
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp := doAuthorizedRequest(t, testServer, "POST", orderPath+"/refund", `{"reason":"duplicate click"}`)
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}()
+		}
+		wg.Wait()
+		close(statuses)
+
+		refunds := 0
+		for status := range statuses {
+			switch status {
+			case http.StatusOK:
+				refunds++
+			case http.StatusConflict:
+			default:
+				t.Errorf("Expected status 200 or 409, got %d", status)
+			}
+		}
+		if refunds != 1 {
+			t.Errorf("Expected exactly one refund to succeed, got %d", refunds)
+		}
+
+		resp := doAuthorizedRequest(t, testServer, "GET", orderPath, "")
+		defer resp.Body.Close()
+
+		var refunded entities.Order
+		if err := json.NewDecoder(resp.Body).Decode(&refunded); err != nil {
+			t.Fatalf("Failed to decode order: %v", err)
+		}
+		if len(refunded.Refunds) != 1 || refunded.Payment.Refunded != refunded.AmountPaid || refunded.AmountRefunded != refunded.AmountPaid {
+			t.Errorf("Expected a single refund of %s, got %d refunds and %s refunded by the gateway", refunded.AmountPaid, len(refunded.Refunds), refunded.Payment.Refunded)
+		}
+		if calls := testServer.payments.RefundCount(refunded.Payment.AuthorizationID); calls != 1 {
+			t.Errorf("Expected the provider to be asked for one refund, got %d", calls)
+		}
+	})
+}
+
+// testSagas runs sagas of its own, as the order service never fails a
+// placement on purpose.
+func testSagas(t *testing.T) {
+	t.Run("Compensates after the request is cancelled", func(t *testing.T) {
+		sagaRepo, err := repositories.NewSagaRepository("", time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to create saga repository: %v", err)
+		}
+		gateway := payments.NewFakeGateway()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		type paymentState struct {
+			AuthorizationID string `json:"authorizationId"`
+		}
+		var voidErr error
+		placement := saga.New("test_payment", sagaRepo,
+			saga.Step[paymentState]{
+				Name: "authorize_payment",
+				Action: func(ctx context.Context, state *paymentState) error {
+					auth, err := gateway.Authorize(ctx, entities.PaymentRequest{Reference: "saga-cancelled", Token: payments.TokenApproved, Amount: entities.NewMoney(100, entities.DefaultCurrency)})
+					if err != nil {
+						return err
+					}
+					state.AuthorizationID = auth.ID
+					return nil
+				},
+				Compensate: func(ctx context.Context, state *paymentState) error {
+					voidErr = gateway.Void(ctx, state.AuthorizationID)
+					return voidErr
+				},
+			},
+			saga.Step[paymentState]{
+				Name: "save_order",
+				Action: func(ctx context.Context, state *paymentState) error {
+					cancel()
+					return ctx.Err()
+				},
+			},
+		)
+
+		if err := placement.Run(ctx, "saga-cancelled", &paymentState{}); err == nil {
+			t.Fatal("Expected the cancelled saga to fail")
+		}
+		if voidErr != nil {
+			t.Errorf("Expected the authorization to be voided, got %v", voidErr)
+		}
+
+		record, err := sagaRepo.GetByID(context.Background(), "saga-cancelled")
+		if err != nil {
+			t.Fatalf("Failed to read saga: %v", err)
+		}
+		if record.Status != entities.SagaStatusCompensated {
+			t.Errorf("Expected the saga to be compensated, got %s", record.Status)
+		}
+	})
+
+	t.Run("Appends steps to the log and compacts it on restart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sagas.jsonl")
+		open := func() interfaces.SagaRepository {
+			t.Helper()
+			sagaRepo, err := repositories.NewSagaRepository(path, time.Hour)
+			if err != nil {
+				t.Fatalf("Failed to open saga log: %v", err)
+			}
+			return sagaRepo
+		}
+		lines := func() int {
+			t.Helper()
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read saga log: %v", err)
+			}
+			return strings.Count(string(data), "\n")
+		}
+
+		sagaRepo := open()
+		now := time.Now().UTC()
+		running := &entities.SagaRecord{ID: "saga-running", Name: "test", Status: entities.SagaStatusRunning, CreatedAt: now, UpdatedAt: now}
+		stale := &entities.SagaRecord{ID: "saga-stale", Name: "test", Status: entities.SagaStatusCompleted, CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-2 * time.Hour)}
+		for _, record := range []*entities.SagaRecord{stale, running, running} {
+			if err := sagaRepo.Save(context.Background(), record); err != nil {
+				t.Fatalf("Failed to save saga: %v", err)
+			}
+		}
+		running.Status = entities.SagaStatusCompensating
+		if err := sagaRepo.Save(context.Background(), running); err != nil {
+			t.Fatalf("Failed to save saga: %v", err)
+		}
+		if count := lines(); count != 4 {
+			t.Errorf("Expected a line per save, got %d", count)
+		}
+
+		// A crash while appending leaves a line cut short.
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatalf("Failed to open saga log: %v", err)
+		}
+		file.WriteString(`{"id":"saga-torn","sta`)
+		file.Close()
+
+		restarted := open()
+		unfinished, err := restarted.ListUnfinished(context.Background())
+		if err != nil || len(unfinished) != 1 || unfinished[0].Status != entities.SagaStatusCompensating {
+			t.Errorf("Expected the last save of the running saga to survive, got %+v (%v)", unfinished, err)
+		}
+		if _, err := restarted.GetByID(context.Background(), "saga-stale"); err == nil {
+			t.Error("Expected the finished saga past retention to be dropped")
+		}
+		if count := lines(); count != 1 {
+			t.Errorf("Expected the log to be compacted to one line, got %d", count)
+		}
+	})
+}
+
+// testWebhooks validates signed webhook delivery, retries and the
+// dead-letter list against httptest receivers
+func testWebhooks(t *testing.T, testServer *TestServer) {
+	type received struct {
+		eventType string
+		payload   webhooks.Payload
+		attempt   int
+		verified  bool
+	}
+
+	// receiver answers with the status respond returns for the given attempt
+	// at an event and reports every delivery it accepts. Events are
+	// published asynchronously, so it may also see events for orders placed
+	// by other subtests.
+	receiver := func(secret string, respond func(attempt int) int) (*httptest.Server, chan received) {
+		deliveries := make(chan received, 64)
+		var mu sync.Mutex
+		attempts := make(map[string]int)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			var payload webhooks.Payload
+			_ = json.Unmarshal(body, &payload)
+
+			mu.Lock()
+			attempts[payload.ID]++
+			attempt := attempts[payload.ID]
+			mu.Unlock()
+
+			status := respond(attempt)
+			w.WriteHeader(status)
+			if status != http.StatusOK {
+				return
+			}
+
+			select {
+			case deliveries <- received{
+				eventType: r.Header.Get(webhooks.EventHeader),
+				payload:   payload,
+				attempt:   attempt,
+				verified:  webhooks.Verify(secret, r.Header.Get(webhooks.TimestampHeader), body, r.Header.Get(webhooks.SignatureHeader)),
+			}:
+			default:
+			}
+		}))
+		return server, deliveries
+	}
+
+	subscribe := func(url string) entities.WebhookSubscription {
+		t.Helper()
+
+		body := fmt.Sprintf(`{"url":%q,"eventTypes":["order.placed"],"secret":"test-webhook-secret"}`, url)
+		resp := doAuthorizedRequest(t, testServer, "POST", "/webhooks", body)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating webhook, got %d", resp.StatusCode)
+		}
+
+		var subscription entities.WebhookSubscription
+		if err := json.NewDecoder(resp.Body).Decode(&subscription); err != nil {
+			t.Fatalf("Failed to decode subscription: %v", err)
+		}
+		return subscription
+	}
+
+	unsubscribe := func(id string) {
+		resp := doAuthorizedRequest(t, testServer, "DELETE", "/webhooks/"+id, "")
+		resp.Body.Close()
+	}
+
+	// await returns the first delivery about the given order
+	await := func(deliveries chan received, orderID string) received {
+		t.Helper()
+
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case delivery := <-deliveries:
+				if delivery.payload.Data != nil && delivery.payload.Data.ID == orderID {
+					return delivery
+				}
+			case <-timeout:
+				t.Fatalf("Timed out waiting for webhook delivery for order %s", orderID)
+				return received{}
+			}
+		}
+	}
+
+	t.Run("POST /webhooks - Invalid subscription", func(t *testing.T) {
+		resp := doAuthorizedRequest(t, testServer, "POST", "/webhooks", `{"url":"ftp://example.com","eventTypes":["order.placed"]}`)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Delivers signed events after retrying failures", func(t *testing.T) {
+		server, deliveries := receiver("test-webhook-secret", func(attempt int) int {
+			if attempt < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+		defer server.Close()
+
+		subscription := subscribe(server.URL)
+		defer unsubscribe(subscription.ID)
+
+		if subscription.Secret != "test-webhook-secret" {
+			t.Errorf("Expected the secret to be returned on creation")
+		}
+
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"10","quantity":1}]}`)
+
+		delivery := await(deliveries, order.ID)
+		if !delivery.verified {
+			t.Error("Expected a valid signature")
+		}
+		if delivery.eventType != entities.OrderEventPlaced {
+			t.Errorf("Unexpected delivery: %+v", delivery)
+		}
+		if delivery.attempt != 3 {
+			t.Errorf("Expected 3 attempts, got %d", delivery.attempt)
+		}
+	})
+
+	t.Run("Dead-letters and replays undeliverable events", func(t *testing.T) {
+		var healthy atomic.Bool
+		server, deliveries := receiver("test-webhook-secret", func(int) int {
+			if healthy.Load() {
+				return http.StatusOK
+			}
+			return http.StatusInternalServerError
+		})
+		defer server.Close()
+
+		subscription := subscribe(server.URL)
+		defer unsubscribe(subscription.ID)
+
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"10","quantity":1}]}`)
+
+		// Other subtests' orders may dead-letter too, so only the one for
+		// this subscription and order counts.
+		var deadLetters []entities.WebhookDelivery
+		for deadline := time.Now().Add(2 * time.Second); len(deadLetters) == 0 && time.Now().Before(deadline); {
+			time.Sleep(20 * time.Millisecond)
+
+			var all []entities.WebhookDelivery
+			resp := doAuthorizedRequest(t, testServer, "GET", "/webhooks/dead-letters", "")
+			_ = json.NewDecoder(resp.Body).Decode(&all)
+			resp.Body.Close()
+
+			for _, deadLetter := range all {
+				if deadLetter.SubscriptionID == subscription.ID && deadLetter.Event.OrderID == order.ID {
+					deadLetters = append(deadLetters, deadLetter)
+				}
+			}
+		}
+
+		if len(deadLetters) != 1 || deadLetters[0].Attempts != 3 || deadLetters[0].LastStatusCode != http.StatusInternalServerError {
+			t.Fatalf("Expected one dead-lettered delivery after 3 attempts, got %+v", deadLetters)
+		}
+
+		healthy.Store(true)
+
+		resp := doAuthorizedRequest(t, testServer, "POST", "/webhooks/dead-letters/"+deadLetters[0].ID+"/replay", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Expected status 202 replaying, got %d", resp.StatusCode)
+		}
+
+		if delivery := await(deliveries, order.ID); !delivery.verified {
+			t.Error("Expected a valid signature on the replayed delivery")
+		}
+
+		resp = doAuthorizedRequest(t, testServer, "POST", "/webhooks/dead-letters/"+deadLetters[0].ID+"/replay", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 replaying twice, got %d", resp.StatusCode)
+		}
+	})
+}
+
+// testOutbox validates that order changes publish their events to every
+// sink, redelivering events a sink failed to accept
+func testOutbox(t *testing.T, testServer *TestServer) {
+	events := make(chan entities.OrderEvent, 64)
+	var failed atomic.Bool
+
+	testServer.subscribers.Subscribe("", func(ctx context.Context, event entities.OrderEvent) error {
+		events <- event
+		return nil
+	})
+	testServer.subscribers.Subscribe(entities.OrderEventCancelled, func(ctx context.Context, event entities.OrderEvent) error {
+		if failed.CompareAndSwap(false, true) {
+			return fmt.Errorf("subscriber unavailable")
+		}
+		return nil
+	})
+
+	order := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"10","quantity":1}]}`)
+	postOrder(t, testServer, "/order/"+order.ID+"/cancel", `{"reason":"outbox test"}`, http.StatusOK)
+
+	expected := []string{
+		entities.OrderEventPlaced,
+		entities.OrderEventPromoRedeemed,
+		entities.OrderEventStatusChanged,
+		entities.OrderEventCancelled,
+	}
+
+	// The failing subscriber makes the cancelled event arrive twice
+	var received []entities.OrderEvent
+	for len(received) < len(expected)+1 {
+		select {
+		case event := <-events:
+			if event.OrderID == order.ID {
+				received = append(received, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for order events, got %d", len(received))
+		}
+	}
+
+	seen := make(map[string]string)
+	var types []string
+	for _, event := range received {
+		if eventType, duplicate := seen[event.ID]; duplicate {
+			if eventType != event.Type {
+				t.Errorf("Event %s redelivered as '%s', was '%s'", event.ID, event.Type, eventType)
+			}
+			continue
+		}
+		seen[event.ID] = event.Type
+		types = append(types, event.Type)
+
+		if event.Order == nil || event.Order.ID != order.ID {
+			t.Errorf("Expected event %s to carry the order", event.ID)
+		}
+	}
+
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+
+	data, err := os.ReadFile(testServer.eventLog)
+	if err != nil {
+		t.Fatalf("Failed to read event log: %v", err)
+	}
+
+	logged := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var event entities.OrderEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Invalid event log line %q: %v", line, err)
+		}
+		if event.OrderID == order.ID {
+			logged++
+		}
+	}
+	if logged < len(expected) {
+		t.Errorf("Expected at least %d logged events for the order, got %d", len(expected), logged)
+	}
+}
+
+// testReceipts validates receipts rendered as HTML, plain text and ESC/POS
+func testReceipts(t *testing.T, testServer *TestServer) {
+	order := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"10","quantity":2},{"productId":"12","quantity":1}]}`)
+
+	getReceipt := func(t *testing.T, query string, expectedStatus int) (string, string) {
+		t.Helper()
+
+		resp := doAuthorizedRequest(t, testServer, "GET", "/order/"+order.ID+"/receipt"+query, "")
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+
+	// GST is included in prices, so it is 1/11 of the total
+	tax, _ := order.Total.MulRatio(1, 11, entities.RoundHalfEven)
+
+	t.Run("Plain text", func(t *testing.T) {
+		contentType, body := getReceipt(t, "?format=text", http.StatusOK)
+
+		if !strings.HasPrefix(contentType, "text/plain") {
+			t.Errorf("Expected a text content type, got '%s'", contentType)
+		}
+
+		for _, expected := range []string{"Test Kart", "1 Test Street", order.Number, "Discount HAPPYHRS", "-" + order.Discounts.String(), "TOTAL USD", order.Total.String(), "Incl. GST 10%", tax.String(), "Thank you!"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected receipt to contain %q:\n%s", expected, body)
+			}
+		}
+
+		for _, line := range strings.Split(body, "\n") {
+			if len(line) > 48 {
+				t.Errorf("Line wider than 80mm paper: %q", line)
+			}
+		}
+	})
+
+	t.Run("ESC/POS 58mm", func(t *testing.T) {
+		contentType, body := getReceipt(t, "?format=escpos&width=58", http.StatusOK)
+
+		if contentType != "application/octet-stream" {
+			t.Errorf("Expected a binary content type, got '%s'", contentType)
+		}
+		if !strings.HasPrefix(body, "\x1b@") || !strings.HasSuffix(strings.TrimSpace(body), "\x1dVB\x03") {
+			t.Errorf("Expected the stream to initialise the printer and end with a cut: %q", body)
+		}
+
+		printable := regexp.MustCompile(`\x1b[@]|\x1b[aE].|\x1d!.|\x1dVB.`).ReplaceAllString(body, "")
+		for _, line := range strings.Split(printable, "\n") {
+			if len(line) > 32 {
+				t.Errorf("Line wider than 58mm paper: %q", line)
+			}
+		}
+		if !strings.Contains(printable, "Order "+order.Number) {
+			t.Errorf("Expected the order number on the receipt: %q", printable)
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		contentType, body := getReceipt(t, "", http.StatusOK)
+
+		if !strings.HasPrefix(contentType, "text/html") {
+			t.Errorf("Expected an HTML content type, got '%s'", contentType)
+		}
+		if !strings.Contains(body, "<h2>Order "+order.Number+"</h2>") || !strings.Contains(body, order.Lines[0].Product.Name) {
+			t.Errorf("Unexpected HTML receipt:\n%s", body)
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		getReceipt(t, "?format=pdf", http.StatusBadRequest)
+		getReceipt(t, "?format=escpos&width=70", http.StatusBadRequest)
+
+		resp := doAuthorizedRequest(t, testServer, "GET", "/order/unknown/receipt", "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 for an unknown order, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Template override", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, receipts.TextTemplate), []byte(`{{row "Order" .Number}}`), 0o644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+
+		renderer, err := receipts.NewTemplateRenderer(dir)
+		if err != nil {
+			t.Fatalf("Failed to load templates: %v", err)
+		}
+
+		rendered, err := renderer.Render(&entities.Receipt{Number: "#A001"}, entities.ReceiptFormatText, entities.PaperWidth58mm)
+		if err != nil {
+			t.Fatalf("Failed to render: %v", err)
+		}
+		if string(rendered.Body) != "Order"+strings.Repeat(" ", 22)+"#A001" {
+			t.Errorf("Expected the override to be used, got %q", rendered.Body)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, receipts.HTMLTemplate), []byte(`{{.Broken`), 0o644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+		if _, err := receipts.NewTemplateRenderer(dir); err == nil {
+			t.Error("Expected a broken override to be rejected")
+		}
+	})
+}
+
+// testOrderExport validates the CSV and JSONL order exports
+func testOrderExport(t *testing.T, testServer *TestServer) {
+	first := placeTestOrder(t, testServer, `{"items":[{"productId":"10","quantity":2},{"productId":"12","quantity":1}]}`)
+	second := placeTestOrder(t, testServer, `{"couponCode":"HAPPYHRS","items":[{"productId":"11","quantity":1}]}`)
+
+	from := first.CreatedAt.Format(time.RFC3339Nano)
+	to := second.CreatedAt.Add(time.Nanosecond).Format(time.RFC3339Nano)
+	rangeQuery := "from=" + url.QueryEscape(from) + "&to=" + url.QueryEscape(to)
+
+	export := func(t *testing.T, query string, gzipped bool) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", testServer.server.URL+"/admin/orders/export?"+query, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("api_key", "apitest")
+		if gzipped {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("CSV, one row per order line", func(t *testing.T) {
+		resp := export(t, rangeQuery, false)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+			t.Fatalf("Expected a CSV export, got %d '%s'", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Invalid CSV: %v", err)
+		}
+
+		if len(records) != 4 || records[0][0] != "order_id" {
+			t.Fatalf("Expected a header and 3 lines, got %v", records)
+		}
+		if records[1][0] != first.ID || records[1][5] != "10" || records[1][7] != "2" || records[1][8] != first.Lines[0].UnitPrice.String() {
+			t.Errorf("Unexpected first row: %v", records[1])
+		}
+		if records[3][0] != second.ID || records[3][9] != second.Lines[0].Discount.String() || records[3][10] != second.Lines[0].Total.String() {
+			t.Errorf("Unexpected discounted row: %v", records[3])
+		}
+	})
+
+	t.Run("JSONL with gzip", func(t *testing.T) {
+		resp := export(t, rangeQuery+"&format=jsonl", true)
+		defer resp.Body.Close()
+
+		if resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected a gzip encoded export, got '%s'", resp.Header.Get("Content-Encoding"))
+		}
+
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			t.Fatalf("Invalid gzip stream: %v", err)
+		}
+
+		decoder := json.NewDecoder(reader)
+		var rows []entities.OrderExportRow
+		for decoder.More() {
+			var row entities.OrderExportRow
+			if err := decoder.Decode(&row); err != nil {
+				t.Fatalf("Invalid JSONL row: %v", err)
+			}
+			rows = append(rows, row)
+		}
+
+		if len(rows) != 3 || rows[2].OrderID != second.ID || rows[2].ProductName != second.Lines[0].Product.Name {
+			t.Errorf("Unexpected rows: %+v", rows)
+		}
+	})
+
+	t.Run("Empty range", func(t *testing.T) {
+		resp := export(t, "from=2000-01-01&to=2000-01-02", false)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != strings.Join([]string{"order_id", "order_number", "created_at", "status", "currency", "product_id", "product_name", "quantity", "unit_price", "discount", "total"}, ",") {
+			t.Errorf("Expected only the header, got %d %q", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, query := range []string{"", "from=yesterday", "from=2024-02-02&to=2024-02-01", rangeQuery + "&format=xml"} {
+			resp := export(t, query, false)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %q, got %d", query, resp.StatusCode)
+			}
+		}
+	})
+}
+
+// postOrder posts to an order endpoint and decodes the order when the
+// expected status is 200
+func postOrder(t *testing.T, testServer *TestServer, path, body string, expectedStatus int) entities.Order {
+	t.Helper()
+
+	resp := doAuthorizedRequest(t, testServer, "POST", path, body)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		t.Fatalf("POST %s: expected status %d, got %d", path, expectedStatus, resp.StatusCode)
+	}
+
+	var order entities.Order
+	if expectedStatus == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+			t.Fatalf("Failed to decode order: %v", err)
+		}
+	}
+	return order
+}
+
+// doAuthorizedRequest sends a request carrying the test API key
+func doAuthorizedRequest(t *testing.T, testServer *TestServer, method, path, body string) *http.Response {
+	t.Helper()
+
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, testServer.server.URL+path, bodyReader)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("api_key", "apitest")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+
+	return resp
+}
+
+// placeTestOrder places an order and fails the test unless it succeeds
+func placeTestOrder(t *testing.T, testServer *TestServer, body string) entities.Order {
+	t.Helper()
+
+	resp := doAuthorizedRequest(t, testServer, "POST", "/order", body)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 placing order, got %d", resp.StatusCode)
+	}
+
+	var order entities.Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		t.Fatalf("Failed to decode order: %v", err)
+	}
+
+	return order
+}
+
+func testAPIKeys(t *testing.T, testServer *TestServer) {
+	send := func(method, path, apiKey, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, testServer.server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("api_key", apiKey)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		return resp
+	}
+	request := func(method, path, apiKey string) *http.Response {
+		t.Helper()
+		return send(method, path, apiKey, `{"items":[{"productId":"10","quantity":1}]}`)
+	}
+	// status reads an order that does not exist, so any key that is
+	// accepted gets a 404 and any other a 401.
+	status := func(apiKey string) int {
+		t.Helper()
+		resp := request("GET", "/order/unknown", apiKey)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	decode := func(resp *http.Response, expectedStatus int, body any) {
+		t.Helper()
+		defer resp.Body.Close()
+
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
+		}
+		if body != nil {
+			if err := json.NewDecoder(resp.Body).Decode(body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+	}
+
+	t.Run("Rejects unknown, disabled and expired keys", func(t *testing.T) {
+		for _, apiKey := range []string{"not-a-key", disabledAPIKey, expiredAPIKey} {
+			resp := request("GET", "/order/unknown", apiKey)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 for '%s', got %d", apiKey, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("Requires the orders:write scope to place orders", func(t *testing.T) {
+		resp := request("POST", "/order", readOnlyAPIKey)
+		defer resp.Body.Close()
+
+		var errorResponse errors.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(errorResponse.Error.Message, entities.ScopeOrdersWrite) {
+			t.Errorf("Expected status 403 naming the scope, got %d %+v", resp.StatusCode, errorResponse)
+		}
+	})
+
+	t.Run("Requires admin scopes to export orders and manage webhooks", func(t *testing.T) {
+		for _, route := range []struct{ method, path string }{
+			{"GET", "/admin/orders/export?from=2024-01-01"},
+			{"GET", "/webhooks"},
+			{"POST", "/webhooks"},
+			{"GET", "/webhooks/dead-letters"},
+			{"DELETE", "/webhooks/unknown"},
+		} {
+			resp := request(route.method, route.path, writerAPIKey)
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("Expected status 403 for %s %s with orders:write, got %d", route.method, route.path, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("Lets keys without scopes read", func(t *testing.T) {
+		order := placeTestOrder(t, testServer, `{"items":[{"productId":"10","quantity":1}]}`)
+
+		resp := request("GET", "/order/"+order.ID, readOnlyAPIKey)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Creates, rotates and revokes keys", func(t *testing.T) {
+		resp := send("POST", "/admin/api-keys", readOnlyAPIKey, `{"name":"POS 2","scopes":["orders:write"]}`)
+		decode(resp, http.StatusForbidden, nil)
+
+		var created entities.APIKey
+		resp = send("POST", "/admin/api-keys", "apitest", `{"name":"POS 2","scopes":["orders:write"]}`)
+		decode(resp, http.StatusCreated, &created)
+		if created.Secret == "" || created.Hash != "" || !created.Enabled {
+			t.Fatalf("Expected an enabled key with only its secret, got %+v", created)
+		}
+		if got := status(created.Secret); got != http.StatusNotFound {
+			t.Fatalf("Expected the new key to be accepted, got %d", got)
+		}
+
+		var keys []entities.APIKey
+		decode(send("GET", "/admin/api-keys", "apitest", ""), http.StatusOK, &keys)
+		listed := -1
+		for i, key := range keys {
+			if key.Secret != "" || key.Hash != "" {
+				t.Errorf("Expected listed keys without secrets or hashes, got %+v", key)
+			}
+			if key.ID == created.ID {
+				listed = i
+			}
+		}
+		if listed < 0 || keys[listed].LastUsedAt == nil {
+			t.Fatalf("Expected the new key to be listed with its last use, got %+v", keys)
+		}
+
+		var rotated entities.APIKey
+		resp = send("POST", "/admin/api-keys/"+created.ID+"/rotate", "apitest", `{"gracePeriod":"1h"}`)
+		decode(resp, http.StatusCreated, &rotated)
+		if rotated.ID == created.ID || rotated.Secret == "" || rotated.Name != created.Name {
+			t.Fatalf("Expected a replacement key, got %+v", rotated)
+		}
+		if status(created.Secret) != http.StatusNotFound || status(rotated.Secret) != http.StatusNotFound {
+			t.Fatal("Expected both keys to work during the grace period")
+		}
+
+		resp = send("POST", "/admin/api-keys/"+created.ID+"/rotate", "apitest", "")
+		decode(resp, http.StatusConflict, nil)
+
+		decode(send("DELETE", "/admin/api-keys/"+created.ID, "apitest", ""), http.StatusNoContent, nil)
+		if got := status(created.Secret); got != http.StatusUnauthorized {
+			t.Errorf("Expected the revoked key to be rejected, got %d", got)
+		}
+		if got := status(rotated.Secret); got != http.StatusNotFound {
+			t.Errorf("Expected the replacement to keep working, got %d", got)
+		}
+
+		var entries []entities.APIKeyAuditEntry
+		decode(send("GET", "/admin/api-keys/audit", "apitest", ""), http.StatusOK, &entries)
+		var actions []string
+		for _, entry := range entries {
+			if entry.KeyID == created.ID {
+				actions = append(actions, entry.Action)
+				if entry.Actor != middleware.APIKeyID("apitest") {
+					t.Errorf("Expected the admin key as actor, got '%s'", entry.Actor)
+				}
+			}
+		}
+		if strings.Join(actions, ",") != "created,rotated,revoked" {
+			t.Errorf("Expected created, rotated and revoked entries, got %v", actions)
+		}
+	})
+
+	t.Run("Rejects invalid key requests", func(t *testing.T) {
+		decode(send("POST", "/admin/api-keys", "apitest", `{"name":"pos","scopes":["orders:everything"]}`), http.StatusBadRequest, nil)
+		decode(send("POST", "/admin/api-keys", "apitest", `{"scopes":["orders:write"]}`), http.StatusBadRequest, nil)
+		decode(send("POST", "/admin/api-keys/key_unknown/rotate", "apitest", ""), http.StatusNotFound, nil)
+		decode(send("POST", "/admin/api-keys/key_readonly/rotate", "apitest", `{"gracePeriod":"forever"}`), http.StatusBadRequest, nil)
+		decode(send("DELETE", "/admin/api-keys/key_unknown", "apitest", ""), http.StatusNotFound, nil)
+	})
+
+	t.Run("Keeps keys and the audit log across restarts", func(t *testing.T) {
+		keysPath := filepath.Join(t.TempDir(), "api_keys.json")
+		auditPath := filepath.Join(t.TempDir(), "api_key_audit.jsonl")
+
+		load := func() interfaces.APIKeyService {
+			t.Helper()
+			repo, err := repositories.NewAPIKeyRepository(keysPath)
+			if err != nil {
+				t.Fatalf("Failed to load API keys: %v", err)
+			}
+			audit, err := repositories.NewAPIKeyAuditRepository(auditPath)
+			if err != nil {
+				t.Fatalf("Failed to load API key audit log: %v", err)
+			}
+			return services.NewAPIKeyService(repo, audit)
+		}
+
+		ctx := entities.WithAPIKeyID(context.Background(), "key_admin")
+		service := load()
+		created, err := service.CreateKey(ctx, entities.APIKeyRequest{Name: "POS 3", Scopes: []string{entities.ScopeOrdersWrite}})
+		if err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+		rotated, err := service.RotateKey(ctx, created.ID, entities.RotateAPIKeyRequest{GracePeriod: "0s"})
+		if err != nil {
+			t.Fatalf("Failed to rotate key: %v", err)
+		}
+
+		data, err := os.ReadFile(keysPath)
+		if err != nil {
+			t.Fatalf("Failed to read API keys: %v", err)
+		}
+		if strings.Contains(string(data), created.Secret) || strings.Contains(string(data), rotated.Secret) {
+			t.Fatal("Expected secrets not to be stored")
+		}
+
+		restarted := load()
+		if _, err := restarted.Authenticate(context.Background(), rotated.Secret); err != nil {
+			t.Errorf("Expected the rotated key to work after a restart: %v", err)
+		}
+		if _, err := restarted.Authenticate(context.Background(), created.Secret); err == nil {
+			t.Error("Expected the old key to stop working without a grace period")
+		}
+
+		entries, err := restarted.ListAuditLog(context.Background())
+		if err != nil || len(entries) != 2 || entries[0].Action != entities.APIKeyActionCreated || entries[1].Actor != "key_admin" {
+			t.Errorf("Expected the audit log to survive the restart, got %+v (%v)", entries, err)
+		}
+	})
+
+	t.Run("Undoes or retries key changes that were not audited", func(t *testing.T) {
+		repo, err := repositories.NewAPIKeyRepository("")
+		if err != nil {
+			t.Fatalf("Failed to create API key repository: %v", err)
+		}
+		auditRepo, err := repositories.NewAPIKeyAuditRepository("")
+		if err != nil {
+			t.Fatalf("Failed to create API key audit log: %v", err)
+		}
+		audit := &failingAuditRepository{APIKeyAuditRepository: auditRepo}
+		service := services.NewAPIKeyService(repo, audit)
+		ctx := context.Background()
+
+		audit.failing.Store(true)
+		if _, err := service.CreateKey(ctx, entities.APIKeyRequest{Name: "POS 4", Scopes: []string{entities.ScopeOrdersWrite}}); err == nil {
+			t.Fatal("Expected creating a key to fail without an audit entry")
+		}
+		keys, _ := service.ListKeys(ctx)
+		if len(keys) != 1 || keys[0].Enabled || keys[0].RevokedAt == nil {
+			t.Errorf("Expected the unaudited key to be switched off, got %+v", keys)
+		}
+
+		audit.failing.Store(false)
+		created, err := service.CreateKey(ctx, entities.APIKeyRequest{Name: "POS 5", Scopes: []string{entities.ScopeOrdersWrite}})
+		if err != nil {
+			t.Fatalf("Failed to create key: %v", err)
+		}
+
+		audit.failing.Store(true)
+		if _, err := service.RotateKey(ctx, created.ID, entities.RotateAPIKeyRequest{GracePeriod: "0s"}); err == nil {
+			t.Fatal("Expected rotating a key to fail without an audit entry")
+		}
+		if _, err := service.Authenticate(ctx, created.Secret); err != nil {
+			t.Errorf("Expected the key to keep working after an unaudited rotation: %v", err)
+		}
+
+		if err := service.RevokeKey(ctx, created.ID); err == nil {
+			t.Fatal("Expected revoking a key to fail without an audit entry")
+		}
+		if _, err := service.Authenticate(ctx, created.Secret); err == nil {
+			t.Error("Expected the key to stay revoked")
+		}
+
+		audit.failing.Store(false)
+		if err := service.RevokeKey(ctx, created.ID); err != nil {
+			t.Fatalf("Failed to retry revoking the key: %v", err)
+		}
+		if err := service.RevokeKey(ctx, created.ID); err != nil {
+			t.Fatalf("Failed to revoke the key again: %v", err)
+		}
+
+		entries, _ := service.ListAuditLog(ctx)
+		revocations := 0
+		for _, entry := range entries {
+			if entry.Action == entities.APIKeyActionRevoked && entry.KeyID == created.ID {
+				revocations++
+			}
+		}
+		if revocations != 1 {
+			t.Errorf("Expected the retried revocation to be audited once, got %d entries", revocations)
+		}
+	})
+
+	t.Run("Rejects invalid key files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api_keys.json")
+		if err := os.WriteFile(path, []byte(`[{"id":"key_1","name":"pos","hash":"abc","scopes":["orders:write"],"enabled":true}]`), 0o600); err != nil {
+			t.Fatalf("Failed to write API keys: %v", err)
+		}
+
+		if _, err := repositories.NewAPIKeyRepository(path); err == nil {
+			t.Error("Expected an error for a key without a SHA-256 hash")
+		}
+	})
+}
+
+// testBearerTokens runs its own mux so the verifier can be given keys the
+// test signs with.
+func testBearerTokens(t *testing.T, testServer *TestServer) {
+	hmacSecret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	ecPoint, err := ecKey.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to encode EC key: %v", err)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": encode(hmacSecret)},
+		{"kty": "RSA", "kid": "rs", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": encode(ecPoint[1:33]), "y": encode(ecPoint[33:])},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to encode JWKS: %v", err)
+	}
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, jwks, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	verifier, err := security.NewJWTVerifier(jwksPath, security.JWTOptions{Issuer: "https://id.example.com", Audience: "kart-api", ClockSkew: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to load JWKS: %v", err)
+	}
+
+	sign := func(alg, kid string, claims map[string]any) string {
+		t.Helper()
+
+		header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+		payload, _ := json.Marshal(claims)
+		input := encode(header) + "." + encode(payload)
+		digest := sha256.Sum256([]byte(input))
+
+		var signature []byte
+		switch alg {
+		case "HS256":
+			mac := hmac.New(sha256.New, hmacSecret)
+			mac.Write([]byte(input))
+			signature = mac.Sum(nil)
+		case "RS256":
+			if signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:]); err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+		case "ES256":
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+		return input + "." + encode(signature)
+	}
+	claims := func(overrides map[string]any) map[string]any {
+		now := time.Now().Unix()
+		claims := map[string]any{
+			"sub":   "user-42",
+			"iss":   "https://id.example.com",
+			"aud":   []string{"kart-api", "other-api"},
+			"exp":   now + 300,
+			"nbf":   now - 10,
+			"scope": "orders:write openid",
+		}
+		for key, value := range overrides {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	var principal *entities.Principal
+	var actor string
+	authMiddleware := middleware.NewAuthMiddleware(testServer.apiKeyService, verifier, nil, nil, logger.New())
+	mux := http.NewServeMux()
+	mux.Handle("POST /order", authMiddleware.RequireAPIKey(authMiddleware.RequireScope(entities.ScopeOrdersWrite, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = entities.PrincipalFromContext(r.Context())
+		actor = entities.ActorFromContext(r.Context())
+	}))))
+
+	// placed counts the orders behind the idempotency middleware.
+	placed := 0
+	idempotencyMiddleware := middleware.NewIdempotencyMiddleware(repositories.NewIdempotencyRepository(), time.Hour, logger.New())
+	mux.Handle("POST /order/idempotent", authMiddleware.RequireAPIKey(idempotencyMiddleware.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		placed++
+		fmt.Fprintf(w, `{"id":"order-%d"}`, placed)
+	}))))
+
+	request := func(authorization string) int {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/order", nil)
+		req.Header.Set("Authorization", authorization)
+		mux.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("Accepts HS256, RS256 and ES256 tokens", func(t *testing.T) {
+		for _, signer := range []struct{ alg, kid string }{{"HS256", "hs"}, {"RS256", "rs"}, {"ES256", "es"}, {"ES256", ""}} {
+			principal = nil
+			if status := request("Bearer " + sign(signer.alg, signer.kid, claims(nil))); status != http.StatusOK {
+				t.Fatalf("Expected status 200 for %s, got %d", signer.alg, status)
+			}
+			if principal == nil || principal.KeyID != "jwt:user-42" || !slices.Equal(principal.Scopes, []string{entities.ScopeOrdersWrite}) {
+				t.Errorf("Expected the claims mapped to a principal, got %+v", principal)
+			}
+			if actor != middleware.BearerTokenActor {
+				t.Errorf("Expected actor '%s', got '%s'", middleware.BearerTokenActor, actor)
+			}
+		}
+	})
+
+	t.Run("Tolerates clock skew", func(t *testing.T) {
+		now := time.Now().Unix()
+		token := sign("HS256", "hs", claims(map[string]any{"exp": now - 30, "nbf": now + 30}))
+		if status := request("Bearer " + token); status != http.StatusOK {
+			t.Errorf("Expected status 200 within the skew, got %d", status)
+		}
+	})
+
+	t.Run("Rejects invalid tokens", func(t *testing.T) {
+		now := time.Now().Unix()
+		valid := sign("RS256", "rs", claims(nil))
+		tampered := strings.Split(valid, ".")
+		tampered[1] = encode([]byte(`{"sub":"admin","exp":9999999999}`))
+
+		cases := map[string]string{
+			"expired":        sign("HS256", "hs", claims(map[string]any{"exp": now - 120})),
+			"not yet valid":  sign("HS256", "hs", claims(map[string]any{"nbf": now + 120})),
+			"wrong issuer":   sign("HS256", "hs", claims(map[string]any{"iss": "https://evil.example.com"})),
+			"wrong audience": sign("HS256", "hs", claims(map[string]any{"aud": "other-api"})),
+			"without expiry": sign("HS256", "hs", claims(map[string]any{"exp": nil})),
+			"wrong key":      sign("RS256", "es", claims(nil)),
+			"unsigned":       strings.Join(tampered[:2], ".") + ".",
+			"tampered":       strings.Join(tampered, "."),
+			"malformed":      "not-a-jwt",
+			"algorithm none": encode([]byte(`{"alg":"none"}`)) + "." + tampered[1] + ".",
+		}
+		for name, token := range cases {
+			if status := request("Bearer " + token); status != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 for a token that is %s, got %d", name, status)
+			}
+		}
+	})
+
+	t.Run("Requires scopes from the claims", func(t *testing.T) {
+		token := sign("ES256", "es", claims(map[string]any{"scope": nil, "scp": []string{"products:admin"}}))
+		if status := request("Bearer " + token); status != http.StatusForbidden {
+			t.Errorf("Expected status 403 without orders:write, got %d", status)
+		}
+	})
+
+	t.Run("Scopes idempotency keys by principal", func(t *testing.T) {
+		place := func(subject string) string {
+			t.Helper()
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/order/idempotent", strings.NewReader(`{"items":[{"productId":"1","quantity":1}]}`))
+			req.Header.Set("Authorization", "Bearer "+sign("HS256", "hs", claims(map[string]any{"sub": subject})))
+			req.Header.Set(middleware.IdempotencyKeyHeader, "shared-key")
+			mux.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", recorder.Code)
+			}
+			return recorder.Body.String()
+		}
+
+		first := place("user-42")
+		if second := place("user-43"); second == first {
+			t.Errorf("Expected another principal to get its own order, got %s", second)
+		}
+		if replayed := place("user-42"); replayed != first {
+			t.Errorf("Expected the first order to be replayed, got %s", replayed)
+		}
+	})
+
+	t.Run("Still accepts API keys", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/order", nil)
+		req.Header.Set("api_key", "apitest")
+		mux.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK || actor != middleware.APIKeyActor {
+			t.Errorf("Expected the API key to be accepted, got %d as '%s'", recorder.Code, actor)
+		}
+	})
+}
+
+// testRequestSigning runs its own mux so routes can be given their own
+// auth schemes.
+func testRequestSigning(t *testing.T, testServer *TestServer) {
+	const secret = "kiosk-shared-secret-0123456789abcdef"
+
+	keysPath := filepath.Join(t.TempDir(), "signing_keys.json")
+	keys := `[{"id":"kiosk-1","name":"Kiosk 1","secret":"` + secret + `","scopes":["orders:write"],"enabled":true}]`
+	if err := os.WriteFile(keysPath, []byte(keys), 0o600); err != nil {
+		t.Fatalf("Failed to write signing keys: %v", err)
+	}
+	signingKeys, err := repositories.NewSigningKeyRepository(keysPath)
+	if err != nil {
+		t.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	schemes, err := entities.ParseAuthSchemes("*=api_key; POST /order=signature")
+	if err != nil {
+		t.Fatalf("Failed to parse auth schemes: %v", err)
+	}
+
+	verifier := middleware.NewSignatureVerifier(signingKeys, repositories.NewNonceRepository(100), time.Minute)
+	authMiddleware := middleware.NewAuthMiddleware(testServer.apiKeyService, nil, verifier, schemes, logger.New())
+
+	var principal *entities.Principal
+	var actor, body string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = entities.PrincipalFromContext(r.Context())
+		actor = entities.ActorFromContext(r.Context())
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("POST /order", authMiddleware.RequireAPIKey(handler))
+	mux.Handle("GET /order/{id}", authMiddleware.RequireAPIKey(handler))
+
+	send := func(method, target, requestBody string, headers map[string]string) int {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, target, strings.NewReader(requestBody))
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		mux.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	signed := func(method, target, requestBody, nonce string, signedAt time.Time) map[string]string {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		return map[string]string{
+			"X-Signature-Key":       "kiosk-1",
+			"X-Signature-Timestamp": timestamp,
+			"X-Signature-Nonce":     nonce,
+			"X-Signature":           middleware.RequestSignature(secret, method, target, timestamp, nonce, []byte(requestBody)),
+		}
+	}
+
+	orderBody := `{"items":[{"productId":"10","quantity":1}]}`
+
+	t.Run("Accepts a signed request once", func(t *testing.T) {
+		headers := signed("POST", "/order?source=kiosk", orderBody, "nonce-1", time.Now())
+
+		if status := send("POST", "/order?source=kiosk", orderBody, headers); status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		if principal == nil || principal.KeyID != "hmac:kiosk-1" || !principal.HasScope(entities.ScopeOrdersWrite) || actor != middleware.SignedRequestActor {
+			t.Errorf("Expected the signing key as principal, got %+v as '%s'", principal, actor)
+		}
+		if body != orderBody {
+			t.Errorf("Expected the handler to read the signed body, got '%s'", body)
+		}
+
+		if status := send("POST", "/order?source=kiosk", orderBody, headers); status != http.StatusUnauthorized {
+			t.Errorf("Expected a replay to get status 401, got %d", status)
+		}
+	})
+
+	t.Run("Rejects stale, future and tampered requests", func(t *testing.T) {
+		swappedNonce := signed("POST", "/order", orderBody, "nonce-6", time.Now())
+		swappedNonce["X-Signature-Nonce"] = "nonce-7"
+
+		cases := map[string]struct {
+			target, body string
+			headers      map[string]string
+		}{
+			"stale":           {"/order", orderBody, signed("POST", "/order", orderBody, "nonce-2", time.Now().Add(-2*time.Minute))},
+			"future":          {"/order", orderBody, signed("POST", "/order", orderBody, "nonce-3", time.Now().Add(2*time.Minute))},
+			"tampered body":   {"/order", `{"items":[{"productId":"10","quantity":99}]}`, signed("POST", "/order", orderBody, "nonce-4", time.Now())},
+			"tampered query":  {"/order?source=web", orderBody, signed("POST", "/order?source=kiosk", orderBody, "nonce-5", time.Now())},
+			"swapped nonce":   {"/order", orderBody, swappedNonce},
+			"missing headers": {"/order", orderBody, map[string]string{"X-Signature": "sha256=00"}},
+		}
+		for name, tc := range cases {
+			if status := send("POST", tc.target, tc.body, tc.headers); status != http.StatusUnauthorized {
+				t.Errorf("Expected status 401 for a %s request, got %d", name, status)
+			}
+		}
+	})
+
+	t.Run("Uses the schemes configured per route", func(t *testing.T) {
+		if status := send("POST", "/order", orderBody, map[string]string{"api_key": "apitest"}); status != http.StatusUnauthorized {
+			t.Errorf("Expected an API key to be refused on a signature route, got %d", status)
+		}
+		if status := send("GET", "/order/1", "", map[string]string{"api_key": "apitest"}); status != http.StatusOK {
+			t.Errorf("Expected an API key to be accepted elsewhere, got %d", status)
+		}
+		if status := send("GET", "/order/1", "", signed("GET", "/order/1", "", "nonce-8", time.Now())); status != http.StatusUnauthorized {
+			t.Errorf("Expected a signature to be refused where only API keys are accepted, got %d", status)
+		}
+
+		if _, err := entities.ParseAuthSchemes("POST /order=password"); err == nil {
+			t.Error("Expected an error for an unknown scheme")
+		}
+	})
+
+	t.Run("Bounds the nonce cache", func(t *testing.T) {
+		nonces := repositories.NewNonceRepository(2)
+		expiresAt := time.Now().Add(time.Minute)
+
+		// a is refused while cached and accepted again once c pushes it out.
+		var claims []bool
+		for _, nonce := range []string{"a", "b", "a", "c", "a"} {
+			fresh, err := nonces.Claim(context.Background(), nonce, expiresAt)
+			if err != nil {
+				t.Fatalf("Failed to claim nonce: %v", err)
+			}
+			claims = append(claims, fresh)
+		}
+		if !slices.Equal(claims, []bool{true, true, false, true, true}) {
+			t.Errorf("Unexpected claims %v", claims)
+		}
+	})
+}
+
+func testValidationProblems(t *testing.T, testServer *TestServer) {
+	const invalidOrder = `{"items":[{"productId":"","quantity":0},{"productId":"10","quantity":1},{"productId":"11","quantity":-1}]}`
+	expected := []errors.FieldError{
+		{Pointer: "/items/0/productId", Code: errors.ViolationRequired},
+		{Pointer: "/items/0/quantity", Code: errors.ViolationNotPositive},
+		{Pointer: "/items/2/quantity", Code: errors.ViolationNotPositive},
+	}
+
+	request := func(method, path, body, accept string, authorized bool) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, testServer.server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if authorized {
+			req.Header.Set("api_key", "apitest")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		return resp
+	}
+	checkFields := func(t *testing.T, fields []errors.FieldError) {
+		t.Helper()
+
+		if len(fields) != len(expected) {
+			t.Fatalf("Expected %d violations, got %+v", len(expected), fields)
+		}
+		for i, field := range fields {
+			if field.Pointer != expected[i].Pointer || field.Code != expected[i].Code || field.Message == "" {
+				t.Errorf("Violation %d: expected %s %s, got %+v", i, expected[i].Pointer, expected[i].Code, field)
+			}
+		}
+	}
+
+	t.Run("Reports every violation as problem+json", func(t *testing.T) {
+		resp := request("POST", "/order", invalidOrder, "application/problem+json", true)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+			t.Errorf("Expected Content-Type application/problem+json, got '%s'", contentType)
+		}
+
+		var problem errors.ProblemDetails
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+			t.Fatalf("Failed to decode problem: %v", err)
+		}
+		if problem.Type != "about:blank" || problem.Title != "Bad Request" || problem.Status != http.StatusBadRequest || problem.Instance != "/order" {
+			t.Errorf("Unexpected problem members: %+v", problem)
+		}
+		if problem.CorrelationID == "" {
+			t.Error("Expected the problem to carry a correlation ID")
+		}
+		checkFields(t, problem.Errors)
+	})
+
+	t.Run("Keeps the error envelope by default", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", "application/json", "application/json, application/problem+json;q=0.5"} {
+			resp := request("POST", "/order", invalidOrder, accept, true)
+
+			if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Accept '%s': expected Content-Type application/json, got '%s'", accept, contentType)
+			}
+
+			var errorResp errors.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			resp.Body.Close()
+
+			checkFields(t, errorResp.Error.Details)
+		}
+	})
+
+	t.Run("Reports refund line violations", func(t *testing.T) {
+		resp := request("POST", "/order/unknown/refund", `{"lines":[{"productId":"10","quantity":1},{"productId":"10","quantity":0}]}`, "application/problem+json", true)
+		defer resp.Body.Close()
+
+		var problem errors.ProblemDetails
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+			t.Fatalf("Failed to decode problem: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest || len(problem.Errors) != 2 ||
+			problem.Errors[0].Pointer != "/lines/1/productId" || problem.Errors[0].Code != errors.ViolationDuplicate ||
+			problem.Errors[1].Pointer != "/lines/1/quantity" || problem.Errors[1].Code != errors.ViolationNotPositive {
+			t.Errorf("Unexpected refund problem (status %d): %+v", resp.StatusCode, problem)
+		}
+	})
+
+	t.Run("Negotiates authentication errors too", func(t *testing.T) {
+		resp := request("POST", "/order", invalidOrder, "application/problem+json", false)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected status 401, got %d", resp.StatusCode)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+			t.Errorf("Expected Content-Type application/problem+json, got '%s'", contentType)
+		}
+	})
+}
+
+func testCORS(t *testing.T, testServer *TestServer) {
+	request := func(method, path string, headers map[string]string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, testServer.server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	preflight := func(path, origin, method string) *http.Response {
+		t.Helper()
+		return request("OPTIONS", path, map[string]string{"Origin": origin, "Access-Control-Request-Method": method})
+	}
+
+	t.Run("Answers preflights with the methods of the route", func(t *testing.T) {
+		resp := preflight("/order", "https://shop.example.com", "POST")
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://shop.example.com" {
+			t.Errorf("Expected the origin to be echoed, got '%s'", got)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Expected credentials to be allowed, got '%s'", got)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Methods"); got != "POST" {
+			t.Errorf("Expected only POST for /order, got '%s'", got)
+		}
+		if !slices.Contains(resp.Header.Values("Vary"), "Origin") {
+			t.Errorf("Expected Vary: Origin, got %v", resp.Header.Values("Vary"))
+		}
+
+		resp = preflight("/cart/cart_1/items/10", "https://shop.example.com", "DELETE")
+		if got := resp.Header.Get("Access-Control-Allow-Methods"); resp.StatusCode != http.StatusNoContent || got != "PUT, DELETE" {
+			t.Errorf("Expected PUT and DELETE for cart items, got %d '%s'", resp.StatusCode, got)
+		}
+	})
+
+	t.Run("Rejects preflights to unknown routes and methods", func(t *testing.T) {
+		if resp := preflight("/unknown", "https://shop.example.com", "GET"); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 for an unknown path, got %d", resp.StatusCode)
+		}
+
+		resp := preflight("/order", "https://shop.example.com", "PATCH")
+		if resp.StatusCode != http.StatusMethodNotAllowed || !strings.Contains(resp.Header.Get("Allow"), "POST") {
+			t.Errorf("Expected status 405 allowing POST, got %d '%s'", resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	})
+
+	t.Run("Only allows listed origins and subdomains", func(t *testing.T) {
+		origins := map[string]bool{
+			"https://shop.example.com":          true,
+			"https://pos-1.kiosk.example.com":   true,
+			"https://a.b.kiosk.example.com":     true,
+			"https://kiosk.example.com":         false,
+			"http://pos-1.kiosk.example.com":    false,
+			"https://pos-1.kiosk.example.com.x": false,
+			"https://evil.example.net":          false,
+		}
+		for origin, allowed := range origins {
+			resp := request("GET", "/product", map[string]string{"Origin": origin})
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); (got == origin) != allowed || (!allowed && got != "") {
+				t.Errorf("Expected origin '%s' allowed=%v, got Access-Control-Allow-Origin '%s'", origin, allowed, got)
+			}
+			if !slices.Contains(resp.Header.Values("Vary"), "Origin") {
+				t.Errorf("Expected Vary: Origin for '%s'", origin)
+			}
+		}
+	})
+
+	t.Run("Exposes the configured headers", func(t *testing.T) {
+		resp := request("GET", "/product", map[string]string{"Origin": "https://shop.example.com"})
+
+		if got := resp.Header.Get("Access-Control-Expose-Headers"); got != "X-Request-ID, Retry-After" {
+			t.Errorf("Expected the configured exposed headers, got '%s'", got)
+		}
+	})
+
+	t.Run("Rejects invalid policies", func(t *testing.T) {
+		invalid := []middleware.CORSOptions{
+			{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			{AllowedOrigins: []string{"shop.example.com"}},
+			{AllowedOrigins: []string{"https://shop.*.example.com"}},
+			{AllowedOrigins: []string{"https://shop.example.com/path"}},
+		}
+		for _, options := range invalid {
+			if _, err := middleware.NewCORSMiddleware(options); err == nil {
+				t.Errorf("Expected an error for %+v", options)
+			}
+		}
+	})
+}
+
+func testCorrelationIDs(t *testing.T, testServer *TestServer) {
+	request := func(path string, headers map[string]string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest("GET", testServer.server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("Echoes the client request ID", func(t *testing.T) {
+		resp := request("/product", map[string]string{"X-Request-ID": "support-ticket-42"})
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Request-ID"); got != "support-ticket-42" {
+			t.Errorf("Expected X-Request-ID 'support-ticket-42', got '%s'", got)
+		}
+	})
+
+	t.Run("Uses the traceparent trace ID", func(t *testing.T) {
+		resp := request("/product", map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Request-ID"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected the trace ID as X-Request-ID, got '%s'", got)
+		}
+	})
+
+	t.Run("Generates an ID for unusable headers", func(t *testing.T) {
+		resp := request("/product", map[string]string{
+			"X-Request-ID": "bad id <script>",
+			"traceparent":  "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		})
+		resp.Body.Close()
+
+		got := resp.Header.Get("X-Request-ID")
+		if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(got) {
+			t.Errorf("Expected a generated X-Request-ID, got '%s'", got)
+		}
+	})
+
+	t.Run("Includes the ID in error responses", func(t *testing.T) {
+		// /webhooks without an API key fails in the auth middleware rather
+		// than in a handler.
+		for path, apiKey := range map[string]string{"/product/999": "", "/order/unknown": "apitest", "/webhooks": ""} {
+			requestID := "req" + strings.ReplaceAll(path, "/", "-")
+			resp := request(path, map[string]string{"X-Request-ID": requestID, "api_key": apiKey})
+
+			var errorResponse errors.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			resp.Body.Close()
+
+			if errorResponse.Error.CorrelationID != requestID {
+				t.Errorf("%s: expected correlation ID '%s' in the body, got '%s'", path, requestID, errorResponse.Error.CorrelationID)
+			}
+		}
+	})
+}
+
+func testAccessLog(t *testing.T, testServer *TestServer) {
+	type accessLogEntry struct {
+		Message       string            `json:"msg"`
+		CorrelationID string            `json:"correlation_id"`
+		Method        string            `json:"method"`
+		Route         string            `json:"route"`
+		StatusCode    int               `json:"status_code"`
+		Bytes         int64             `json:"bytes"`
+		ClientIP      string            `json:"client_ip"`
+		APIKeyID      string            `json:"api_key_id"`
+		Headers       map[string]string `json:"headers"`
+		Body          map[string]any    `json:"body"`
+	}
+
+	find := func(correlationID string) (accessLogEntry, string) {
+		t.Helper()
+
+		for _, line := range strings.Split(testServer.accessLog.String(), "\n") {
+			var entry accessLogEntry
+			if json.Unmarshal([]byte(line), &entry) == nil && entry.CorrelationID == correlationID {
+				return entry, line
+			}
+		}
+		t.Fatalf("No access log entry for request %s", correlationID)
+		return accessLogEntry{}, ""
+	}
+
+	t.Run("Records the request with secrets redacted", func(t *testing.T) {
+		req, err := http.NewRequest("POST", testServer.server.URL+"/order", strings.NewReader(`{"couponCode":"HAPPYHRS","items":[{"productId":"10","quantity":1}]}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("api_key", "apitest")
+		req.Header.Set("X-Request-ID", "access-log-order")
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 127.0.0.1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		responseBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		entry, line := find("access-log-order")
+
+		if entry.Method != "POST" || entry.Route != "POST /order" || entry.StatusCode != resp.StatusCode || entry.Bytes != int64(len(responseBody)) {
+			t.Errorf("Unexpected request fields: %+v", entry)
+		}
+		if entry.ClientIP != "203.0.113.7" {
+			t.Errorf("Expected client IP from the trusted proxy chain, got '%s'", entry.ClientIP)
+		}
+		if entry.APIKeyID != middleware.APIKeyID("apitest") {
+			t.Errorf("Expected API key ID '%s', got '%s'", middleware.APIKeyID("apitest"), entry.APIKeyID)
+		}
+		if entry.Headers["Api_key"] != "[REDACTED]" || entry.Body["couponCode"] != "[REDACTED]" || entry.Body["items"] == nil {
+			t.Errorf("Expected api_key and couponCode to be redacted, got headers %v and body %v", entry.Headers, entry.Body)
+		}
+		if strings.Contains(line, "apitest") || strings.Contains(line, "HAPPYHRS") {
+			t.Errorf("Secret leaked into the access log: %s", line)
+		}
+	})
+
+	t.Run("Stops at the first untrusted forwarded hop", func(t *testing.T) {
+		req, err := http.NewRequest("GET", testServer.server.URL+"/product/999", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("X-Request-ID", "access-log-spoof")
+		req.Header.Set("X-Forwarded-For", "198.51.100.1, 10.0.0.1")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+
+		entry, _ := find("access-log-spoof")
+		if entry.Route != "GET /product/{id}" || entry.StatusCode != http.StatusNotFound {
+			t.Errorf("Unexpected request fields: %+v", entry)
+		}
+		if entry.ClientIP != "10.0.0.1" {
+			t.Errorf("Expected the nearest untrusted hop, got '%s'", entry.ClientIP)
+		}
+	})
+
+	t.Run("Samples successful responses only", func(t *testing.T) {
+		var output lockedBuffer
+		accessLogMiddleware, err := middleware.NewAccessLogMiddleware(middleware.AccessLogOptions{SuccessSampleRate: 0}, &logger.Logger{Logger: slog.New(slog.NewJSONHandler(&output, nil))})
+		if err != nil {
+			t.Fatalf("Failed to create access log middleware: %v", err)
+		}
+
+		for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+			handler := accessLogMiddleware.LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/product", nil))
+		}
+
+		if strings.Count(output.String(), "\n") != 1 || !strings.Contains(output.String(), `"status_code":400`) {
+			t.Errorf("Expected only the 400 response to be logged, got %s", output.String())
+		}
+	})
+}
+
+// testPanicRecovery runs its own mux, as no real handler panics on purpose.
+func testPanicRecovery(t *testing.T) {
+	crashReportDir := filepath.Join(t.TempDir(), "crashes")
+	var output lockedBuffer
+
+	recoveryMiddleware, err := middleware.NewRecoveryMiddleware(crashReportDir, &logger.Logger{Logger: slog.New(slog.NewJSONHandler(&output, nil))})
+	if err != nil {
+		t.Fatalf("Failed to create recovery middleware: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /boom/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom " + r.PathValue("id"))
+	})
+	mux.HandleFunc("GET /abort", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	server := httptest.NewServer(middleware.NewCorrelationMiddleware().Correlate(recoveryMiddleware.Recover(mux)))
+	defer server.Close()
+
+	t.Run("Answers with a 500 error response", func(t *testing.T) {
+		for _, id := range []string{"1", "2"} {
+			req, err := http.NewRequest("GET", server.URL+"/boom/"+id, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("X-Request-ID", "panic-"+id)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to make request: %v", err)
+			}
+
+			var errorResponse errors.ErrorResponse
+			err = json.NewDecoder(resp.Body).Decode(&errorResponse)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+
+			if resp.StatusCode != http.StatusInternalServerError || errorResponse.Error.Code != http.StatusInternalServerError || errorResponse.Error.CorrelationID != "panic-"+id {
+				t.Errorf("Expected a 500 error response for panic-%s, got %d %+v", id, resp.StatusCode, errorResponse)
+			}
+		}
+	})
+
+	t.Run("Logs and counts panics per route", func(t *testing.T) {
+		if count := recoveryMiddleware.PanicCounts()["GET /boom/{id}"]; count != 2 {
+			t.Errorf("Expected 2 panics for the route, got %d", count)
+		}
+
+		logs := output.String()
+		if !strings.Contains(logs, `"correlation_id":"panic-1"`) || !strings.Contains(logs, `"panic":"boom 1"`) || !strings.Contains(logs, "runtime/debug.Stack") {
+			t.Errorf("Expected the panic and stack trace to be logged, got %s", logs)
+		}
+	})
+
+	t.Run("Writes crash reports", func(t *testing.T) {
+		reports, err := filepath.Glob(filepath.Join(crashReportDir, "crash-*-panic-2.txt"))
+		if err != nil || len(reports) != 1 {
+			t.Fatalf("Expected one crash report for panic-2, got %v (%v)", reports, err)
+		}
+
+		report, err := os.ReadFile(reports[0])
+		if err != nil {
+			t.Fatalf("Failed to read crash report: %v", err)
+		}
+		if !strings.Contains(string(report), "route: GET /boom/{id}") || !strings.Contains(string(report), "panic: boom 2") {
+			t.Errorf("Unexpected crash report: %s", report)
+		}
+	})
+
+	t.Run("Lets aborted handlers drop the connection", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/abort")
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected the connection to be dropped, got status %d", resp.StatusCode)
+		}
+		if count := recoveryMiddleware.PanicCounts()["GET /abort"]; count != 0 {
+			t.Errorf("Expected aborts not to be counted, got %d", count)
+		}
+	})
+}
+
+func testRateLimiting(t *testing.T, testServer *TestServer) {
+	t.Run("Reports the budget on every response", func(t *testing.T) {
+		resp, err := http.Get(testServer.server.URL + "/product")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.Header.Get("RateLimit-Limit") != "100000" || resp.Header.Get("RateLimit-Policy") != "100000;w=60" || resp.Header.Get("RateLimit-Remaining") == "" {
+			t.Errorf("Expected RateLimit headers, got %v", resp.Header)
+		}
+	})
+
+	// The limits below are too tight for the shared server, so they run
+	// against their own mux.
+	rules, err := entities.ParseRateLimitRules("GET /product=3/1m; POST /order=2/1m; premium:POST /order=4/1m; ip:POST /order=6/1m")
+	if err != nil {
+		t.Fatalf("Failed to parse rate limits: %v", err)
+	}
+	trustedProxies, _ := middleware.ParseTrustedProxies("127.0.0.1")
+
+	serve := func(keyTiers map[string]string) *httptest.Server {
+		rateLimitMiddleware := middleware.NewRateLimitMiddleware(repositories.NewRateLimitRepository(100), middleware.RateLimitOptions{
+			Policy:         entities.RateLimitPolicy{Rules: rules},
+			KeyTiers:       keyTiers,
+			TrustedProxies: trustedProxies,
+		}, logger.New())
+		authMiddleware := middleware.NewAuthMiddleware(testServer.apiKeyService, nil, nil, nil, logger.New())
+
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		mux := http.NewServeMux()
+		mux.Handle("GET /product", rateLimitMiddleware.Limit(ok))
+		mux.Handle("POST /order", rateLimitMiddleware.LimitClientIP(authMiddleware.RequireAPIKey(rateLimitMiddleware.Limit(ok))))
+		return httptest.NewServer(mux)
+	}
+
+	request := func(server *httptest.Server, method, path string, headers map[string]string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	allowed := func(server *httptest.Server, method, path string, headers map[string]string) int {
+		count := 0
+		for i := 0; i < 10; i++ {
+			if request(server, method, path, headers).StatusCode == http.StatusTooManyRequests {
+				break
+			}
+			count++
+		}
+		return count
+	}
+
+	t.Run("Limits anonymous clients by IP", func(t *testing.T) {
+		server := serve(nil)
+		defer server.Close()
+
+		if count := allowed(server, "GET", "/product", map[string]string{"X-Forwarded-For": "203.0.113.1"}); count != 3 {
+			t.Errorf("Expected 3 requests before limiting, got %d", count)
+		}
+		if count := allowed(server, "GET", "/product", map[string]string{"X-Forwarded-For": "203.0.113.2"}); count != 3 {
+			t.Errorf("Expected another client IP to have its own budget, got %d", count)
+		}
+	})
+
+	t.Run("Limits API keys per route and tier", func(t *testing.T) {
+		server := serve(nil)
+		defer server.Close()
+
+		if count := allowed(server, "POST", "/order", map[string]string{"api_key": "apitest"}); count != 2 {
+			t.Errorf("Expected 2 orders for a standard key, got %d", count)
+		}
+
+		premium := serve(map[string]string{middleware.APIKeyID("apitest"): "premium"})
+		defer premium.Close()
+
+		if count := allowed(premium, "POST", "/order", map[string]string{"api_key": "apitest"}); count != 4 {
+			t.Errorf("Expected 4 orders for a premium key, got %d", count)
+		}
+	})
+
+	t.Run("Limits failed authentication by IP", func(t *testing.T) {
+		server := serve(nil)
+		defer server.Close()
+
+		guess := map[string]string{"api_key": "guess", "X-Forwarded-For": "203.0.113.1"}
+		if resp := request(server, "POST", "/order", guess); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for an invalid key, got %d", resp.StatusCode)
+		}
+		if count := allowed(server, "POST", "/order", guess); count != 5 {
+			t.Errorf("Expected 6 attempts before limiting, got %d", count+1)
+		}
+		if count := allowed(server, "POST", "/order", map[string]string{"api_key": "apitest", "X-Forwarded-For": "203.0.113.2"}); count != 2 {
+			t.Errorf("Expected another client IP to keep its budget, got %d", count)
+		}
+	})
+
+	t.Run("Answers with 429 and Retry-After", func(t *testing.T) {
+		server := serve(nil)
+		defer server.Close()
+
+		allowed(server, "GET", "/product", nil)
+
+		req, err := http.NewRequest("GET", server.URL+"/product", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var errorResponse errors.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || errorResponse.Error.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected a 429 error response, got %d %+v", resp.StatusCode, errorResponse)
+		}
+		if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 20 {
+			t.Errorf("Expected Retry-After of at most 20 seconds, got '%s'", resp.Header.Get("Retry-After"))
+		}
+		if resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Limit") != "3" {
+			t.Errorf("Expected an exhausted budget of 3, got %v", resp.Header)
+		}
+	})
+
+	t.Run("Refills buckets and evicts the least recently used", func(t *testing.T) {
+		store := repositories.NewRateLimitRepository(2)
+		limit := entities.RateLimit{Requests: 2, Period: time.Minute}
+		start := time.Now()
+
+		take := func(key string, at time.Time) bool {
+			decision, err := store.Take(context.Background(), key, limit, at)
+			if err != nil {
+				t.Fatalf("Failed to take token: %v", err)
+			}
+			return decision.Allowed
+		}
+
+		if !take("a", start) || !take("a", start) || take("a", start) {
+			t.Fatal("Expected a bucket of 2 tokens")
+		}
+		if !take("a", start.Add(30*time.Second)) {
+			t.Error("Expected a token after 30 seconds")
+		}
+
+		take("b", start.Add(30*time.Second))
+		take("c", start.Add(30*time.Second))
+		if !take("a", start.Add(30*time.Second)) || !take("a", start.Add(30*time.Second)) {
+			t.Error("Expected the evicted bucket to start full")
+		}
+	})
+}
+
 func testErrorResponseFormat(t *testing.T, testServer *TestServer) {
 	t.Run("404 Not Found format", func(t *testing.T) {
 		resp, err := http.Get(testServer.server.URL + "/nonexistent")
@@ -371,8 +3244,8 @@ func validateProductSchema(t *testing.T, product entities.Product, context strin
 	if product.Name == "" {
 		t.Errorf("%s: missing required field 'name'", context)
 	}
-	if product.Price <= 0 {
-		t.Errorf("%s: invalid price value: %f", context, product.Price)
+	if !product.Price.IsPositive() {
+		t.Errorf("%s: invalid price value: %s", context, product.Price)
 	}
 	if product.Category == "" {
 		t.Errorf("%s: missing required field 'category'", context)
@@ -396,11 +3269,11 @@ func validateOrderSchema(t *testing.T, order entities.Order) {
 	if order.ID == "" {
 		t.Error("Order: missing required field 'id'")
 	}
-	if order.Total < 0 {
-		t.Errorf("Order: invalid total value: %f", order.Total)
+	if order.Total.IsNegative() {
+		t.Errorf("Order: invalid total value: %s", order.Total)
 	}
-	if order.Discounts < 0 {
-		t.Errorf("Order: invalid discounts value: %f", order.Discounts)
+	if order.Discounts.IsNegative() {
+		t.Errorf("Order: invalid discounts value: %s", order.Discounts)
 	}
 	if len(order.Items) == 0 {
 		t.Error("Order: missing required field 'items'")
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ooliokartchallenge/internal/domain/entities"
+)
+
+func TestMoneyRounding(t *testing.T) {
+	testCases := []struct {
+		name     string
+		amount   string
+		percent  int64
+		mode     entities.RoundingMode
+		expected string
+	}{
+		{name: "half even rounds tie to even", amount: "0.25", percent: 10, mode: entities.RoundHalfEven, expected: "0.02"},
+		{name: "half even rounds tie up to even", amount: "0.35", percent: 10, mode: entities.RoundHalfEven, expected: "0.04"},
+		{name: "half up rounds tie away from zero", amount: "0.25", percent: 10, mode: entities.RoundHalfUp, expected: "0.03"},
+		{name: "half even rounds above half up", amount: "999.99", percent: 10, mode: entities.RoundHalfEven, expected: "100.00"},
+		{name: "down truncates", amount: "999.99", percent: 10, mode: entities.RoundDown, expected: "99.99"},
+		{name: "floor on negative amount", amount: "-0.25", percent: 10, mode: entities.RoundFloor, expected: "-0.03"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount := entities.MustParseMoney(tc.amount, "USD")
+
+			result, err := amount.Percent(tc.percent, tc.mode)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.String() != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result.String())
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := entities.MustParseMoney("999.99", "USD")
+
+	t.Run("Multiply and subtract stay exact", func(t *testing.T) {
+		total, err := price.Multiply(3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		discounted, err := total.Sub(entities.MustParseMoney("0.97", "USD"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if discounted.Amount() != 299900 {
+			t.Errorf("Expected 299900 minor units, got %d", discounted.Amount())
+		}
+	})
+
+	t.Run("Currency mismatch is rejected", func(t *testing.T) {
+		if _, err := price.Add(entities.MustParseMoney("1", "EUR")); err == nil {
+			t.Error("Expected currency mismatch error")
+		}
+	})
+
+	t.Run("Overflow is rejected", func(t *testing.T) {
+		if _, err := price.Multiply(1 << 62); err == nil {
+			t.Error("Expected overflow error")
+		}
+	})
+
+	t.Run("Too many fractional digits are rejected", func(t *testing.T) {
+		if _, err := entities.ParseMoney("1.001", "USD"); err == nil {
+			t.Error("Expected parse error")
+		}
+	})
+
+	t.Run("JSON stays a plain number", func(t *testing.T) {
+		data, err := json.Marshal(map[string]entities.Money{"price": price})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if string(data) != `{"price":999.99}` {
+			t.Errorf("Unexpected JSON: %s", data)
+		}
+
+		var decoded map[string]entities.Money
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if decoded["price"] != price {
+			t.Errorf("Expected %s after round trip, got %s", price, decoded["price"])
+		}
+	})
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	discount := entities.MustParseMoney("0.10", "USD")
+
+	parts, err := discount.Allocate([]int64{1, 1, 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []int64{4, 3, 3}
+	for i, part := range parts {
+		if part.Amount() != expected[i] {
+			t.Errorf("Part %d: expected %d, got %d", i, expected[i], part.Amount())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/idgen"
+)
+
+func TestOrderIDGenerators(t *testing.T) {
+	snowflake, err := idgen.NewSnowflakeGenerator(7)
+	if err != nil {
+		t.Fatalf("Failed to create snowflake generator: %v", err)
+	}
+
+	generators := map[string]interfaces.OrderIDGenerator{
+		"ulid":      idgen.NewULIDGenerator(),
+		"snowflake": snowflake,
+	}
+
+	for name, generator := range generators {
+		t.Run(name+" is unique under concurrency", func(t *testing.T) {
+			const workers, perWorker = 8, 500
+
+			var mutex sync.Mutex
+			var wg sync.WaitGroup
+			seen := make(map[string]bool, workers*perWorker)
+
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						id, err := generator.NewID()
+						if err != nil {
+							t.Errorf("Unexpected error: %v", err)
+							return
+						}
+						mutex.Lock()
+						if seen[id] {
+							t.Errorf("Duplicate ID %s", id)
+						}
+						seen[id] = true
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+
+		t.Run(name+" is sortable", func(t *testing.T) {
+			ids := make([]string, 200)
+			for i := range ids {
+				id, err := generator.NewID()
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				ids[i] = id
+			}
+
+			if !sort.SliceIsSorted(ids, func(i, j int) bool {
+				if len(ids[i]) != len(ids[j]) {
+					return len(ids[i]) < len(ids[j])
+				}
+				return ids[i] < ids[j]
+			}) {
+				t.Error("Expected IDs in generation order")
+			}
+		})
+	}
+
+	t.Run("snowflake rejects out of range node ID", func(t *testing.T) {
+		if _, err := idgen.NewSnowflakeGenerator(idgen.MaxSnowflakeNodeID + 1); err == nil {
+			t.Error("Expected error for node ID above range")
+		}
+	})
+}
+
+func TestDailySequencer(t *testing.T) {
+	sequencer := idgen.NewDailySequencer(time.UTC)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	var number string
+	for i := 0; i < 1000; i++ {
+		var err error
+		number, err = sequencer.Next(ctx, day)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if i == 41 && number != "#A042" {
+			t.Errorf("Expected #A042, got %s", number)
+		}
+	}
+
+	if number != "#B001" {
+		t.Errorf("Expected the 1000th ticket to be #B001, got %s", number)
+	}
+
+	next, err := sequencer.Next(ctx, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if next != "#A001" {
+		t.Errorf("Expected sequence to restart the next day, got %s", next)
+	}
+}
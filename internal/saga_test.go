@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ooliokartchallenge/internal/application/saga"
+	"ooliokartchallenge/internal/domain/entities"
+	"ooliokartchallenge/internal/domain/interfaces"
+	"ooliokartchallenge/internal/infrastruture/repositories"
+)
+
+type sagaTestState struct {
+	Done []string `json:"done"`
+}
+
+// newTestSaga builds a three step saga that records what ran and what was
+// undone. failAt names a step whose action fails.
+func newTestSaga(repo interfaces.SagaRepository, failAt string, undone *[]string, lastRetryable bool) *saga.Saga[sagaTestState] {
+	step := func(name string, retryable bool) saga.Step[sagaTestState] {
+		return saga.Step[sagaTestState]{
+			Name: name,
+			Action: func(ctx context.Context, state *sagaTestState) error {
+				if name == failAt {
+					return errors.New(name + " failed")
+				}
+				state.Done = append(state.Done, name)
+				return nil
+			},
+			Compensate: func(ctx context.Context, state *sagaTestState) error {
+				*undone = append(*undone, name)
+				return nil
+			},
+			Retryable: retryable,
+		}
+	}
+
+	return saga.New("test", repo, step("first", false), step("second", false), step("third", lastRetryable))
+}
+
+func TestSagaRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Completes every step", func(t *testing.T) {
+		repo, _ := repositories.NewSagaRepository("", time.Hour)
+		var undone []string
+
+		state := &sagaTestState{}
+		if err := newTestSaga(repo, "", &undone, false).Run(ctx, "ok", state); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		record, err := repo.GetByID(ctx, "ok")
+		if err != nil {
+			t.Fatalf("Failed to load saga log: %v", err)
+		}
+		if record.Status != entities.SagaStatusCompleted || len(undone) != 0 {
+			t.Errorf("Expected a completed saga with nothing undone, got '%s' and %v", record.Status, undone)
+		}
+		for _, step := range record.Steps {
+			if step.Status != entities.SagaStepCompleted || step.Attempts != 1 || step.StartedAt == nil || step.FinishedAt == nil {
+				t.Errorf("Unexpected step log: %+v", step)
+			}
+		}
+	})
+
+	t.Run("Compensates completed steps in reverse", func(t *testing.T) {
+		repo, _ := repositories.NewSagaRepository("", time.Hour)
+		var undone []string
+
+		err := newTestSaga(repo, "third", &undone, false).Run(ctx, "fails", &sagaTestState{})
+		if err == nil || err.Error() != "third failed" {
+			t.Fatalf("Expected the failing step's error, got %v", err)
+		}
+
+		if len(undone) != 2 || undone[0] != "second" || undone[1] != "first" {
+			t.Errorf("Expected second then first to be compensated, got %v", undone)
+		}
+
+		record, _ := repo.GetByID(ctx, "fails")
+		if record.Status != entities.SagaStatusCompensated || record.Error != "third failed" {
+			t.Errorf("Expected a compensated saga, got '%s' (%s)", record.Status, record.Error)
+		}
+		if record.Steps[2].Status != entities.SagaStepFailed || record.Steps[0].Status != entities.SagaStepCompensated {
+			t.Errorf("Unexpected step log: %+v", record.Steps)
+		}
+	})
+}
+
+func TestSagaRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	// interrupted writes the log of a saga that stopped while its third
+	// step was running, as a crash would leave it.
+	interrupted := func(t *testing.T, path string) {
+		t.Helper()
+
+		repo, err := repositories.NewSagaRepository(path, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to open saga log: %v", err)
+		}
+
+		now := time.Now().UTC()
+		record := &entities.SagaRecord{
+			ID:     "crashed",
+			Name:   "test",
+			Status: entities.SagaStatusRunning,
+			Steps: []entities.SagaStepLog{
+				{Name: "first", Status: entities.SagaStepCompleted, Attempts: 1},
+				{Name: "second", Status: entities.SagaStepCompleted, Attempts: 1},
+				{Name: "third", Status: entities.SagaStepRunning, Attempts: 1},
+			},
+			State:     []byte(`{"done":["first","second"]}`),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := repo.Save(ctx, record); err != nil {
+			t.Fatalf("Failed to save saga: %v", err)
+		}
+	}
+
+	t.Run("Compensates when remaining steps are not retryable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sagas.json")
+		interrupted(t, path)
+
+		repo, err := repositories.NewSagaRepository(path, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to reopen saga log: %v", err)
+		}
+
+		var undone []string
+		recovered, err := saga.RecoverAll(ctx, repo, newTestSaga(repo, "", &undone, false))
+		if err != nil || recovered != 1 {
+			t.Fatalf("Expected one recovered saga, got %d (%v)", recovered, err)
+		}
+
+		if len(undone) != 3 || undone[0] != "third" {
+			t.Errorf("Expected the interrupted step and both completed steps to be compensated, got %v", undone)
+		}
+
+		record, _ := repo.GetByID(ctx, "crashed")
+		if record.Status != entities.SagaStatusCompensated {
+			t.Errorf("Expected status 'compensated', got '%s'", record.Status)
+		}
+	})
+
+	t.Run("Resumes when remaining steps are retryable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sagas.json")
+		interrupted(t, path)
+
+		repo, err := repositories.NewSagaRepository(path, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to reopen saga log: %v", err)
+		}
+
+		var undone []string
+		if _, err := saga.RecoverAll(ctx, repo, newTestSaga(repo, "", &undone, true)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		record, _ := repo.GetByID(ctx, "crashed")
+		if record.Status != entities.SagaStatusCompleted || record.Steps[2].Attempts != 2 {
+			t.Errorf("Expected the third step to be retried to completion, got '%s' with %+v", record.Status, record.Steps[2])
+		}
+		if string(record.State) != `{"done":["first","second","third"]}` {
+			t.Errorf("Unexpected state after resume: %s", record.State)
+		}
+		if len(undone) != 0 {
+			t.Errorf("Expected nothing to be compensated, got %v", undone)
+		}
+
+		unfinished, _ := repo.ListUnfinished(ctx)
+		if len(unfinished) != 0 {
+			t.Errorf("Expected no unfinished sagas, got %d", len(unfinished))
+		}
+	})
+}